@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/request"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxCollectionNameRunes = 100
+
+// savePhoto bookmarks a photo, optionally adding it to one of the user's
+// collections as well.
+func (app *application) savePhoto(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photo, ok := app.readVisiblePhoto(w, r, user)
+	if !ok {
+		return
+	}
+	photoID := photo.ID
+
+	var input struct {
+		CollectionID *uuid.UUID `json:"collection_id"`
+	}
+
+	// The body is optional when saving without a collection.
+	if r.ContentLength != 0 {
+		err := request.DecodeJSON(w, r, &input)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+	}
+
+	if input.CollectionID != nil {
+		_, err := app.data.Collections.Get(r.Context(), *input.CollectionID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				var v validator.Validator
+				v.AddFieldError("collection_id", "Must be one of your collections")
+				app.failedValidation(w, r, v)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	err := app.data.Saves.Insert(r.Context(), user.ID, photoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if input.CollectionID != nil {
+		err = app.data.Collections.AddPhoto(r.Context(), *input.CollectionID, user.ID, photoID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsavePhoto removes a photo from the given collection_id, or unsaves it
+// entirely, removing it from every collection, if no collection is given.
+func (app *application) unsavePhoto(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if value := r.URL.Query().Get("collection_id"); value != "" {
+		collectionID, err := uuid.Parse(value)
+		if err != nil {
+			app.notFound(w, r)
+			return
+		}
+
+		err = app.data.Collections.RemovePhoto(r.Context(), collectionID, user.ID, photoID)
+	} else {
+		err = app.data.Saves.Delete(r.Context(), user.ID, photoID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getSavedPhotos(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	photos, metadata, err := app.data.Saves.GetPhotos(r.Context(), user.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"photos": photos, "metadata": metadata})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listCollections(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	collections, err := app.data.Collections.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, collections)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func validateCollectionName(v *validator.Validator, name string) {
+	v.CheckField(validator.NotBlank(name), "name", "Must be provided")
+	v.CheckField(validator.MaxRunes(name, maxCollectionNameRunes), "name", fmt.Sprintf("Must not be more than %d characters", maxCollectionNameRunes))
+}
+
+func (app *application) createCollection(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+	validateCollectionName(&v, input.Name)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	collection := &data.Collection{
+		UserID: user.ID,
+		Name:   input.Name,
+	}
+
+	err = app.data.Collections.Insert(r.Context(), collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCollection):
+			app.errorMessage(w, r, http.StatusConflict, "you already have a collection with this name", nil)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, collection)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readCollection loads the user's collection in the URL, writing an error
+// response and returning false if there isn't one.
+func (app *application) readCollection(w http.ResponseWriter, r *http.Request, user *data.User) (*data.Collection, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	collection, err := app.data.Collections.Get(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return collection, true
+}
+
+func (app *application) getCollection(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	collection, ok := app.readCollection(w, r, user)
+	if !ok {
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	photos, metadata, err := app.data.Collections.GetPhotos(r.Context(), collection.ID, user.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{
+		"collection": collection,
+		"photos":     photos,
+		"metadata":   metadata,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// updateCollection renames a collection or moves it to a new position.
+func (app *application) updateCollection(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	collection, ok := app.readCollection(w, r, user)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name     *string `json:"name"`
+		Position *int    `json:"position"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+	if input.Position != nil {
+		collection.Position = *input.Position
+	}
+
+	var v validator.Validator
+	validateCollectionName(&v, collection.Name)
+	v.CheckField(collection.Position >= 0, "position", "Must not be negative")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	err = app.data.Collections.Update(r.Context(), collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCollection):
+			app.errorMessage(w, r, http.StatusConflict, "you already have a collection with this name", nil)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, collection)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Collections.Delete(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -9,9 +9,31 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	requestLogContextKey  = contextKey("requestLog")
+	tokenLookupContextKey = contextKey("tokenLookup")
+)
+
+// tokenLookup records the user that identifyUser found for a bearer token, or
+// a nil user if the token is invalid, so that authenticateToken doesn't look
+// the same token up again.
+type tokenLookup struct {
+	token string
+	user  *data.User
+}
+
+// requestLog collects details for the access log that are only known deeper
+// in the middleware chain, where the request has a context of its own.
+type requestLog struct {
+	userID int64
+}
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if entry, ok := r.Context().Value(requestLogContextKey).(*requestLog); ok {
+		entry.userID = user.ID
+	}
+
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -23,3 +45,18 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetTokenLookup(r *http.Request, token string, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenLookupContextKey, &tokenLookup{token: token, user: user})
+	return r.WithContext(ctx)
+}
+
+// contextGetTokenLookup returns the result of looking up token in
+// identifyUser, if it got one.
+func (app *application) contextGetTokenLookup(r *http.Request, token string) (*tokenLookup, bool) {
+	lookup, ok := r.Context().Value(tokenLookupContextKey).(*tokenLookup)
+	if !ok || lookup.token != token {
+		return nil, false
+	}
+	return lookup, true
+}
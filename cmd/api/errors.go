@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/logging"
 	"athifirshad.com/bettergram/internal/response"
 	"athifirshad.com/bettergram/internal/validator"
 )
@@ -20,26 +27,75 @@ func (app *application) reportServerError(r *http.Request, err error) {
 	)
 
 	requestAttrs := slog.Group("request", "method", method, "url", url)
-	app.logger.Error(message, requestAttrs, "trace", trace)
+	app.logger.ErrorContext(r.Context(), message, requestAttrs, "trace", trace)
 }
 
 func (app *application) errorMessage(w http.ResponseWriter, r *http.Request, status int, message string, headers http.Header) {
 	message = strings.ToUpper(message[:1]) + message[1:]
 
-	err := response.JSONWithHeaders(w, status, map[string]string{"Error": message}, headers)
+	body := map[string]string{
+		"Error":     message,
+		"RequestID": logging.RequestID(r.Context()),
+	}
+
+	err := response.JSONWithHeaders(w, status, body, headers)
 	if err != nil {
 		app.reportServerError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// statusClientClosedRequest is the non-standard status, borrowed from nginx,
+// recorded for requests the client gave up on before they were answered.
+const statusClientClosedRequest = 499
+
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case data.IsCanceled(err) && errors.Is(context.Cause(r.Context()), errShuttingDown):
+		app.serverShuttingDown(w, r)
+		return
+	case data.IsCanceled(err):
+		app.requestCanceled(w, r)
+		return
+	case data.IsTimeout(err):
+		app.requestTimedOut(w, r, err)
+		return
+	}
+
 	app.reportServerError(r, err)
 
 	message := "The server encountered a problem and could not process your request"
 	app.errorMessage(w, r, http.StatusInternalServerError, message, nil)
 }
 
+// requestCanceled is used when a query was canceled because the client
+// disconnected. Nobody is left to read the response, but the status shows up
+// in the access log and metrics.
+func (app *application) requestCanceled(w http.ResponseWriter, r *http.Request) {
+	app.logger.DebugContext(r.Context(), "request canceled by client")
+
+	message := "The request was canceled"
+	app.errorMessage(w, r, statusClientClosedRequest, message, nil)
+}
+
+// serverShuttingDown is used when a query was canceled because the server
+// is shutting down and the request ran past the shutdown period.
+func (app *application) serverShuttingDown(w http.ResponseWriter, r *http.Request) {
+	app.logger.WarnContext(r.Context(), "request canceled by shutdown")
+
+	message := "The server is restarting, please try again later"
+	app.errorMessage(w, r, http.StatusServiceUnavailable, message, nil)
+}
+
+// requestTimedOut is used when a query took longer than its deadline, which
+// usually means the database is overloaded.
+func (app *application) requestTimedOut(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.WarnContext(r.Context(), "query timed out", "error", err)
+
+	message := "The server took too long to process your request, please try again later"
+	app.errorMessage(w, r, http.StatusServiceUnavailable, message, nil)
+}
+
 func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
 	message := "The requested resource could not be found"
 	app.errorMessage(w, r, http.StatusNotFound, message, nil)
@@ -55,7 +111,12 @@ func (app *application) badRequest(w http.ResponseWriter, r *http.Request, err e
 }
 
 func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, v validator.Validator) {
-	err := response.JSON(w, http.StatusUnprocessableEntity, v)
+	body := struct {
+		validator.Validator
+		RequestID string
+	}{v, logging.RequestID(r.Context())}
+
+	err := response.JSON(w, http.StatusUnprocessableEntity, body)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
@@ -64,3 +125,20 @@ func (app *application) invalidAuthenticationToken(w http.ResponseWriter, r *htt
 	message := "Invalid or missing authentication token"
 	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
 }
+
+func (app *application) invalidCredentials(w http.ResponseWriter, r *http.Request) {
+	message := "Invalid authentication credentials"
+	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
+}
+
+func (app *application) notPermitted(w http.ResponseWriter, r *http.Request) {
+	message := "Your user account doesn't have the necessary permissions to access this resource"
+	app.errorMessage(w, r, http.StatusForbidden, message, nil)
+}
+
+func (app *application) rateLimitExceeded(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	app.errorMessage(w, r, http.StatusTooManyRequests, message, headers)
+}
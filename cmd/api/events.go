@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	eventsHeartbeatInterval = 15 * time.Second
+	maxWatchedPhotos        = 50
+)
+
+// publish sends an event to the streams of userID and of everyone watching
+// photoID, on every API instance.
+func (app *application) publish(ctx context.Context, eventType string, userID int64, photoID *uuid.UUID, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return app.events.Publish(ctx, events.Event{
+		Type:    eventType,
+		UserID:  userID,
+		PhotoID: photoID,
+		Data:    payload,
+	})
+}
+
+// visiblePhotoIDs returns the IDs in ids of the photos viewerID is allowed to
+// see.
+func (app *application) visiblePhotoIDs(ctx context.Context, ids []uuid.UUID, viewerID int64) ([]uuid.UUID, error) {
+	var visible []uuid.UUID
+
+	for _, id := range ids {
+		_, err := app.data.Photos.GetVisible(ctx, id, viewerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				continue
+			default:
+				return nil, err
+			}
+		}
+		visible = append(visible, id)
+	}
+
+	return visible, nil
+}
+
+// streamEvents pushes the user's notifications, and new comments and likes on
+// the photos given in photo_id query parameters, as Server-Sent Events.
+func (app *application) streamEvents(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var photoIDs []uuid.UUID
+	var v validator.Validator
+
+	for _, value := range r.URL.Query()["photo_id"] {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			v.AddFieldError("photo_id", "Must be a photo ID")
+			break
+		}
+		photoIDs = append(photoIDs, id)
+	}
+	v.CheckField(len(photoIDs) <= maxWatchedPhotos, "photo_id", fmt.Sprintf("Must not watch more than %d photos", maxWatchedPhotos))
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	// Photos the user can't see are left out rather than reported, so that
+	// their existence isn't revealed.
+	photoIDs, err := app.visiblePhotoIDs(r.Context(), photoIDs, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The stream outlives the server's WriteTimeout, so the deadline is
+	// cleared for this connection. Shutdown is handled by the broker closing
+	// the subscription.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sub := app.events.Subscribe(user.ID, photoIDs)
+	defer app.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprint(w, "retry: 5000\n\n")
+	if err == nil {
+		err = rc.Flush()
+	}
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			payload, err := json.Marshal(event)
+			if err != nil {
+				app.reportServerError(r, err)
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			if err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+		}
+
+		err := rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
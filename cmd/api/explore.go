@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+)
+
+// getExplore returns a page of recent public photos ranked by engagement.
+// Clients pass back the generation from the first page to keep paging
+// through the same ranking after scores are refreshed.
+func (app *application) getExplore(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	filters := readFilters(qs, &v)
+
+	var generation int64
+	if value := qs.Get("generation"); value != "" {
+		var err error
+		generation, err = strconv.ParseInt(value, 10, 64)
+		v.CheckField(err == nil && generation > 0, "generation", "Must be a positive number")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	photos, generation, metadata, err := app.data.Explore.Get(r.Context(), app.contextGetUser(r).ID, generation, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorMessage(w, r, http.StatusGone, "the explore feed has been refreshed since this generation, start again from the first page", nil)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{
+		"photos":     photos,
+		"generation": generation,
+		"metadata":   metadata,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// refreshExplore recomputes the explore scores.
+func (app *application) refreshExplore(ctx context.Context) error {
+	generation, err := app.data.Explore.Refresh(ctx, app.config.Explore.Weights(), app.config.Explore.Generations)
+	if err != nil {
+		return err
+	}
+
+	if generation != 0 {
+		app.logger.DebugContext(ctx, "refreshed explore scores", "generation", generation)
+	}
+
+	return nil
+}
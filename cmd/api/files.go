@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// serveUpload serves a stored photo or story file under /uploads/. Files are
+// only served to users who can see a photo or story using them, so files of
+// private users need the viewer's token, which browsers can pass in the
+// access_token query parameter. Hidden paths, such as temporary files being
+// committed, and directories are reported as not found, so that the stored
+// files can't be listed.
+func (app *application) serveUpload(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			app.notFound(w, r)
+			return
+		}
+	}
+
+	visible, err := app.data.Photos.FileVisible(r.Context(), "/uploads/"+key, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFound(w, r)
+		return
+	}
+
+	file, err := os.Open(app.storage.Path(key))
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		app.notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
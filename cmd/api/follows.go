@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) followUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	followeeID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if followeeID == user.ID {
+		app.errorMessage(w, r, http.StatusUnprocessableEntity, "you can't follow yourself", nil)
+		return
+	}
+
+	follow := &data.Follow{
+		FollowerID: user.ID,
+		FolloweeID: followeeID,
+	}
+
+	err = app.data.Follows.Insert(r.Context(), follow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFollow):
+			app.errorMessage(w, r, http.StatusConflict, "you are already following this user", nil)
+		case errors.Is(err, data.ErrDuplicateFollowRequest):
+			app.errorMessage(w, r, http.StatusConflict, "you have already asked to follow this user", nil)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, data.ErrBlocked):
+			app.notPermitted(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	notification := data.NotificationFollow
+	status := http.StatusCreated
+	if follow.Pending {
+		notification = data.NotificationFollowRequest
+		status = http.StatusAccepted
+	}
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		return app.notify(ctx, &data.Notification{
+			UserID:  followeeID,
+			ActorID: user.ID,
+			Type:    notification,
+		})
+	})
+
+	err = response.JSON(w, status, follow)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	followeeID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Follows.Delete(r.Context(), user.ID, followeeID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		err := app.data.Notifications.DeleteByActor(ctx, user.ID, data.NotificationFollow, nil, followeeID)
+		if err != nil {
+			return err
+		}
+		return app.data.Notifications.DeleteByActor(ctx, user.ID, data.NotificationFollowRequest, nil, followeeID)
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) listFollowRequests(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	requests, metadata, err := app.data.Follows.GetRequests(r.Context(), user.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"follow_requests": requests, "metadata": metadata})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// approveFollowRequest lets the user with the given ID follow the
+// authenticated user.
+func (app *application) approveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.data.Follows.Approve)
+}
+
+func (app *application) declineFollowRequest(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.data.Follows.Decline)
+}
+
+// answerFollowRequest approves or declines the follow request from the user
+// with the given ID, and removes the notification asking for approval.
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(ctx context.Context, targetID, requesterID int64) error) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = answer(r.Context(), user.ID, requesterID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		return app.data.Notifications.DeleteByActor(ctx, requesterID, data.NotificationFollowRequest, nil, user.ID)
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) blockUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if blockedID == user.ID {
+		app.errorMessage(w, r, http.StatusUnprocessableEntity, "you can't block yourself", nil)
+		return
+	}
+
+	block := &data.Block{
+		BlockerID: user.ID,
+		BlockedID: blockedID,
+	}
+
+	err = app.data.Blocks.Insert(r.Context(), block)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateBlock):
+			app.errorMessage(w, r, http.StatusConflict, "you have already blocked this user", nil)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, block)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) unblockUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Blocks.Delete(r.Context(), user.ID, blockedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
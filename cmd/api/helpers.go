@@ -1,26 +1,189 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/metrics"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (app *application) backgroundTask(r *http.Request, fn func() error) {
+func (app *application) backgroundTask(r *http.Request, fn func(ctx context.Context) error) {
 	app.wg.Add(1)
+	app.metrics.BackgroundTasks.Inc()
+
+	// The task usually outlives the request, so its span keeps the request's
+	// trace but not its cancellation.
+	ctx, span := tracer.Start(context.WithoutCancel(r.Context()), "background task")
 
 	go func() {
 		defer app.wg.Done()
+		defer app.metrics.BackgroundTasks.Dec()
+		defer span.End()
 
 		defer func() {
 			err := recover()
 			if err != nil {
+				app.metrics.BackgroundTaskRuns.WithLabelValues("error").Inc()
+				span.SetStatus(codes.Error, fmt.Sprintf("%s", err))
 				app.reportServerError(r, fmt.Errorf("%s", err))
 			}
 		}()
 
-		err := fn()
+		err := fn(ctx)
+		app.metrics.BackgroundTaskRuns.WithLabelValues(metrics.Result(err)).Inc()
 		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 			app.reportServerError(r, err)
 		}
 	}()
 }
+
+// backgroundJob runs fn every interval until ctx is cancelled. Like
+// backgroundTask it is tracked by app.wg so that shutdown waits for the
+// current run to finish.
+func (app *application) backgroundJob(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.runJob(ctx, name, fn)
+			}
+		}
+	}()
+}
+
+// runJob runs fn once in its own trace. Jobs aren't tied to any request, so
+// each run starts a new trace rather than continuing one. The run is canceled
+// if ctx is, and otherwise given up to db.job_timeout to finish.
+func (app *application) runJob(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.DB.JobTimeout)
+	defer cancel()
+
+	ctx, span := tracer.Start(ctx, "job "+name, trace.WithNewRoot())
+	defer span.End()
+
+	defer func() {
+		err := recover()
+		if err != nil {
+			app.metrics.JobRuns.WithLabelValues(name, "error").Inc()
+			span.SetStatus(codes.Error, fmt.Sprintf("%s", err))
+			app.logger.ErrorContext(ctx, fmt.Sprintf("%s", err), "job", name)
+		}
+	}()
+
+	err := fn(ctx)
+	app.metrics.JobRuns.WithLabelValues(name, metrics.Result(err)).Inc()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.logger.ErrorContext(ctx, err.Error(), "job", name)
+	}
+}
+
+// clientIP returns the IP address of the client. Behind a trusted reverse
+// proxy, that is the address the proxy appended to X-Forwarded-For.
+func (app *application) clientIP(r *http.Request) string {
+	if app.config.RateLimit.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parsePhotoForm parses a multipart photo upload, rejecting requests larger
+// than the maximum photo size. It reports whether the form was parsed; if
+// not, an error response has already been sent.
+func (app *application) parsePhotoForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.Upload.MaxPhotoSize)
+
+	err := r.ParseMultipartForm(app.config.Upload.MaxPhotoSize)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			message := fmt.Sprintf("photo must not be larger than %d bytes", app.config.Upload.MaxPhotoSize)
+			app.errorMessage(w, r, http.StatusRequestEntityTooLarge, message, nil)
+		default:
+			app.badRequest(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// readVisiblePhoto loads the photo in the URL if the user is allowed to see
+// it, writing an error response and returning false otherwise. Photos hidden
+// from the user are reported as not found, so that their existence isn't
+// revealed.
+func (app *application) readVisiblePhoto(w http.ResponseWriter, r *http.Request, user *data.User) (*data.Photo, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	photo, err := app.data.Photos.GetVisible(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return photo, true
+}
+
+// readFilters reads the page and page_size query string parameters, recording
+// any problems in v.
+func readFilters(qs url.Values, v *validator.Validator) data.Filters {
+	filters := data.Filters{Page: 1, PageSize: 20}
+
+	if value := qs.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		v.CheckField(err == nil && validator.Between(page, 1, 10_000_000), "page", "Must be a number between 1 and 10000000")
+		filters.Page = page
+	}
+
+	if value := qs.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		v.CheckField(err == nil && validator.Between(pageSize, 1, 100), "page_size", "Must be a number between 1 and 100")
+		filters.PageSize = pageSize
+	}
+
+	return filters
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
 	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
 	"athifirshad.com/bettergram/internal/request"
 	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -19,18 +22,19 @@ func (app *application) likePhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
-	if err != nil {
-		app.notFound(w, r)
+	photo, ok := app.readVisiblePhoto(w, r, user)
+	if !ok {
 		return
 	}
+	photoID := photo.ID
 
 	like := &data.Like{
-		PhotoID: photoID,
-		UserID:  user.ID,
+		PhotoID:  photoID,
+		UserID:   user.ID,
+		Reaction: data.DefaultReaction,
 	}
 
-	err = app.data.Likes.Insert(like)
+	err := app.data.Likes.Insert(r.Context(), like)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateLike):
@@ -41,6 +45,21 @@ func (app *application) likePhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.metrics.Likes.Inc()
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		err := app.publish(ctx, events.TypeLike, 0, &photoID, like)
+		if err != nil {
+			return err
+		}
+
+		return app.notify(ctx, &data.Notification{
+			ActorID: user.ID,
+			Type:    data.NotificationLike,
+			PhotoID: &photoID,
+		})
+	})
+
 	err = response.JSON(w, http.StatusCreated, like)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -60,12 +79,16 @@ func (app *application) unlikePhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.data.Likes.Delete(photoID, user.ID)
+	err = app.data.Likes.Delete(r.Context(), photoID, user.ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	app.backgroundTask(r, func(ctx context.Context) error {
+		return app.data.Notifications.DeleteByActor(ctx, user.ID, data.NotificationLike, &photoID, 0)
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -76,17 +99,17 @@ func (app *application) addComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
-	if err != nil {
-		app.notFound(w, r)
+	photo, ok := app.readVisiblePhoto(w, r, user)
+	if !ok {
 		return
 	}
+	photoID := photo.ID
 
 	var input struct {
 		Content string `json:"content"`
 	}
 
-	err = request.DecodeJSON(w, r, &input)
+	err := request.DecodeJSON(w, r, &input)
 	if err != nil {
 		app.badRequest(w, r, err)
 		return
@@ -99,12 +122,30 @@ func (app *application) addComment(w http.ResponseWriter, r *http.Request) {
 		Content: input.Content,
 	}
 
-	err = app.data.Comments.Insert(comment)
+	err = app.data.Comments.Insert(r.Context(), comment)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	app.metrics.Comments.Inc()
+
+	comment.Mentions = app.saveMentions(r, user, photoID, &comment.ID, comment.Content)
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		err := app.publish(ctx, events.TypeComment, 0, &photoID, comment)
+		if err != nil {
+			return err
+		}
+
+		return app.notify(ctx, &data.Notification{
+			ActorID:   user.ID,
+			Type:      data.NotificationComment,
+			PhotoID:   &photoID,
+			CommentID: &comment.ID,
+		})
+	})
+
 	err = response.JSON(w, http.StatusCreated, comment)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -112,13 +153,25 @@ func (app *application) addComment(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) getPhotoComments(w http.ResponseWriter, r *http.Request) {
-	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
-	if err != nil {
-		app.notFound(w, r)
+	photo, ok := app.readVisiblePhoto(w, r, app.contextGetUser(r))
+	if !ok {
+		return
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = data.CommentSortNewest
+	}
+
+	var v validator.Validator
+	v.CheckField(validator.In(sort, data.CommentSortNewest, data.CommentSortTop), "sort", "Must be newest or top")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
-	comments, err := app.data.Comments.GetByPhotoID(photoID)
+	comments, err := app.data.Comments.GetByPhotoID(r.Context(), photo.ID, sort)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -135,6 +188,106 @@ func (app *application) getPhotoComments(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// likeComment reacts to a comment with the default reaction.
+func (app *application) likeComment(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	commentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	reaction := &data.CommentReaction{
+		CommentID: commentID,
+		UserID:    user.ID,
+		Reaction:  data.DefaultReaction,
+	}
+
+	err = app.data.CommentReactions.Insert(r.Context(), reaction)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateLike):
+			app.errorMessage(w, r, http.StatusConflict, "comment has already been liked", nil)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, reaction)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// pinComment pins a comment to the top of one of the user's photos.
+func (app *application) pinComment(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	commentID, err := uuid.Parse(chi.URLParam(r, "commentID"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Comments.Pin(r.Context(), photoID, commentID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unpinComment(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Comments.Unpin(r.Context(), photoID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (app *application) searchPhotos(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
@@ -142,7 +295,7 @@ func (app *application) searchPhotos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	photos, err := app.data.Photos.Search(query)
+	photos, err := app.data.Photos.Search(r.Context(), query, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"athifirshad.com/bettergram/internal/data"
+)
+
+func TestLikePhoto(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	photo := ts.createPhoto(t, alice, "beach")
+	path := "/photos/" + photo.ID.String()
+
+	res := ts.do(t, http.MethodPost, path+"/like", bobToken, nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	var like data.Like
+	res.decode(t, &like)
+
+	if like.PhotoID != photo.ID || like.Reaction != data.DefaultReaction {
+		t.Errorf("got like %+v", like)
+	}
+
+	res = ts.do(t, http.MethodPost, path+"/like", bobToken, nil)
+	checkStatus(t, res, http.StatusConflict)
+
+	res = ts.do(t, http.MethodGet, path, aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var got data.Photo
+	res.decode(t, &got)
+
+	if got.Reactions[data.DefaultReaction] != 1 {
+		t.Errorf("got reactions %v; want one like", got.Reactions)
+	}
+
+	res = ts.do(t, http.MethodGet, "/notifications/unread-count", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var unread struct {
+		UnreadCount int `json:"unread_count"`
+	}
+	res.decode(t, &unread)
+
+	if unread.UnreadCount != 1 {
+		t.Errorf("got %d unread notifications; want 1", unread.UnreadCount)
+	}
+
+	res = ts.do(t, http.MethodDelete, path+"/like", bobToken, nil)
+	checkStatus(t, res, http.StatusNoContent)
+
+	res = ts.do(t, http.MethodGet, "/notifications/unread-count", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+	res.decode(t, &unread)
+
+	if unread.UnreadCount != 0 {
+		t.Errorf("got %d unread notifications after unliking; want 0", unread.UnreadCount)
+	}
+
+	res = ts.do(t, http.MethodPost, "/photos/00000000-0000-0000-0000-000000000000/like", bobToken, nil)
+	checkStatus(t, res, http.StatusNotFound)
+}
+
+// TestPrivatePhotoInteractions checks that photos hidden by a private account
+// can't be read or acted on by anyone who doesn't follow it.
+func TestPrivatePhotoInteractions(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	photo := ts.createPhoto(t, alice, "beach")
+	path := "/photos/" + photo.ID.String()
+
+	res := ts.do(t, http.MethodPatch, "/users/profile", aliceToken, map[string]bool{"is_private": true})
+	checkStatus(t, res, http.StatusOK)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		body   any
+	}{
+		{http.MethodGet, path + "/comments", "", nil},
+		{http.MethodGet, path + "/comments", bobToken, nil},
+		{http.MethodPost, path + "/comments", bobToken, map[string]string{"content": "Hi"}},
+		{http.MethodPost, path + "/like", bobToken, nil},
+		{http.MethodPut, path + "/reaction", bobToken, map[string]string{"reaction": "love"}},
+		{http.MethodPost, path + "/save", bobToken, nil},
+	}
+
+	for _, tt := range tests {
+		res := ts.do(t, tt.method, tt.path, tt.token, tt.body)
+		checkStatus(t, res, http.StatusNotFound)
+	}
+
+	res = ts.do(t, http.MethodGet, path+"/comments", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+}
+
+func TestReactToPhoto(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	photo := ts.createPhoto(t, alice, "beach")
+	path := "/photos/" + photo.ID.String()
+
+	res := ts.do(t, http.MethodPut, path+"/reaction", bobToken, map[string]string{"reaction": "nope"})
+	checkStatus(t, res, http.StatusUnprocessableEntity)
+
+	for _, reaction := range []string{"love", "haha"} {
+		res = ts.do(t, http.MethodPut, path+"/reaction", bobToken, map[string]string{"reaction": reaction})
+		checkStatus(t, res, http.StatusOK)
+	}
+
+	res = ts.do(t, http.MethodGet, path, aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var got data.Photo
+	res.decode(t, &got)
+
+	if len(got.Reactions) != 1 || got.Reactions["haha"] != 1 {
+		t.Errorf("got reactions %v; want a single haha", got.Reactions)
+	}
+
+	res = ts.do(t, http.MethodPut, "/photos/00000000-0000-0000-0000-000000000000/reaction", bobToken, map[string]string{"reaction": "love"})
+	checkStatus(t, res, http.StatusNotFound)
+
+	res = ts.do(t, http.MethodDelete, path+"/reaction", bobToken, nil)
+	checkStatus(t, res, http.StatusNoContent)
+
+	res = ts.do(t, http.MethodGet, path, aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+	got = data.Photo{}
+	res.decode(t, &got)
+
+	if len(got.Reactions) != 0 {
+		t.Errorf("got reactions %v; want none", got.Reactions)
+	}
+}
+
+func TestComments(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+	_, carolToken := ts.register(t, "carol")
+
+	photo := ts.createPhoto(t, alice, "beach")
+	path := "/photos/" + photo.ID.String()
+
+	var ids []string
+	for _, content := range []string{"First!", "Nice one @carol"} {
+		res := ts.do(t, http.MethodPost, path+"/comments", bobToken, map[string]string{"content": content})
+		checkStatus(t, res, http.StatusCreated)
+
+		var comment data.Comment
+		res.decode(t, &comment)
+
+		if comment.Content != content || comment.Username != "bob" {
+			t.Errorf("got comment %+v", comment)
+		}
+		ids = append(ids, comment.ID.String())
+	}
+
+	res := ts.do(t, http.MethodGet, path+"/comments", "", nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var comments []data.Comment
+	res.decode(t, &comments)
+
+	if len(comments) != 2 || comments[0].Content != "Nice one @carol" || comments[1].Content != "First!" {
+		t.Fatalf("got comments %+v; want newest first", comments)
+	}
+	if len(comments[0].Mentions) != 1 || comments[0].Mentions[0].Username != "carol" {
+		t.Errorf("got mentions %+v; want carol", comments[0].Mentions)
+	}
+
+	res = ts.do(t, http.MethodGet, path+"/comments?sort=oldest", "", nil)
+	checkStatus(t, res, http.StatusUnprocessableEntity)
+
+	// Alice is notified of the comments and Carol of the mention.
+	for _, tt := range []struct {
+		token string
+		want  string
+	}{
+		{aliceToken, data.NotificationComment},
+		{carolToken, data.NotificationMention},
+	} {
+		res := ts.do(t, http.MethodGet, "/notifications", tt.token, nil)
+		checkStatus(t, res, http.StatusOK)
+
+		var body struct {
+			Notifications []data.NotificationGroup `json:"notifications"`
+		}
+		res.decode(t, &body)
+
+		if len(body.Notifications) != 1 || body.Notifications[0].Type != tt.want {
+			t.Errorf("got notifications %+v; want one %s", body.Notifications, tt.want)
+		}
+	}
+
+	t.Run("pin", func(t *testing.T) {
+		res := ts.do(t, http.MethodPut, path+"/pinned-comment/"+ids[0], bobToken, nil)
+		checkStatus(t, res, http.StatusNotFound)
+
+		res = ts.do(t, http.MethodPut, path+"/pinned-comment/"+ids[0], aliceToken, nil)
+		checkStatus(t, res, http.StatusNoContent)
+
+		res = ts.do(t, http.MethodGet, path+"/comments", "", nil)
+		checkStatus(t, res, http.StatusOK)
+
+		var comments []data.Comment
+		res.decode(t, &comments)
+
+		if comments[0].ID.String() != ids[0] || !comments[0].Pinned || comments[1].Pinned {
+			t.Errorf("got comments %+v; want the first comment pinned on top", comments)
+		}
+
+		res = ts.do(t, http.MethodPut, path+"/pinned-comment/00000000-0000-0000-0000-000000000000", aliceToken, nil)
+		checkStatus(t, res, http.StatusNotFound)
+
+		res = ts.do(t, http.MethodDelete, path+"/pinned-comment", bobToken, nil)
+		checkStatus(t, res, http.StatusNotFound)
+
+		res = ts.do(t, http.MethodDelete, path+"/pinned-comment", aliceToken, nil)
+		checkStatus(t, res, http.StatusNoContent)
+
+		res = ts.do(t, http.MethodGet, path+"/comments", "", nil)
+		checkStatus(t, res, http.StatusOK)
+		comments = nil
+		res.decode(t, &comments)
+
+		if comments[0].Pinned || comments[1].Pinned {
+			t.Errorf("got comments %+v; want none pinned", comments)
+		}
+	})
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+	_, carolToken := ts.register(t, "carol")
+
+	beach := ts.createPhoto(t, alice, "beach")
+	forest := ts.createPhoto(t, alice, "forest")
+
+	// Likes of the same photo are grouped together.
+	for _, token := range []string{bobToken, carolToken} {
+		res := ts.do(t, http.MethodPost, "/photos/"+beach.ID.String()+"/like", token, nil)
+		checkStatus(t, res, http.StatusCreated)
+	}
+	res := ts.do(t, http.MethodPost, "/photos/"+forest.ID.String()+"/like", bobToken, nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	var body struct {
+		Notifications []data.NotificationGroup `json:"notifications"`
+		UnreadCount   int                      `json:"unread_count"`
+	}
+
+	res = ts.do(t, http.MethodGet, "/notifications", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+	res.decode(t, &body)
+
+	if body.UnreadCount != 2 || len(body.Notifications) != 2 {
+		t.Fatalf("got %+v; want two unread groups", body)
+	}
+
+	beachGroup := body.Notifications[1]
+	if beachGroup.ActorCount != 2 || len(beachGroup.Actors) != 2 || beachGroup.Actors[0] != "carol" {
+		t.Errorf("got group %+v; want carol and bob, most recent first", beachGroup)
+	}
+
+	res = ts.do(t, http.MethodPost, "/notifications/"+beachGroup.Key+"/read", aliceToken, nil)
+	checkStatus(t, res, http.StatusNoContent)
+
+	res = ts.do(t, http.MethodGet, "/notifications", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+	res.decode(t, &body)
+
+	if body.UnreadCount != 1 {
+		t.Errorf("got %d unread groups; want 1", body.UnreadCount)
+	}
+
+	res = ts.do(t, http.MethodPost, "/notifications/read", aliceToken, nil)
+	checkStatus(t, res, http.StatusNoContent)
+
+	res = ts.do(t, http.MethodGet, "/notifications?page=2&page_size=1", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+	body.Notifications = nil
+	res.decode(t, &body)
+
+	if body.UnreadCount != 0 || len(body.Notifications) != 1 || body.Notifications[0].Unread {
+		t.Errorf("got %+v; want the second group, read", body)
+	}
+}
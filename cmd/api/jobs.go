@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// startJobs launches the periodic maintenance jobs and the event listener.
+// They stop once ctx is cancelled during shutdown, which also ends any open
+// event streams so that the server can shut down gracefully.
+func (app *application) startJobs(ctx context.Context) {
+	app.backgroundJob(ctx, "expire uploads", app.config.Upload.ReapInterval, app.expireUploads)
+	app.backgroundJob(ctx, "expire stories", app.config.Stories.ReapInterval, app.expireStories)
+	app.backgroundJob(ctx, "refresh explore", app.config.Explore.RefreshInterval, app.refreshExplore)
+	app.backgroundJob(ctx, "refresh suggestions", app.config.Suggestions.RefreshInterval, app.refreshSuggestions)
+	app.backgroundJob(ctx, "clean up rate limits", time.Minute, app.cleanupRateLimits)
+	app.backgroundJob(ctx, "clean up login failures", time.Hour, app.cleanupLoginFailures)
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.events.Run(ctx)
+	}()
+}
+
+// cleanupRateLimits forgets rate limit buckets that have fully refilled.
+func (app *application) cleanupRateLimits(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return app.limiter.Cleanup(ctx)
+}
+
+// cleanupLoginFailures forgets failed logins that no longer slow anyone down.
+func (app *application) cleanupLoginFailures(ctx context.Context) error {
+	return app.data.LoginFailures.DeleteExpired(ctx, app.config.Login.FailureWindow)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+)
+
+// authenticateCredentials checks an email and password for loginUser and
+// createAuthenticationTokenHandler. Attempts are counted per email and per
+// client IP before the password is checked, and slow down or lock out further
+// attempts according to the login policies. A successful login forgets the
+// failures of the account, but not those of the client IP. It writes an
+// error response and returns false if the credentials can't be used.
+func (app *application) authenticateCredentials(w http.ResponseWriter, r *http.Request, email, password string) (*data.User, bool) {
+	emailKey := "email:" + strings.ToLower(email)
+	ipKey := "ip:" + app.clientIP(r)
+
+	// Accounts are locked by email whether or not one is registered, so
+	// lockouts don't reveal which emails exist.
+	wait, delays, err := app.data.LoginFailures.Reserve(r.Context(),
+		data.LoginKey{Key: emailKey, Policy: app.config.Login.AccountPolicy()},
+		data.LoginKey{Key: ipKey, Policy: app.config.Login.IPPolicy()},
+	)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	if wait > 0 {
+		app.loginLocked(w, r, wait)
+		return nil, false
+	}
+
+	user, err := app.data.Users.Authenticate(r.Context(), email, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCredentials):
+			if delays[0] >= app.config.Login.Lockout {
+				app.accountLocked(r, email)
+			}
+			app.invalidCredentials(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Only the account's failures are forgotten. Otherwise anyone with an
+	// account could clear the failures of their client IP between guesses
+	// at other accounts, so those are left to expire after the window, and
+	// only this attempt is taken back.
+	err = app.data.LoginFailures.Reset(r.Context(), emailKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	err = app.data.LoginFailures.Release(r.Context(), data.LoginKey{Key: ipKey, Policy: app.config.Login.IPPolicy()})
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// accountLocked notifies the owner of the account, if there is one, that it
+// has been locked after failed logins.
+func (app *application) accountLocked(r *http.Request, email string) {
+	app.logger.WarnContext(r.Context(), "account locked after failed logins", "ip", app.clientIP(r))
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		user, err := app.data.Users.GetByEmail(ctx, email)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		return app.notify(ctx, &data.Notification{
+			UserID: user.ID,
+			Type:   data.NotificationFailedLogins,
+		})
+	})
+}
+
+func (app *application) loginLocked(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	app.rateLimitExceeded(w, r, wait, "Too many failed login attempts, please try again later")
+}
@@ -1,70 +1,142 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"runtime/debug"
 	"sync"
+	"time"
 
+	"athifirshad.com/bettergram/internal/config"
 	"athifirshad.com/bettergram/internal/data"
 	"athifirshad.com/bettergram/internal/database"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/logging"
+	"athifirshad.com/bettergram/internal/metrics"
+	"athifirshad.com/bettergram/internal/ratelimit"
+	"athifirshad.com/bettergram/internal/storage"
+	"athifirshad.com/bettergram/internal/tracing"
+	"athifirshad.com/bettergram/migrations"
 
 	"github.com/lmittmann/tint"
 )
 
 func main() {
-	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.LevelDebug}))
+	// Replaced by the configured logger once the config has been loaded.
+	slog.SetDefault(slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.LevelDebug})))
 
-	err := run(logger)
+	err := run()
 	if err != nil {
 		trace := string(debug.Stack())
-		logger.Error(err.Error(), "trace", trace)
+		slog.Error(err.Error(), "trace", trace)
 		os.Exit(1)
 	}
 }
 
-type config struct {
-	baseURL  string
-	httpPort int
-	db       struct {
-		dsn string
-	}
-}
-
 type application struct {
-	config config
-	db     *database.DB
-	logger *slog.Logger
-	wg     sync.WaitGroup
-	data   data.Models
+	config  config.Config
+	db      *database.DB
+	logger  *slog.Logger
+	storage *storage.Store
+	events  *events.Broker
+	limiter ratelimit.Store
+	metrics *metrics.Metrics
+	wg      sync.WaitGroup
+	data    data.Models
 }
 
-func run(logger *slog.Logger) error {
-	var cfg config
+func run() error {
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
 
-	flag.StringVar(&cfg.baseURL, "base-url", "http://localhost:4000", "base URL for the application")
-	flag.IntVar(&cfg.httpPort, "http-port", 4000, "port to listen on for HTTP requests")
+	if cfg.Print {
+		fmt.Print(cfg.Redacted())
+		return nil
+	}
 
-	flag.Parse()
+	logger := slog.New(tracing.NewLogHandler(logging.NewHandler(os.Stdout, cfg.Log.Format, cfg.Log.Level)))
+	slog.SetDefault(logger)
 
-	cfg.db.dsn = os.Getenv("DB_DSN")
-	if cfg.db.dsn == "" {
-		return fmt.Errorf("DB_DSN environment variable is not set")
+	if len(args) > 0 && args[0] != "migrate" {
+		return fmt.Errorf("unknown command %q", args[0])
 	}
 
-	db, err := database.New(cfg.db.dsn)
+	data.BcryptCost = cfg.Auth.BcryptCost
+
+	db, err := database.New(cfg.DB.DSN)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	migrator, err := database.NewMigrator(db.Pool, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		return runMigrate(logger, migrator, args[1:])
+	}
+
+	if cfg.DB.AutoMigrate {
+		err = migrateUp(logger, migrator)
+		if err != nil {
+			return err
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Enabled:     cfg.Tracing.Enabled,
+		ServiceName: cfg.Tracing.ServiceName,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			logger.Error("flushing traces failed", "error", err)
+		}
+	}()
+
+	store, err := storage.New(cfg.Upload.Dir, cfg.Upload.StagingDir)
+	if err != nil {
+		return err
+	}
+
 	app := &application{
-		config: cfg,
-		db:     db,
-		logger: logger,
-		data:   data.NewModels(db.Pool),
+		config:  cfg,
+		db:      db,
+		logger:  logger,
+		storage: store,
+		events:  events.New(db.Pool, logger),
+		metrics: metrics.New(db),
+		data: data.NewModels(db.Pool, data.Timeouts{
+			Read:  cfg.DB.ReadTimeout,
+			Write: cfg.DB.WriteTimeout,
+			List:  cfg.DB.ListTimeout,
+		}),
+	}
+
+	switch cfg.RateLimit.Backend {
+	case config.RateLimitMemory:
+		app.limiter = ratelimit.NewMemory()
+	case config.RateLimitPostgres:
+		app.limiter = ratelimit.NewPostgres(db.Pool)
 	}
 
 	return app.serveHTTP()
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"athifirshad.com/bettergram/internal/data"
+	"github.com/google/uuid"
+)
+
+// saveMentions stores the @mentions in a caption, or in a comment if
+// commentID is not nil, and notifies users who are newly mentioned. It is
+// called once the photo or comment has been saved, so a failure is only
+// logged: failing the request would make the client retry and post it twice.
+func (app *application) saveMentions(r *http.Request, author *data.User, photoID uuid.UUID, commentID *uuid.UUID, text string) []data.Mention {
+	mentions, added, err := app.data.Mentions.Replace(r.Context(), author.ID, photoID, commentID, data.ParseMentions(text))
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "saving mentions failed", "error", err, "photo", photoID)
+		return []data.Mention{}
+	}
+
+	for _, userID := range added {
+		app.backgroundTask(r, func(ctx context.Context) error {
+			return app.notify(ctx, &data.Notification{
+				UserID:    userID,
+				ActorID:   author.ID,
+				Type:      data.NotificationMention,
+				PhotoID:   &photoID,
+				CommentID: commentID,
+			})
+		})
+	}
+
+	return mentions
+}
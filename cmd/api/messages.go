@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/request"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxConversationMembers includes the user who starts the conversation.
+	maxConversationMembers = 8
+	maxMessageRunes        = 2000
+)
+
+func (app *application) listConversations(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	conversations, metadata, err := app.data.Conversations.GetAllForUser(r.Context(), user.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"conversations": conversations, "metadata": metadata})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// createConversation starts a conversation with the given users. Starting a
+// one-to-one conversation that already exists returns the existing one.
+func (app *application) createConversation(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var input struct {
+		UserIDs []int64 `json:"user_ids"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+	v.CheckField(len(input.UserIDs) > 0, "user_ids", "Must contain at least one user")
+	v.CheckField(len(input.UserIDs) < maxConversationMembers, "user_ids", fmt.Sprintf("Must not contain more than %d users", maxConversationMembers-1))
+	v.CheckField(validator.NoDuplicates(input.UserIDs), "user_ids", "Must not contain duplicate users")
+	v.CheckField(validator.NotIn(user.ID, input.UserIDs...), "user_ids", "Must not contain yourself")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if len(input.UserIDs) == 1 {
+		conversation, err := app.data.Conversations.GetDirect(r.Context(), user.ID, input.UserIDs[0])
+		switch {
+		case err == nil:
+			err = response.JSON(w, http.StatusOK, conversation)
+			if err != nil {
+				app.serverError(w, r, err)
+			}
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	id, err := app.data.Conversations.Insert(r.Context(), user.ID, input.UserIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddFieldError("user_ids", "Must only contain existing users")
+			app.failedValidation(w, r, v)
+		case errors.Is(err, data.ErrBlocked):
+			app.notPermitted(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	conversation, err := app.data.Conversations.Get(r.Context(), id, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, conversation)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readConversation loads the conversation in the URL if the user is one of
+// its members, writing an error response and returning false otherwise.
+func (app *application) readConversation(w http.ResponseWriter, r *http.Request, user *data.User) (*data.Conversation, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	conversation, err := app.data.Conversations.Get(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+func (app *application) getConversationMessages(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	conversation, ok := app.readConversation(w, r, user)
+	if !ok {
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	messages, metadata, err := app.data.Messages.GetByConversationID(r.Context(), conversation.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{
+		"conversation": conversation,
+		"messages":     messages,
+		"metadata":     metadata,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// sendMessage posts a text message, or shares an existing photo with an
+// optional message, in a conversation.
+func (app *application) sendMessage(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	conversation, ok := app.readConversation(w, r, user)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content string     `json:"content"`
+		PhotoID *uuid.UUID `json:"photo_id"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+	v.Check(validator.NotBlank(input.Content) || input.PhotoID != nil, "A message must have content or a photo")
+	v.CheckField(validator.MaxRunes(input.Content, maxMessageRunes), "content", fmt.Sprintf("Must not be more than %d characters", maxMessageRunes))
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if input.PhotoID != nil {
+		_, err := app.data.Photos.GetVisible(r.Context(), *input.PhotoID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				v.AddFieldError("photo_id", "Must be an existing photo")
+				app.failedValidation(w, r, v)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	message := &data.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		SenderUsername: user.Username,
+		Content:        input.Content,
+		PhotoID:        input.PhotoID,
+	}
+
+	err = app.data.Messages.Insert(r.Context(), message)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrBlocked):
+			app.notPermitted(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	for _, member := range conversation.Members {
+		if member.UserID == user.ID {
+			continue
+		}
+
+		app.backgroundTask(r, func(ctx context.Context) error {
+			return app.publish(ctx, events.TypeMessage, member.UserID, nil, message)
+		})
+	}
+
+	err = response.JSON(w, http.StatusCreated, message)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// markConversationRead updates the user's read receipt for a conversation.
+func (app *application) markConversationRead(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	conversation, ok := app.readConversation(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := app.data.Conversations.MarkRead(r.Context(), conversation.ID, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,32 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/logging"
+	"athifirshad.com/bettergram/internal/ratelimit"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("athifirshad.com/bettergram/cmd/api")
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -21,39 +39,313 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// maxRequestIDLength is the longest X-Request-ID accepted from clients.
+const maxRequestIDLength = 128
+
+// requestID tags each request with the client's X-Request-ID, or a new ID if
+// it didn't send a usable one. The ID is echoed in the response header, added
+// to log lines and error responses, so that a failing request reported by a
+// client can be found in the server logs.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is short and made of printable ASCII, so
+// that it's safe to write to logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// logRequest writes an access log line for each request once it has been
+// handled.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		entry := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogContextKey, entry))
+
+		next.ServeHTTP(ww, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", routePattern(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", responseStatus(ww)),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("ip", app.clientIP(r)),
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", entry.userID))
+		}
+
+		app.logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// instrument records request counts and latencies by route pattern. The
+// pattern is only known once chi has routed the request, so it is read after
+// the handler returns.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		app.metrics.RequestsInFlight.Inc()
+		defer app.metrics.RequestsInFlight.Dec()
+
+		next.ServeHTTP(ww, r)
+
+		method := methodLabel(r.Method)
+		route := routePattern(r)
+		status := responseStatus(ww)
+
+		app.metrics.Requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		app.metrics.RequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// traceRequest starts a server span for each request, continuing the trace
+// from the client's traceparent header if there is one.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, methodLabel(r.Method),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(app.clientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attribute.String("http.request.id", logging.RequestID(r.Context())),
+			),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := routePattern(r)
+		status := responseStatus(ww)
+
+		span.SetName(methodLabel(r.Method) + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// methodLabel returns the request method for use in metric labels and span
+// names. Clients can send any method, so those outside the standard set are
+// reported as OTHER rather than each getting a series of their own.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// routePattern returns the chi route pattern the request matched, such as
+// /photos/{id}. It is only set once the request has been routed.
+func routePattern(r *http.Request) string {
+	route := chi.RouteContext(r.Context()).RoutePattern()
+	if route == "" {
+		return "unmatched"
+	}
+	return route
+}
+
+// responseStatus returns the status code written to ww.
+func responseStatus(ww middleware.WrapResponseWriter) int {
+	status := ww.Status()
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+// identifyUser looks up the user for a bearer token ahead of the global rate
+// limit, so that authenticated requests are limited per user rather than per
+// client IP. Requests with a missing or invalid token are passed on without a
+// user, leaving authenticateToken to decide how each route treats them, but
+// the result of the lookup is kept so that it isn't repeated. Tokens passed in
+// the query string by tokenFromQuery are only seen by the routes that accept
+// them.
+func (app *application) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || strings.Contains(token, " ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.data.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		switch {
+		case err == nil:
+			r = app.contextSetTokenLookup(app.contextSetUser(r, user), token, user)
+		case errors.Is(err, data.ErrRecordNotFound):
+			r = app.contextSetTokenLookup(r, token, nil)
+		default:
+			// authenticateToken tries again, for the routes that need a user.
+			app.logger.ErrorContext(r.Context(), "identifying user failed", "error", err)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) authenticateToken(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Add("Vary", "Authorization")
-
-        authorizationHeader := r.Header.Get("Authorization")
-
-        if authorizationHeader == "" {
-            r = app.contextSetUser(r, data.AnonymousUser)
-            next.ServeHTTP(w, r)
-            return
-        }
-
-        headerParts := strings.Split(authorizationHeader, " ")
-        if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-            app.invalidAuthenticationToken(w, r)
-            return
-        }
-
-        token := headerParts[1]
-
-        user, err := app.data.Users.GetForToken(data.ScopeAuthentication, token)
-        if err != nil {
-            switch {
-            case errors.Is(err, data.ErrRecordNotFound):
-                app.invalidAuthenticationToken(w, r)
-            default:
-                app.serverError(w, r, err)
-            }
-            return
-        }
-
-        r = app.contextSetUser(r, user)
-
-        next.ServeHTTP(w, r)
-    })
-}
\ No newline at end of file
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		if lookup, ok := app.contextGetTokenLookup(r, token); ok {
+			if lookup.user == nil {
+				app.invalidAuthenticationToken(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, app.contextSetUser(r, lookup.user))
+			return
+		}
+
+		user, err := app.data.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationToken(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+func (app *application) requireModerator(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user == data.AnonymousUser {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		if !user.IsModerator {
+			app.notPermitted(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// tokenFromQuery lets clients that can't set headers, such as the browser
+// EventSource API, pass their token in the access_token query parameter. The
+// parameter is removed from the URL once it has been read, so that the token
+// isn't written to the logs along with it.
+func (app *application) tokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		token := query.Get("access_token")
+		if token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		if query.Has("access_token") {
+			query.Del("access_token")
+			r.URL.RawQuery = query.Encode()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit limits the requests to the routes it wraps, using one bucket per
+// user for authenticated requests and one per client IP otherwise. Each name
+// has its own buckets, so routes can have stricter limits than the global
+// one. To key by user it must come after identifyUser or authenticateToken.
+func (app *application) rateLimit(name string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.config.RateLimit.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := name + ":ip:" + app.clientIP(r)
+			if user, ok := r.Context().Value(userContextKey).(*data.User); ok && user != data.AnonymousUser {
+				key = name + ":user:" + strconv.FormatInt(user.ID, 10)
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+			defer cancel()
+
+			result, err := app.limiter.Take(ctx, key, limit)
+			if err != nil {
+				// Fail open, so that the API stays up if the backend is down.
+				app.logger.ErrorContext(r.Context(), "rate limiter unavailable", "error", err, "limit", name)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(math.Ceil(limit.Period.Seconds()))))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+			if !result.Allowed {
+				app.rateLimitExceeded(w, r, result.RetryAfter, "Rate limit exceeded, please try again later")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
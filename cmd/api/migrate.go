@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"athifirshad.com/bettergram/internal/database"
+)
+
+const migrateUsage = "usage: migrate up | down [n] | status | version"
+
+// runMigrate runs the migrate subcommand with the given arguments.
+func runMigrate(logger *slog.Logger, migrator *database.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		return migrateUp(logger, migrator)
+
+	case "down":
+		if len(args) > 2 {
+			return errors.New(migrateUsage)
+		}
+
+		n := 1
+		if len(args) == 2 {
+			var err error
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("number of migrations to revert must be a positive integer")
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, n)
+		for _, migration := range reverted {
+			logger.Info("reverted migration", "version", migration.Version, "name", migration.Name)
+		}
+		return err
+
+	case "status":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+		for _, migration := range migrator.Migrations() {
+			status := "pending"
+			switch {
+			case migration.Version == version && dirty:
+				status = "dirty"
+			case migration.Version <= version:
+				status = "applied"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", migration.Version, migration.Name, status)
+		}
+		return tw.Flush()
+
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// migrateUp applies any pending migrations.
+func migrateUp(logger *slog.Logger, migrator *database.Migrator) error {
+	applied, err := migrator.Up(context.Background())
+	for _, migration := range applied {
+		logger.Info("applied migration", "version", migration.Version, "name", migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		logger.Info("database schema is up to date")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/request"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (app *application) listBannedHashes(w http.ResponseWriter, r *http.Request) {
+	banned, err := app.data.BannedHashes.GetAll(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, banned)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// banHash adds an image to the banlist, either by the ID of a photo whose
+// hash should be banned or by a hash computed elsewhere.
+func (app *application) banHash(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		PhotoID *uuid.UUID  `json:"photo_id"`
+		Hash    *data.PHash `json:"hash"`
+		Reason  string      `json:"reason"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+	v.Check((input.PhotoID == nil) != (input.Hash == nil), "Exactly one of photo_id or hash must be provided")
+	v.CheckField(validator.MaxRunes(input.Reason, 500), "reason", "Must not be more than 500 characters")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	banned := &data.BannedHash{
+		Reason:    input.Reason,
+		CreatedBy: &user.ID,
+	}
+
+	if input.PhotoID != nil {
+		photo, err := app.data.Photos.GetByID(r.Context(), *input.PhotoID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				app.notFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if photo.PHash == nil {
+			v.AddFieldError("photo_id", "Photo was uploaded before perceptual hashing and can't be banned by ID")
+			app.failedValidation(w, r, v)
+			return
+		}
+
+		banned.Hash = *photo.PHash
+	} else {
+		banned.Hash = *input.Hash
+	}
+
+	err = app.data.BannedHashes.Insert(r.Context(), banned)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, banned)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) unbanHash(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.BannedHashes.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
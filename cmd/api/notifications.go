@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (app *application) listNotifications(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	groups, metadata, err := app.data.Notifications.GetGroups(r.Context(), user.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	unread, err := app.data.Notifications.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{
+		"notifications": groups,
+		"metadata":      metadata,
+		"unread_count":  unread,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) countUnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	unread, err := app.data.Notifications.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]int{"unread_count": unread})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// markNotificationsRead marks a single notification group as read when the
+// route has a key, and every notification otherwise.
+func (app *application) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	err := app.data.Notifications.MarkRead(r.Context(), user.ID, chi.URLParam(r, "key"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notify stores a notification and pushes it to the recipient's event
+// streams. If n.UserID is zero the notification goes to the owner of
+// n.PhotoID.
+func (app *application) notify(ctx context.Context, n *data.Notification) error {
+	var err error
+	if n.UserID == 0 {
+		err = app.data.Notifications.InsertForPhotoOwner(ctx, n)
+	} else {
+		err = app.data.Notifications.Insert(ctx, n)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Nothing was stored for a user acting on their own content.
+	if n.ID == uuid.Nil {
+		return nil
+	}
+
+	return app.publish(ctx, events.TypeNotification, n.UserID, nil, n)
+}
@@ -2,22 +2,19 @@ package main
 
 import (
 	"errors"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/request"
 	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
-type createPhotoInput struct {
-	Caption string `json:"caption"`
-}
-
 func (app *application) uploadPhoto(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	if user == data.AnonymousUser {
@@ -25,75 +22,156 @@ func (app *application) uploadPhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := r.ParseMultipartForm(10 << 20)
+	if !app.parsePhotoForm(w, r) {
+		return
+	}
+
+	file, _, err := r.FormFile("photo")
 	if err != nil {
 		app.badRequest(w, r, err)
 		return
 	}
+	defer file.Close()
 
-	file, handler, err := r.FormFile("photo")
+	input, err := readPhotoInput(r.FormValue)
 	if err != nil {
 		app.badRequest(w, r, err)
 		return
 	}
-	defer file.Close()
 
-	caption := r.FormValue("caption")
+	var v validator.Validator
+	validatePhotoInput(&v, input)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
 
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "/uploads"
+	photo, err := app.storePhoto(r.Context(), user, file, input)
+	if err != nil {
+		app.storePhotoFailed(w, r, err)
+		return
 	}
 
-	filename := uuid.New().String() + filepath.Ext(handler.Filename)
-	filepath := filepath.Join(uploadDir, filename)
+	photo.Mentions = app.saveMentions(r, user, photo.ID, nil, photo.Caption)
 
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+	err = response.JSON(w, http.StatusCreated, photo)
+	if err != nil {
 		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getPhoto(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	photoID, err := uuid.Parse(idStr)
+	if err != nil {
+		app.notFound(w, r)
 		return
 	}
 
-	out, err := os.Create(filepath)
+	photo, err := app.data.Photos.GetVisible(r.Context(), photoID, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverError(w, r, err)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, file)
+	err = response.JSON(w, http.StatusOK, photo)
 	if err != nil {
 		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) updatePhoto(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	photo, err := app.data.Photos.GetByID(r.Context(), photoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if photo.UserID != user.ID {
+		app.notPermitted(w, r)
 		return
 	}
 
-	photo := &data.Photo{
-		UserID:   user.ID,
-		Username: user.Username,
-		PhotoURL: "/uploads/" + filename,
-		Caption:  caption,
+	var input struct {
+		Caption *string `json:"caption"`
+		AltText *string `json:"alt_text"`
 	}
 
-	err = app.data.Photos.Insert(photo)
+	err = request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.Caption != nil {
+		photo.Caption = *input.Caption
+	}
+	if input.AltText != nil {
+		photo.AltText = *input.AltText
+	}
+
+	var v validator.Validator
+	validateAltText(&v, photo.AltText)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	err = app.data.Photos.Update(r.Context(), photo)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	err = response.JSON(w, http.StatusCreated, photo)
+	photo.Mentions = app.saveMentions(r, user, photo.ID, nil, photo.Caption)
+
+	err = response.JSON(w, http.StatusOK, photo)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
 }
 
-func (app *application) getPhoto(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	photoID, err := uuid.Parse(idStr)
+func (app *application) getSimilarPhotos(w http.ResponseWriter, r *http.Request) {
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
 		app.notFound(w, r)
 		return
 	}
 
-	photo, err := app.data.Photos.GetByID(photoID)
+	maxDistance := app.config.Moderation.MaxHashDistance
+	if value := r.URL.Query().Get("max_distance"); value != "" {
+		maxDistance, err = strconv.Atoi(value)
+		if err != nil || maxDistance < 0 || maxDistance > 64 {
+			app.badRequest(w, r, errors.New("max_distance must be an integer between 0 and 64"))
+			return
+		}
+	}
+
+	_, err = app.data.Photos.GetVisible(r.Context(), photoID, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -104,7 +182,47 @@ func (app *application) getPhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = response.JSON(w, http.StatusOK, photo)
+	photos, err := app.data.Photos.GetSimilar(r.Context(), photoID, maxDistance, 20, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, photos)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getNearbyPhotos(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var v validator.Validator
+
+	latitude, err := strconv.ParseFloat(qs.Get("lat"), 64)
+	v.CheckField(err == nil && validator.Between(latitude, -90, 90), "lat", "Must be a number between -90 and 90")
+
+	longitude, err := strconv.ParseFloat(qs.Get("lng"), 64)
+	v.CheckField(err == nil && validator.Between(longitude, -180, 180), "lng", "Must be a number between -180 and 180")
+
+	radius := 5000.0
+	if value := qs.Get("radius"); value != "" {
+		radius, err = strconv.ParseFloat(value, 64)
+		v.CheckField(err == nil && validator.Between(radius, 1, 50000), "radius", "Must be a number of metres between 1 and 50000")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	photos, err := app.data.Photos.GetNearby(r.Context(), latitude, longitude, radius, 50, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, photos)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
@@ -117,7 +235,7 @@ func (app *application) getUserPhotos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	photos, err := app.data.Photos.GetByUserID(user.ID)
+	photos, err := app.data.Photos.GetByUserID(r.Context(), user.ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -131,7 +249,7 @@ func (app *application) getUserPhotos(w http.ResponseWriter, r *http.Request) {
 
 
 func (app *application) getAllPhotos(w http.ResponseWriter, r *http.Request) {
-	photos, err := app.data.Photos.GetAll()
+	photos, err := app.data.Photos.GetAll(r.Context(), app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -142,3 +260,48 @@ func (app *application) getAllPhotos(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, r, err)
 	}
 }
+
+func (app *application) deletePhoto(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	// Moderators can remove any photo, everyone else only their own.
+	ownerID := user.ID
+	if user.IsModerator {
+		photo, err := app.data.Photos.GetByID(r.Context(), photoID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				app.notFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+		ownerID = photo.UserID
+	}
+
+	err = app.data.Photos.Delete(r.Context(), photoID, ownerID, func(photo *data.Photo) error {
+		return app.storage.Remove(r.Context(), strings.TrimPrefix(photo.PhotoURL, "/uploads/"))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"athifirshad.com/bettergram/internal/config"
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/storage"
+	"github.com/google/uuid"
+)
+
+// testImage returns a PNG whose content, and so perceptual hash, depends on
+// pattern.
+func testImage(t *testing.T, pattern int) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			var v uint8
+			switch pattern {
+			case 0:
+				v = uint8(x * 4)
+			case 1:
+				v = uint8(y * 4)
+			default:
+				v = uint8((x ^ y) * 4)
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadPhoto posts photo as a multipart form with the given fields.
+func (ts *testServer) uploadPhoto(t *testing.T, token string, photo []byte, fields map[string]string) testResponse {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for name, value := range fields {
+		err := mw.WriteField(name, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if photo != nil {
+		part, err := mw.CreateFormFile("photo", "photo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(photo)
+	}
+
+	err := mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/photos", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return ts.send(t, req)
+}
+
+func TestUploadPhoto(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+
+	res := ts.uploadPhoto(t, token, testImage(t, 0), map[string]string{
+		"caption":   "Sunset",
+		"alt_text":  "The sun setting over the sea",
+		"latitude":  "51.50735",
+		"longitude": "-0.12776",
+	})
+	checkStatus(t, res, http.StatusCreated)
+
+	var photo photoResponse
+	res.decode(t, &photo)
+
+	if photo.Caption != "Sunset" || photo.Username != "alice" || len(photo.Warnings) != 0 {
+		t.Errorf("got photo %+v", photo)
+	}
+	if photo.Latitude == nil || *photo.Latitude != 51.507 {
+		t.Errorf("got latitude %v; want it rounded to 51.507", photo.Latitude)
+	}
+
+	res = ts.do(t, http.MethodGet, photo.PhotoURL, "", nil)
+	checkStatus(t, res, http.StatusOK)
+
+	t.Run("duplicate", func(t *testing.T) {
+		res := ts.uploadPhoto(t, token, testImage(t, 0), nil)
+		checkStatus(t, res, http.StatusCreated)
+
+		var duplicate photoResponse
+		res.decode(t, &duplicate)
+
+		if len(duplicate.Warnings) != 1 {
+			t.Errorf("got warnings %q; want a duplicate warning", duplicate.Warnings)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			photo  []byte
+			fields map[string]string
+			want   int
+		}{
+			{"no photo", nil, nil, http.StatusBadRequest},
+			{"not an image", []byte("hello"), nil, http.StatusUnsupportedMediaType},
+			{"truncated image", testImage(t, 2)[:100], nil, http.StatusUnsupportedMediaType},
+			{"latitude only", testImage(t, 1), map[string]string{"latitude": "10"}, http.StatusUnprocessableEntity},
+			{"invalid latitude", testImage(t, 1), map[string]string{"latitude": "north", "longitude": "1"}, http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := ts.uploadPhoto(t, token, tt.photo, tt.fields)
+				checkStatus(t, res, tt.want)
+			})
+		}
+	})
+}
+
+// TestUploadPhotoCommitFails checks that no photo is left behind when its
+// file can't be moved into storage.
+func TestUploadPhotoCommitFails(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+
+	photo := testImage(t, 0)
+	hash := sha256.Sum256(photo)
+
+	// A directory in the way of the file makes the rename fail.
+	err := os.MkdirAll(filepath.Join(app.storage.Path(storage.Key(hex.EncodeToString(hash[:]))), "blocker"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := ts.uploadPhoto(t, token, photo, nil)
+	checkStatus(t, res, http.StatusInternalServerError)
+
+	res = ts.do(t, http.MethodGet, "/users/photos", token, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var photos []data.Photo
+	res.decode(t, &photos)
+
+	if len(photos) != 0 {
+		t.Errorf("got %d photos; want none", len(photos))
+	}
+}
+
+// failingMentions is a mention store that can't save mentions.
+type failingMentions struct {
+	data.MentionModelInterface
+}
+
+func (failingMentions) Replace(ctx context.Context, authorID int64, photoID uuid.UUID, commentID *uuid.UUID, mentions []data.Mention) ([]data.Mention, []int64, error) {
+	return nil, nil, errors.New("mentions unavailable")
+}
+
+// TestUploadPhotoMentionsFail checks that a photo is still reported as
+// created when its mentions can't be saved, so that clients don't post it
+// again.
+func TestUploadPhotoMentionsFail(t *testing.T) {
+	app := newTestApplication(t)
+	app.data.Mentions = failingMentions{app.data.Mentions}
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+	ts.register(t, "bob")
+
+	res := ts.uploadPhoto(t, token, testImage(t, 0), map[string]string{"caption": "hi @bob"})
+	checkStatus(t, res, http.StatusCreated)
+
+	res = ts.do(t, http.MethodGet, "/users/photos", token, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var photos []data.Photo
+	res.decode(t, &photos)
+
+	if len(photos) != 1 {
+		t.Errorf("got %d photos; want 1", len(photos))
+	}
+}
+
+func TestUploadPhotoDuplicatesRejected(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Upload.Duplicates = config.DuplicatesReject
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+
+	res := ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	res = ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusConflict)
+
+	// Other users can post the same photo.
+	_, token = ts.register(t, "bob")
+	res = ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusCreated)
+}
+
+func TestUploadBannedPhoto(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+
+	res := ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	var uploaded data.Photo
+	res.decode(t, &uploaded)
+
+	photo, err := app.data.Photos.GetByID(context.Background(), uploaded.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.data.BannedHashes.Insert(context.Background(), &data.BannedHash{Hash: *photo.PHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusUnprocessableEntity)
+}
+
+func TestGetPhoto(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	photo := ts.createPhoto(t, alice, "beach")
+
+	res := ts.do(t, http.MethodGet, "/photos/"+photo.ID.String(), "", nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var got data.Photo
+	res.decode(t, &got)
+
+	if got.ID != photo.ID || got.Username != "alice" || got.Caption != "beach" {
+		t.Errorf("got photo %+v", got)
+	}
+
+	res = ts.do(t, http.MethodGet, "/photos/00000000-0000-0000-0000-000000000000", "", nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	// Private users' photos are hidden from everyone else.
+	res = ts.do(t, http.MethodPatch, "/users/profile", aliceToken, map[string]bool{"is_private": true})
+	checkStatus(t, res, http.StatusOK)
+
+	res = ts.do(t, http.MethodGet, "/photos/"+photo.ID.String(), bobToken, nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	res = ts.do(t, http.MethodGet, "/photos/"+photo.ID.String(), aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	res = ts.do(t, http.MethodGet, "/photos", bobToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var photos []data.Photo
+	res.decode(t, &photos)
+
+	if len(photos) != 0 {
+		t.Errorf("got %d photos; want none", len(photos))
+	}
+}
+
+func TestListPhotos(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	bob, _ := ts.register(t, "bob")
+
+	ts.createPhoto(t, alice, "Mountain lake")
+	ts.createPhoto(t, bob, "Harbour at night")
+	ts.createPhoto(t, bob, "lake shore")
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/photos", []string{"lake shore", "Harbour at night", "Mountain lake"}},
+		{"/users/photos", []string{"Mountain lake"}},
+		{"/photos/search?q=LAKE", []string{"lake shore", "Mountain lake"}},
+		{"/photos/search?q=bob", []string{"lake shore", "Harbour at night"}},
+		{"/photos/search?q=desert", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res := ts.do(t, http.MethodGet, tt.path, aliceToken, nil)
+			checkStatus(t, res, http.StatusOK)
+
+			var photos []data.Photo
+			res.decode(t, &photos)
+
+			var captions []string
+			for _, photo := range photos {
+				captions = append(captions, photo.Caption)
+			}
+
+			if fmt.Sprint(captions) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q; want %q", captions, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNearbyPhotos(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, token := ts.register(t, "alice")
+
+	for _, p := range []struct {
+		caption             string
+		latitude, longitude float64
+	}{
+		{"Trafalgar Square", 51.508, -0.128},
+		{"Tower Bridge", 51.506, -0.075},
+		{"Eiffel Tower", 48.858, 2.294},
+	} {
+		photo := &data.Photo{UserID: alice.ID, PhotoURL: "/uploads/x", Caption: p.caption, Latitude: &p.latitude, Longitude: &p.longitude}
+		err := ts.app.data.Photos.Insert(context.Background(), photo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := ts.do(t, http.MethodGet, "/photos/nearby?lat=51.507&lng=-0.127&radius=10000", token, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var photos []data.Photo
+	res.decode(t, &photos)
+
+	if len(photos) != 2 || photos[0].Caption != "Trafalgar Square" || photos[1].Caption != "Tower Bridge" {
+		t.Errorf("got %+v; want the two London photos, nearest first", photos)
+	}
+
+	res = ts.do(t, http.MethodGet, "/photos/nearby?lat=91&lng=0", token, nil)
+	checkStatus(t, res, http.StatusUnprocessableEntity)
+}
+
+func TestGetSimilarPhotos(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	_, token := ts.register(t, "alice")
+
+	var ids []string
+	for pattern := range 2 {
+		res := ts.uploadPhoto(t, token, testImage(t, pattern), nil)
+		checkStatus(t, res, http.StatusCreated)
+
+		var photo data.Photo
+		res.decode(t, &photo)
+		ids = append(ids, photo.ID.String())
+	}
+
+	res := ts.do(t, http.MethodGet, "/photos/"+ids[0]+"/similar?max_distance=64", token, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var photos []data.Photo
+	res.decode(t, &photos)
+
+	if len(photos) != 1 || photos[0].ID.String() != ids[1] {
+		t.Errorf("got %+v; want only the other photo", photos)
+	}
+
+	res = ts.do(t, http.MethodGet, "/photos/"+ids[0]+"/similar?max_distance=65", token, nil)
+	checkStatus(t, res, http.StatusBadRequest)
+}
+
+func TestUpdatePhoto(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	alice, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	photo := ts.createPhoto(t, alice, "beach")
+	path := "/photos/" + photo.ID.String()
+
+	res := ts.do(t, http.MethodPatch, path, bobToken, map[string]string{"caption": "mine now"})
+	checkStatus(t, res, http.StatusForbidden)
+
+	res = ts.do(t, http.MethodPatch, path, aliceToken, map[string]string{"caption": "beach with @bob"})
+	checkStatus(t, res, http.StatusOK)
+
+	var updated data.Photo
+	res.decode(t, &updated)
+
+	if updated.Caption != "beach with @bob" || len(updated.Mentions) != 1 || updated.Mentions[0].Username != "bob" {
+		t.Errorf("got photo %+v", updated)
+	}
+
+	res = ts.do(t, http.MethodGet, "/notifications", bobToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var notifications struct {
+		Notifications []data.NotificationGroup `json:"notifications"`
+		UnreadCount   int                      `json:"unread_count"`
+	}
+	res.decode(t, &notifications)
+
+	if notifications.UnreadCount != 1 || len(notifications.Notifications) != 1 || notifications.Notifications[0].Type != data.NotificationMention {
+		t.Errorf("got notifications %+v; want one mention", notifications)
+	}
+}
+
+func TestDeletePhoto(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	res := ts.uploadPhoto(t, aliceToken, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	var photo data.Photo
+	res.decode(t, &photo)
+	path := "/photos/" + photo.ID.String()
+
+	res = ts.do(t, http.MethodPost, path+"/like", bobToken, nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	res = ts.do(t, http.MethodDelete, path, bobToken, nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	res = ts.do(t, http.MethodDelete, path, aliceToken, nil)
+	checkStatus(t, res, http.StatusNoContent)
+
+	res = ts.do(t, http.MethodGet, path, aliceToken, nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	res = ts.do(t, http.MethodGet, photo.PhotoURL, "", nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	// The photo's notifications go with it.
+	res = ts.do(t, http.MethodGet, "/notifications/unread-count", aliceToken, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var unread struct {
+		UnreadCount int `json:"unread_count"`
+	}
+	res.decode(t, &unread)
+
+	if unread.UnreadCount != 0 {
+		t.Errorf("got %d unread notifications; want 0", unread.UnreadCount)
+	}
+}
+
+func TestServeUpload(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	_, token := ts.register(t, "alice")
+
+	res := ts.uploadPhoto(t, token, testImage(t, 0), nil)
+	checkStatus(t, res, http.StatusCreated)
+
+	var photo data.Photo
+	res.decode(t, &photo)
+
+	res = ts.do(t, http.MethodGet, photo.PhotoURL, "", nil)
+	checkStatus(t, res, http.StatusOK)
+
+	if got := res.header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("got Content-Type %q; want image/png", got)
+	}
+
+	// Directories and hidden files aren't served.
+	dir := photo.PhotoURL[:strings.LastIndex(photo.PhotoURL, "/")]
+	for _, path := range []string{"/uploads/", dir, dir + "/", "/uploads/.staging/upload-1", "/uploads/../go.mod"} {
+		res := ts.do(t, http.MethodGet, path, "", nil)
+		checkStatus(t, res, http.StatusNotFound)
+	}
+
+	// Once alice is private, her files are only served with her token.
+	res = ts.do(t, http.MethodPatch, "/users/profile", token, map[string]bool{"is_private": true})
+	checkStatus(t, res, http.StatusOK)
+
+	_, bobToken := ts.register(t, "bob")
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"anonymous", photo.PhotoURL, http.StatusNotFound},
+		{"other user", photo.PhotoURL + "?access_token=" + bobToken, http.StatusNotFound},
+		{"owner", photo.PhotoURL + "?access_token=" + token, http.StatusOK},
+		{"invalid token", photo.PhotoURL + "?access_token=" + strings.Repeat("X", 26), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.do(t, http.MethodGet, tt.url, "", nil)
+			checkStatus(t, res, tt.want)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"athifirshad.com/bettergram/internal/config"
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/exif"
+	"athifirshad.com/bettergram/internal/imagehash"
+	"athifirshad.com/bettergram/internal/storage"
+	"athifirshad.com/bettergram/internal/validator"
+)
+
+type createPhotoInput struct {
+	Caption        string
+	AltText        string
+	Latitude       *float64
+	Longitude      *float64
+	PlaceName      string
+	ImportLocation bool
+}
+
+const (
+	maxAltTextRunes   = 1000
+	maxPlaceNameRunes = 200
+)
+
+// readPhotoInput parses the photo fields shared by multipart uploads and tus
+// Upload-Metadata, using get to look up each field by name.
+func readPhotoInput(get func(key string) string) (createPhotoInput, error) {
+	input := createPhotoInput{
+		Caption:   get("caption"),
+		AltText:   get("alt_text"),
+		PlaceName: get("place_name"),
+	}
+
+	for key, dst := range map[string]**float64{"latitude": &input.Latitude, "longitude": &input.Longitude} {
+		value := get(key)
+		if value == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return input, fmt.Errorf("%s must be a number", key)
+		}
+		*dst = &f
+	}
+
+	if value := get("import_location"); value != "" {
+		importLocation, err := strconv.ParseBool(value)
+		if err != nil {
+			return input, errors.New("import_location must be true or false")
+		}
+		input.ImportLocation = importLocation
+	}
+
+	return input, nil
+}
+
+func validatePhotoInput(v *validator.Validator, input createPhotoInput) {
+	validateAltText(v, input.AltText)
+
+	v.Check((input.Latitude == nil) == (input.Longitude == nil), "Latitude and longitude must be provided together")
+	if input.Latitude != nil {
+		v.CheckField(validator.Between(*input.Latitude, -90, 90), "latitude", "Must be between -90 and 90")
+	}
+	if input.Longitude != nil {
+		v.CheckField(validator.Between(*input.Longitude, -180, 180), "longitude", "Must be between -180 and 180")
+	}
+	v.CheckField(validator.MaxRunes(input.PlaceName, maxPlaceNameRunes), "place_name", fmt.Sprintf("Must not be more than %d characters", maxPlaceNameRunes))
+}
+
+func validateAltText(v *validator.Validator, altText string) {
+	v.CheckField(validator.MaxRunes(altText, maxAltTextRunes), "alt_text", fmt.Sprintf("Must not be more than %d characters", maxAltTextRunes))
+}
+
+// photoResponse is returned when a photo is created. Warnings are advisory
+// messages for the uploader that don't prevent the photo from being posted.
+type photoResponse struct {
+	*data.Photo
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// maxImagePixels bounds the memory needed to decode an upload for hashing.
+const maxImagePixels = 50_000_000
+
+var (
+	errDuplicatePhoto   = errors.New("duplicate photo")
+	errBannedPhoto      = errors.New("banned photo")
+	errUnsupportedImage = errors.New("unsupported image")
+	errImageTooLarge    = errors.New("image too large")
+)
+
+// prepareUpload stages an upload, checks it against the banlist and strips
+// identifying metadata from JPEGs, first reading the location into input if
+// the user asked for it to be imported. The returned discard function removes
+// any staged files that haven't been committed.
+func (app *application) prepareUpload(ctx context.Context, src io.Reader, input *createPhotoInput) (*storage.Staged, data.PHash, func(), error) {
+	staged, err := app.storage.Stage(ctx, src)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	discard := func() { app.storage.Discard(staged) }
+
+	fail := func(err error) (*storage.Staged, data.PHash, func(), error) {
+		discard()
+		return nil, 0, nil, err
+	}
+
+	phash, format, err := perceptualHash(staged)
+	if err != nil {
+		return fail(err)
+	}
+
+	_, err = app.data.BannedHashes.Match(ctx, phash, app.config.Moderation.MaxHashDistance)
+	switch {
+	case err == nil:
+		return fail(errBannedPhoto)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return fail(err)
+	}
+
+	if format != "jpeg" {
+		return staged, phash, discard, nil
+	}
+
+	if input.ImportLocation && input.Latitude == nil {
+		metadata, err := readExif(staged)
+		if err != nil {
+			return fail(err)
+		}
+
+		// Coordinates out of range, which some cameras write when they have
+		// no fix, are dropped rather than stored.
+		if metadata.HasGPS && validator.Between(metadata.Latitude, -90, 90) && validator.Between(metadata.Longitude, -180, 180) {
+			input.Latitude = &metadata.Latitude
+			input.Longitude = &metadata.Longitude
+		}
+	}
+
+	stripped, err := app.stripExif(ctx, staged)
+	discard()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return stripped, phash, func() { app.storage.Discard(stripped) }, nil
+}
+
+// storePhoto saves a prepared upload in content-addressed storage and creates
+// a photo for it. Uploads that exactly match a photo the user already posted
+// are handled according to the -duplicate-uploads setting.
+func (app *application) storePhoto(ctx context.Context, user *data.User, src io.Reader, input createPhotoInput) (*photoResponse, error) {
+	staged, phash, discard, err := app.prepareUpload(ctx, src, &input)
+	if err != nil {
+		return nil, err
+	}
+	defer discard()
+
+	var warnings []string
+
+	existing, err := app.data.Photos.GetByUserAndHash(ctx, user.ID, staged.Hash)
+	switch {
+	case err == nil:
+		switch app.config.Upload.Duplicates {
+		case config.DuplicatesReject:
+			return nil, errDuplicatePhoto
+		case config.DuplicatesWarn:
+			warnings = append(warnings, fmt.Sprintf("You have already posted this photo (%s)", existing.ID))
+		}
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	photo := &data.Photo{
+		UserID:      user.ID,
+		Username:    user.Username,
+		PhotoURL:    "/uploads/" + storage.Key(staged.Hash),
+		Caption:     input.Caption,
+		AltText:     input.AltText,
+		PlaceName:   input.PlaceName,
+		ContentHash: staged.Hash,
+		Size:        staged.Size,
+		PHash:       &phash,
+	}
+
+	// Coordinates are only ever stored rounded, so precise locations such
+	// as a user's home never reach the database.
+	if input.Latitude != nil && input.Longitude != nil {
+		latitude := roundCoordinate(*input.Latitude, app.config.Location.Precision)
+		longitude := roundCoordinate(*input.Longitude, app.config.Location.Precision)
+		photo.Latitude = &latitude
+		photo.Longitude = &longitude
+	}
+
+	if user.AltTextReminders && !validator.NotBlank(input.AltText) {
+		warnings = append(warnings, "Add alt text to describe this photo for people using screen readers")
+	}
+
+	err = app.data.Photos.Insert(ctx, photo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.storage.Commit(ctx, staged)
+	if err != nil {
+		// Delete the photo again so that it doesn't point at a file that was
+		// never stored, even if ctx is what made the commit fail. The rename
+		// didn't happen, so there is no file to release.
+		deleteErr := app.data.Photos.Delete(context.WithoutCancel(ctx), photo.ID, user.ID, func(*data.Photo) error {
+			return nil
+		})
+		return nil, errors.Join(err, deleteErr)
+	}
+
+	app.metrics.Photos.Inc()
+	app.metrics.UploadBytes.WithLabelValues("photo").Add(float64(staged.Size))
+
+	return &photoResponse{Photo: photo, Warnings: warnings}, nil
+}
+
+// storePhotoFailed writes the error response for a failed storePhoto call.
+func (app *application) storePhotoFailed(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errDuplicatePhoto):
+		app.errorMessage(w, r, http.StatusConflict, "you have already posted this photo", nil)
+	case errors.Is(err, errBannedPhoto):
+		app.errorMessage(w, r, http.StatusUnprocessableEntity, "this photo has been removed by moderators and can't be posted", nil)
+	case errors.Is(err, errUnsupportedImage):
+		app.errorMessage(w, r, http.StatusUnsupportedMediaType, "photo must be a JPEG, PNG or GIF image", nil)
+	case errors.Is(err, errImageTooLarge):
+		app.errorMessage(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("photo must not have more than %d pixels", maxImagePixels), nil)
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
+// perceptualHash decodes a staged upload and computes its difference hash. It
+// also returns the image format reported by the decoder.
+func perceptualHash(staged *storage.Staged) (data.PHash, string, error) {
+	file, err := staged.Open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, "", errUnsupportedImage
+	}
+
+	if config.Width*config.Height > maxImagePixels {
+		return 0, "", errImageTooLarge
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, "", err
+	}
+
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return 0, "", errUnsupportedImage
+	}
+
+	return data.PHash(imagehash.Difference(img)), format, nil
+}
+
+func readExif(staged *storage.Staged) (*exif.Metadata, error) {
+	file, err := staged.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return exif.Read(file)
+}
+
+// stripExif stages a copy of a JPEG upload without its metadata segments.
+func (app *application) stripExif(ctx context.Context, staged *storage.Staged) (*storage.Staged, error) {
+	file, err := staged.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(exif.Strip(pw, file))
+	}()
+
+	stripped, err := app.storage.Stage(ctx, pr)
+	pr.CloseWithError(err)
+
+	return stripped, err
+}
+
+func roundCoordinate(value float64, precision int) float64 {
+	scale := math.Pow(10, float64(precision))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/request"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (app *application) listReactions(w http.ResponseWriter, r *http.Request) {
+	err := response.JSON(w, http.StatusOK, app.config.Reactions)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readReaction decodes and validates a `{"reaction": string}` request body,
+// writing an error response and returning false if it is invalid.
+func (app *application) readReaction(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Reaction string `json:"reaction"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return "", false
+	}
+
+	var v validator.Validator
+	v.CheckField(validator.In(input.Reaction, app.config.Reactions...), "reaction", "Must be one of "+strings.Join(app.config.Reactions, ", "))
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return "", false
+	}
+
+	return input.Reaction, true
+}
+
+// reactToPhoto sets or changes the user's reaction to a photo.
+func (app *application) reactToPhoto(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	photo, ok := app.readVisiblePhoto(w, r, user)
+	if !ok {
+		return
+	}
+	photoID := photo.ID
+
+	reaction, ok := app.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	like := &data.Like{
+		PhotoID:  photoID,
+		UserID:   user.ID,
+		Reaction: reaction,
+	}
+
+	inserted, err := app.data.Likes.Upsert(r.Context(), like)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if inserted {
+		app.metrics.Likes.Inc()
+	}
+
+	app.backgroundTask(r, func(ctx context.Context) error {
+		err := app.publish(ctx, events.TypeLike, 0, &photoID, like)
+		if err != nil || !inserted {
+			return err
+		}
+
+		return app.notify(ctx, &data.Notification{
+			ActorID: user.ID,
+			Type:    data.NotificationLike,
+			PhotoID: &photoID,
+		})
+	})
+
+	err = response.JSON(w, http.StatusOK, like)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// reactToComment sets or changes the user's reaction to a comment.
+func (app *application) reactToComment(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	commentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	reaction, ok := app.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	commentReaction := &data.CommentReaction{
+		CommentID: commentID,
+		UserID:    user.ID,
+		Reaction:  reaction,
+	}
+
+	_, err = app.data.CommentReactions.Upsert(r.Context(), commentReaction)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, commentReaction)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) removeCommentReaction(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	commentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.CommentReactions.Delete(r.Context(), commentID, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
@@ -14,48 +13,128 @@ func (app *application) routes() http.Handler {
 	mux.NotFound(app.notFound)
 	mux.MethodNotAllowed(app.methodNotAllowed)
 
+	mux.Use(app.requestID)
+	mux.Use(app.traceRequest)
+	mux.Use(app.logRequest)
+	mux.Use(app.instrument)
 	mux.Use(app.recoverPanic)
 	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins:   app.config.HTTP.CORSOrigins,
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum", "traceparent", "tracestate", "X-Request-ID"},
+		ExposedHeaders:   []string{"Link", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           300, 
 	}))
+	mux.Use(app.identifyUser)
+	mux.Use(app.rateLimit("global", app.config.RateLimit.Global))
 	mux.Get("/status", app.status)
 
 	// User routes
-	mux.Post("/users", app.registerUser)
-	mux.Post("/users/login", app.loginUser)
+	mux.With(app.rateLimit("register", app.config.RateLimit.Register)).Post("/users", app.registerUser)
+	mux.With(app.rateLimit("login", app.config.RateLimit.Login)).Post("/users/login", app.loginUser)
 	mux.With(app.authenticateToken).Get("/users/profile", app.getUserProfile)
+	mux.With(app.authenticateToken).Patch("/users/profile", app.updateUserProfile)
+
+	// Follow routes
+	mux.With(app.authenticateToken).Get("/users/suggestions", app.getSuggestions)
+	mux.With(app.authenticateToken).Post("/users/{id}/follow", app.followUser)
+	mux.With(app.authenticateToken).Delete("/users/{id}/follow", app.unfollowUser)
+	mux.With(app.authenticateToken).Get("/users/follow-requests", app.listFollowRequests)
+	mux.With(app.authenticateToken).Post("/users/follow-requests/{id}", app.approveFollowRequest)
+	mux.With(app.authenticateToken).Delete("/users/follow-requests/{id}", app.declineFollowRequest)
+	mux.With(app.authenticateToken).Post("/users/{id}/block", app.blockUser)
+	mux.With(app.authenticateToken).Delete("/users/{id}/block", app.unblockUser)
+
+	// Notification routes
+	mux.With(app.authenticateToken).Get("/notifications", app.listNotifications)
+	mux.With(app.authenticateToken).Get("/notifications/unread-count", app.countUnreadNotifications)
+	mux.With(app.authenticateToken).Post("/notifications/read", app.markNotificationsRead)
+	mux.With(app.authenticateToken).Post("/notifications/{key}/read", app.markNotificationsRead)
 
 	// Photo routes
-	mux.With(app.authenticateToken).Post("/photos", app.uploadPhoto)
-	mux.Get("/photos", app.getAllPhotos)
-	mux.Get("/photos/{id}", app.getPhoto)
+	mux.With(app.authenticateToken, app.rateLimit("upload", app.config.RateLimit.Upload)).Post("/photos", app.uploadPhoto)
+	mux.With(app.authenticateToken).Get("/photos", app.getAllPhotos)
+	mux.With(app.authenticateToken).Get("/photos/{id}", app.getPhoto)
+	mux.With(app.authenticateToken).Patch("/photos/{id}", app.updatePhoto)
+	mux.With(app.authenticateToken).Delete("/photos/{id}", app.deletePhoto)
+	mux.With(app.authenticateToken).Get("/photos/{id}/similar", app.getSimilarPhotos)
 	mux.With(app.authenticateToken).Get("/users/photos", app.getUserPhotos)
-	mux.Get("/photos/search", app.searchPhotos)
+	mux.With(app.authenticateToken).Get("/photos/search", app.searchPhotos)
+	mux.With(app.authenticateToken).Get("/photos/nearby", app.getNearbyPhotos)
+	mux.With(app.authenticateToken).Get("/explore", app.getExplore)
+
+	// Resumable upload routes
+	mux.Options("/photos/uploads", app.uploadOptions)
+	mux.With(app.authenticateToken, app.rateLimit("upload", app.config.RateLimit.Upload)).Post("/photos/uploads", app.createUpload)
+	mux.With(app.authenticateToken).Head("/photos/uploads/{id}", app.getUploadOffset)
+	mux.With(app.authenticateToken).Patch("/photos/uploads/{id}", app.patchUpload)
+	mux.With(app.authenticateToken).Delete("/photos/uploads/{id}", app.deleteUpload)
 
 	// Token routes
-	mux.Post("/tokens", app.createAuthenticationTokenHandler)
+	mux.With(app.rateLimit("login", app.config.RateLimit.Login)).Post("/tokens", app.createAuthenticationTokenHandler)
 
 	// Like routes
 	mux.With(app.authenticateToken).Post("/photos/{id}/like", app.likePhoto)
 	mux.With(app.authenticateToken).Delete("/photos/{id}/like", app.unlikePhoto)
 
+	// Reaction routes
+	mux.Get("/reactions", app.listReactions)
+	mux.With(app.authenticateToken).Put("/photos/{id}/reaction", app.reactToPhoto)
+	mux.With(app.authenticateToken).Delete("/photos/{id}/reaction", app.unlikePhoto)
+	mux.With(app.authenticateToken).Put("/comments/{id}/reaction", app.reactToComment)
+	mux.With(app.authenticateToken).Delete("/comments/{id}/reaction", app.removeCommentReaction)
+
 	// Comment routes
 	mux.With(app.authenticateToken).Post("/photos/{id}/comments", app.addComment)
-	mux.Get("/photos/{id}/comments", app.getPhotoComments)
+	mux.With(app.authenticateToken).Get("/photos/{id}/comments", app.getPhotoComments)
+	mux.With(app.authenticateToken).Put("/photos/{id}/pinned-comment/{commentID}", app.pinComment)
+	mux.With(app.authenticateToken).Delete("/photos/{id}/pinned-comment", app.unpinComment)
+	mux.With(app.authenticateToken).Post("/comments/{id}/like", app.likeComment)
+	mux.With(app.authenticateToken).Delete("/comments/{id}/like", app.removeCommentReaction)
+
+	// Saved photo and collection routes
+	mux.With(app.authenticateToken).Post("/photos/{id}/save", app.savePhoto)
+	mux.With(app.authenticateToken).Delete("/photos/{id}/save", app.unsavePhoto)
+	mux.With(app.authenticateToken).Get("/users/me/saved", app.getSavedPhotos)
+	mux.With(app.authenticateToken).Get("/users/me/collections", app.listCollections)
+	mux.With(app.authenticateToken).Post("/users/me/collections", app.createCollection)
+	mux.With(app.authenticateToken).Get("/users/me/collections/{id}", app.getCollection)
+	mux.With(app.authenticateToken).Patch("/users/me/collections/{id}", app.updateCollection)
+	mux.With(app.authenticateToken).Delete("/users/me/collections/{id}", app.deleteCollection)
+
+	// Story routes
+	mux.With(app.authenticateToken, app.rateLimit("upload", app.config.RateLimit.Upload)).Post("/stories", app.createStory)
+	mux.With(app.authenticateToken).Get("/stories/feed", app.getStoryFeed)
+	mux.With(app.authenticateToken).Delete("/stories/{id}", app.deleteStory)
+	mux.With(app.authenticateToken).Post("/stories/{id}/views", app.viewStory)
+	mux.With(app.authenticateToken).Get("/stories/{id}/viewers", app.getStoryViewers)
 
+	// Direct message routes
+	mux.With(app.authenticateToken).Get("/conversations", app.listConversations)
+	mux.With(app.authenticateToken).Post("/conversations", app.createConversation)
+	mux.With(app.authenticateToken).Get("/conversations/{id}/messages", app.getConversationMessages)
+	mux.With(app.authenticateToken).Post("/conversations/{id}/messages", app.sendMessage)
+	mux.With(app.authenticateToken).Post("/conversations/{id}/read", app.markConversationRead)
+
+	// Event stream
+	mux.With(app.tokenFromQuery, app.authenticateToken).Get("/events", app.streamEvents)
+
+	// Moderation routes
+	mux.With(app.authenticateToken).Get("/moderation/banned-hashes", app.requireModerator(app.listBannedHashes))
+	mux.With(app.authenticateToken).Post("/moderation/banned-hashes", app.requireModerator(app.banHash))
+	mux.With(app.authenticateToken).Delete("/moderation/banned-hashes/{id}", app.requireModerator(app.unbanHash))
 
 	// Serve uploaded photos
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "/uploads"
-	}
-	fileServer := http.FileServer(http.Dir(uploadDir))
-	mux.Handle("/uploads/*", http.StripPrefix("/uploads/", fileServer))
+	mux.With(app.tokenFromQuery, app.authenticateToken).Get("/uploads/*", app.serveUpload)
+
+	return mux
+}
 
+// metricsRoutes serves the Prometheus metrics on their own listener, so that
+// they can be scraped without being exposed alongside the API.
+func (app *application) metricsRoutes() http.Handler {
+	mux := chi.NewRouter()
+	mux.Handle("/metrics", app.metrics.Handler())
 	return mux
 }
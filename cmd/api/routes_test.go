@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/ratelimit"
+	"github.com/go-chi/chi/v5"
+)
+
+// TestRoutes sends a request to every route, with and without a token. The
+// routes backed by models that only exist in Postgres are checked up to the
+// point where they would query the database.
+func TestRoutes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	_, token := ts.register(t, "alice")
+
+	tests := []struct {
+		method string
+		route  string
+		path   string
+		body   any
+		anon   int
+		authed int
+	}{
+		{"GET", "/status", "/status", nil, 200, 200},
+
+		{"POST", "/users", "/users", nil, 400, 400},
+		{"POST", "/users/login", "/users/login", nil, 400, 400},
+		{"GET", "/users/profile", "/users/profile", nil, 200, 200},
+		{"PATCH", "/users/profile", "/users/profile", map[string]bool{"is_private": false}, 401, 200},
+		{"POST", "/tokens", "/tokens", nil, 400, 400},
+
+		{"GET", "/users/suggestions", "/users/suggestions?limit=0", nil, 401, 422},
+		{"POST", "/users/{id}/follow", "/users/x/follow", nil, 401, 404},
+		{"DELETE", "/users/{id}/follow", "/users/x/follow", nil, 401, 404},
+		{"GET", "/users/follow-requests", "/users/follow-requests", nil, 401, 0},
+		{"POST", "/users/follow-requests/{id}", "/users/follow-requests/x", nil, 401, 404},
+		{"DELETE", "/users/follow-requests/{id}", "/users/follow-requests/x", nil, 401, 404},
+		{"POST", "/users/{id}/block", "/users/x/block", nil, 401, 404},
+		{"DELETE", "/users/{id}/block", "/users/x/block", nil, 401, 404},
+
+		{"GET", "/notifications", "/notifications", nil, 401, 200},
+		{"GET", "/notifications/unread-count", "/notifications/unread-count", nil, 401, 200},
+		{"POST", "/notifications/read", "/notifications/read", nil, 401, 204},
+		{"POST", "/notifications/{key}/read", "/notifications/like:x/read", nil, 401, 204},
+
+		{"POST", "/photos", "/photos", nil, 401, 400},
+		{"GET", "/photos", "/photos", nil, 200, 200},
+		{"GET", "/photos/{id}", "/photos/x", nil, 404, 404},
+		{"PATCH", "/photos/{id}", "/photos/x", nil, 401, 404},
+		{"DELETE", "/photos/{id}", "/photos/x", nil, 401, 404},
+		{"GET", "/photos/{id}/similar", "/photos/x/similar", nil, 404, 404},
+		{"GET", "/users/photos", "/users/photos", nil, 401, 200},
+		{"GET", "/photos/search", "/photos/search", nil, 400, 400},
+		{"GET", "/photos/nearby", "/photos/nearby", nil, 422, 422},
+		{"GET", "/explore", "/explore?generation=0", nil, 422, 422},
+
+		{"OPTIONS", "/photos/uploads", "/photos/uploads", nil, 204, 204},
+		{"POST", "/photos/uploads", "/photos/uploads", nil, 401, 412},
+		{"HEAD", "/photos/uploads/{id}", "/photos/uploads/x", nil, 401, 412},
+		{"PATCH", "/photos/uploads/{id}", "/photos/uploads/x", nil, 401, 412},
+		{"DELETE", "/photos/uploads/{id}", "/photos/uploads/x", nil, 401, 412},
+
+		{"POST", "/photos/{id}/like", "/photos/x/like", nil, 401, 404},
+		{"DELETE", "/photos/{id}/like", "/photos/x/like", nil, 401, 404},
+
+		{"GET", "/reactions", "/reactions", nil, 200, 200},
+		{"PUT", "/photos/{id}/reaction", "/photos/x/reaction", nil, 401, 404},
+		{"DELETE", "/photos/{id}/reaction", "/photos/x/reaction", nil, 401, 404},
+		{"PUT", "/comments/{id}/reaction", "/comments/x/reaction", nil, 401, 404},
+		{"DELETE", "/comments/{id}/reaction", "/comments/x/reaction", nil, 401, 404},
+
+		{"POST", "/photos/{id}/comments", "/photos/x/comments", nil, 401, 404},
+		{"GET", "/photos/{id}/comments", "/photos/x/comments", nil, 404, 404},
+		{"PUT", "/photos/{id}/pinned-comment/{commentID}", "/photos/x/pinned-comment/x", nil, 401, 404},
+		{"DELETE", "/photos/{id}/pinned-comment", "/photos/x/pinned-comment", nil, 401, 404},
+		{"POST", "/comments/{id}/like", "/comments/x/like", nil, 401, 404},
+		{"DELETE", "/comments/{id}/like", "/comments/x/like", nil, 401, 404},
+
+		{"POST", "/photos/{id}/save", "/photos/x/save", nil, 401, 404},
+		{"DELETE", "/photos/{id}/save", "/photos/x/save", nil, 401, 404},
+		{"GET", "/users/me/saved", "/users/me/saved?page=0", nil, 401, 422},
+		{"GET", "/users/me/collections", "/users/me/collections", nil, 401, 0},
+		{"POST", "/users/me/collections", "/users/me/collections", nil, 401, 400},
+		{"GET", "/users/me/collections/{id}", "/users/me/collections/x", nil, 401, 404},
+		{"PATCH", "/users/me/collections/{id}", "/users/me/collections/x", nil, 401, 404},
+		{"DELETE", "/users/me/collections/{id}", "/users/me/collections/x", nil, 401, 404},
+
+		{"POST", "/stories", "/stories", nil, 401, 400},
+		{"GET", "/stories/feed", "/stories/feed", nil, 401, 0},
+		{"DELETE", "/stories/{id}", "/stories/x", nil, 401, 404},
+		{"POST", "/stories/{id}/views", "/stories/x/views", nil, 401, 404},
+		{"GET", "/stories/{id}/viewers", "/stories/x/viewers", nil, 401, 404},
+
+		{"GET", "/conversations", "/conversations?page=0", nil, 401, 422},
+		{"POST", "/conversations", "/conversations", nil, 401, 400},
+		{"GET", "/conversations/{id}/messages", "/conversations/x/messages", nil, 401, 404},
+		{"POST", "/conversations/{id}/messages", "/conversations/x/messages", nil, 401, 404},
+		{"POST", "/conversations/{id}/read", "/conversations/x/read", nil, 401, 404},
+
+		{"GET", "/events", "/events?photo_id=x", nil, 401, 422},
+
+		{"GET", "/moderation/banned-hashes", "/moderation/banned-hashes", nil, 401, 403},
+		{"POST", "/moderation/banned-hashes", "/moderation/banned-hashes", nil, 401, 403},
+		{"DELETE", "/moderation/banned-hashes/{id}", "/moderation/banned-hashes/x", nil, 401, 403},
+
+		{"GET", "/uploads/*", "/uploads/missing", nil, 404, 404},
+	}
+
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		tested[tt.method+" "+tt.route] = true
+
+		t.Run(tt.method+" "+tt.route, func(t *testing.T) {
+			res := ts.do(t, tt.method, tt.path, "", tt.body)
+			checkStatus(t, res, tt.anon)
+
+			// A status of 0 marks routes that query Postgres as soon as
+			// the user is known.
+			if tt.authed != 0 {
+				res = ts.do(t, tt.method, tt.path, token, tt.body)
+				checkStatus(t, res, tt.authed)
+			}
+		})
+	}
+
+	chi.Walk(app.routes().(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !tested[method+" "+route] {
+			t.Errorf("%s %s is not tested", method, route)
+		}
+		return nil
+	})
+}
+
+// TestMetrics checks that metrics are only served by the separate metrics
+// listener.
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.do(t, http.MethodGet, "/metrics", "", nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	rec := httptest.NewRecorder()
+	app.metricsRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "bettergram_http_requests_total") {
+		t.Errorf("got status %d and body %.100q; want the metrics", rec.Code, rec.Body.String())
+	}
+
+	// Made-up methods share one series instead of adding one each.
+	for _, method := range []string{"BREW", "WHEN", "PROPFIND"} {
+		ts.do(t, method, "/status", "", nil)
+	}
+
+	rec = httptest.NewRecorder()
+	app.metricsRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if strings.Contains(rec.Body.String(), `method="BREW"`) || !strings.Contains(rec.Body.String(), `method="OTHER"`) {
+		t.Error("made-up methods were not reported as OTHER")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	res := ts.do(t, http.MethodGet, "/nowhere", "", nil)
+	checkStatus(t, res, http.StatusNotFound)
+
+	res = ts.do(t, http.MethodPut, "/status", "", nil)
+	checkStatus(t, res, http.StatusMethodNotAllowed)
+}
+
+func TestRequestID(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/nowhere", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "test-request")
+
+	res := ts.send(t, req)
+	checkStatus(t, res, http.StatusNotFound)
+
+	if got := res.header.Get("X-Request-ID"); got != "test-request" {
+		t.Errorf("got X-Request-ID %q; want %q", got, "test-request")
+	}
+
+	var body struct {
+		RequestID string
+	}
+	res.decode(t, &body)
+
+	if body.RequestID != "test-request" {
+		t.Errorf("got request ID %q in body; want %q", body.RequestID, "test-request")
+	}
+}
+
+// countingUsers counts the token lookups made against a user store.
+type countingUsers struct {
+	data.UserModelInterface
+	lookups atomic.Int64
+}
+
+func (u *countingUsers) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*data.User, error) {
+	u.lookups.Add(1)
+	return u.UserModelInterface.GetForToken(ctx, tokenScope, tokenPlaintext)
+}
+
+func TestInvalidToken(t *testing.T) {
+	app := newTestApplication(t)
+	users := &countingUsers{UserModelInterface: app.data.Users}
+	app.data.Users = users
+	ts := newTestServer(t, app)
+
+	for _, header := range []string{"Bearer nonsense", "Basic abc", "Bearer"} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/users/photos", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", header)
+
+		res := ts.send(t, req)
+		checkStatus(t, res, http.StatusUnauthorized)
+	}
+
+	// identifyUser's lookup of the invalid token is reused.
+	if n := users.lookups.Load(); n != 1 {
+		t.Errorf("got %d token lookups; want 1", n)
+	}
+}
+
+// TestGlobalRateLimit checks that the global limit keeps a bucket per user for
+// authenticated requests, so users sharing an IP don't share a limit.
+func TestGlobalRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.RateLimit.Enabled = true
+	app.config.RateLimit.Global = ratelimit.Limit{Requests: 5, Period: time.Hour}
+	app.limiter = ratelimit.NewMemory()
+
+	ts := newTestServer(t, app)
+
+	// Registering and logging in both users uses 4 of the IP's 5 requests.
+	_, aliceToken := ts.register(t, "alice")
+	_, bobToken := ts.register(t, "bob")
+
+	res := ts.do(t, http.MethodGet, "/status", "", nil)
+	checkStatus(t, res, http.StatusOK)
+
+	res = ts.do(t, http.MethodGet, "/status", "", nil)
+	checkStatus(t, res, http.StatusTooManyRequests)
+
+	for _, token := range []string{aliceToken, bobToken} {
+		res = ts.do(t, http.MethodGet, "/status", token, nil)
+		checkStatus(t, res, http.StatusOK)
+
+		if got := res.header.Get("RateLimit-Remaining"); got != "4" {
+			t.Errorf("got RateLimit-Remaining %q; want 4", got)
+		}
+	}
+}
+
+func TestTokenFromQuery(t *testing.T) {
+	app := newTestApplication(t)
+
+	var header, query string
+	handler := app.tokenFromQuery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Authorization")
+		query = r.URL.String()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events?photo_id=x&access_token=secret", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if header != "Bearer secret" {
+		t.Errorf("got Authorization %q; want the token from the query", header)
+	}
+	if query != "/events?photo_id=x" {
+		t.Errorf("got URL %q; want the token removed", query)
+	}
+}
+
+func TestCanceledQuery(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name  string
+		cause error
+		want  int
+	}{
+		{"client disconnected", context.Canceled, statusClientClosedRequest},
+		{"shutting down", errShuttingDown, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			cancel(tt.cause)
+
+			req := httptest.NewRequest(http.MethodGet, "/photos", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			app.serverError(rec, req, ctx.Err())
+
+			if rec.Code != tt.want {
+				t.Errorf("got status %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
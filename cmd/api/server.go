@@ -5,43 +5,90 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
-const (
-	defaultIdleTimeout    = time.Minute
-	defaultReadTimeout    = 5 * time.Second
-	defaultWriteTimeout   = 10 * time.Second
-	defaultShutdownPeriod = 30 * time.Second
-)
+// errShuttingDown is the cause given to the contexts of requests canceled
+// because the server is shutting down.
+var errShuttingDown = errors.New("server shutting down")
 
 func (app *application) serveHTTP() error {
+	// Requests still running when the shutdown period ends are canceled
+	// through their context, so their queries don't hold up the exit.
+	requestsCtx, cancelRequests := context.WithCancelCause(context.Background())
+	defer cancelRequests(errShuttingDown)
+
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.httpPort),
+		Addr:         fmt.Sprintf(":%d", app.config.HTTP.Port),
 		Handler:      app.routes(),
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelWarn),
-		IdleTimeout:  defaultIdleTimeout,
-		ReadTimeout:  defaultReadTimeout,
-		WriteTimeout: defaultWriteTimeout,
+		IdleTimeout:  app.config.HTTP.IdleTimeout,
+		ReadTimeout:  app.config.HTTP.ReadTimeout,
+		WriteTimeout: app.config.HTTP.WriteTimeout,
+		BaseContext:  func(net.Listener) context.Context { return requestsCtx },
+	}
+
+	var metricsSrv *http.Server
+	if app.config.HTTP.MetricsPort != 0 {
+		metricsSrv = &http.Server{
+			Addr:         fmt.Sprintf(":%d", app.config.HTTP.MetricsPort),
+			Handler:      app.metricsRoutes(),
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelWarn),
+			IdleTimeout:  app.config.HTTP.IdleTimeout,
+			ReadTimeout:  app.config.HTTP.ReadTimeout,
+			WriteTimeout: app.config.HTTP.WriteTimeout,
+		}
+
+		// Listening before the API starts means a port that is already in
+		// use stops the server rather than leaving it running unmonitored.
+		ln, err := net.Listen("tcp", metricsSrv.Addr)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			err := metricsSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+
+		app.logger.Info("serving metrics", slog.Group("server", "addr", metricsSrv.Addr))
 	}
 
 	shutdownErrorChan := make(chan error)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
 	go func() {
 		quitChan := make(chan os.Signal, 1)
 		signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
 		<-quitChan
 
-		ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownPeriod)
+		stopJobs()
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.HTTP.ShutdownPeriod)
 		defer cancel()
 
-		shutdownErrorChan <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			cancelRequests(errShuttingDown)
+		}
+
+		if metricsSrv != nil {
+			metricsSrv.Close()
+		}
+
+		shutdownErrorChan <- err
 	}()
 
+	app.startJobs(jobsCtx)
+
 	app.logger.Info("starting server", slog.Group("server", "addr", srv.Addr))
 
 	err := srv.ListenAndServe()
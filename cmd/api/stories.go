@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/storage"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// createStory posts a photo as a story. Uploads go through the same banlist
+// check, metadata stripping and content-addressed storage as photos.
+func (app *application) createStory(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	if !app.parsePhotoForm(w, r) {
+		return
+	}
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	input := createPhotoInput{
+		Caption: r.FormValue("caption"),
+		AltText: r.FormValue("alt_text"),
+	}
+
+	var v validator.Validator
+	validateAltText(&v, input.AltText)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	staged, _, discard, err := app.prepareUpload(r.Context(), file, &input)
+	if err != nil {
+		app.storePhotoFailed(w, r, err)
+		return
+	}
+	defer discard()
+
+	story := &data.Story{
+		UserID:      user.ID,
+		Username:    user.Username,
+		PhotoURL:    "/uploads/" + storage.Key(staged.Hash),
+		Caption:     input.Caption,
+		AltText:     input.AltText,
+		ContentHash: staged.Hash,
+		Size:        staged.Size,
+		ExpiresAt:   time.Now().Add(app.config.Stories.TTL),
+	}
+
+	err = app.data.Stories.Insert(r.Context(), story)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.storage.Commit(r.Context(), staged)
+	if err != nil {
+		// As in storePhoto, the story is deleted again so that it doesn't
+		// point at a file that was never stored.
+		ctx := context.WithoutCancel(r.Context())
+		deleteErr := app.data.Stories.Delete(ctx, story.ID, user.ID, func(string) error { return nil })
+		app.serverError(w, r, errors.Join(err, deleteErr))
+		return
+	}
+
+	app.metrics.UploadBytes.WithLabelValues("story").Add(float64(staged.Size))
+
+	err = response.JSON(w, http.StatusCreated, story)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getStoryFeed(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	feed, err := app.data.Stories.GetFeed(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, feed)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readStory loads the unexpired story in the URL if the user is allowed to
+// see it, writing an error response and returning false otherwise.
+func (app *application) readStory(w http.ResponseWriter, r *http.Request, user *data.User) (*data.Story, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	story, err := app.data.Stories.GetByID(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return story, true
+}
+
+// viewStory records that the user has seen a story. Owners viewing their own
+// stories aren't counted.
+func (app *application) viewStory(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	story, ok := app.readStory(w, r, user)
+	if !ok {
+		return
+	}
+
+	if story.UserID != user.ID {
+		err := app.data.Stories.AddView(r.Context(), story.ID, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getStoryViewers(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	story, ok := app.readStory(w, r, user)
+	if !ok {
+		return
+	}
+
+	if story.UserID != user.ID {
+		app.notPermitted(w, r)
+		return
+	}
+
+	viewers, err := app.data.Stories.GetViewers(r.Context(), story.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, viewers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deleteStory(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.data.Stories.Delete(r.Context(), id, user.ID, app.releaseBlob(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expireStories deletes stories past their expiry along with any files no
+// longer in use.
+func (app *application) expireStories(ctx context.Context) error {
+	count, err := app.data.Stories.DeleteExpired(ctx, app.releaseBlob(ctx))
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		app.logger.InfoContext(ctx, "expired stories", "count", count)
+	}
+
+	return nil
+}
+
+// releaseBlob returns a function that removes the file of a blob that is no
+// longer referenced.
+func (app *application) releaseBlob(ctx context.Context) func(contentHash string) error {
+	return func(contentHash string) error {
+		return app.storage.Remove(ctx, storage.Key(contentHash))
+	}
+}
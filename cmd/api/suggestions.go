@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+)
+
+// getSuggestions recommends accounts for the user to follow. Suggestions are
+// normally served from the precomputed set, which is computed on the spot
+// the first time a user asks for them.
+func (app *application) getSuggestions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	limit := 20
+
+	var v validator.Validator
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		v.CheckField(err == nil && validator.Between(limit, 1, 50), "limit", "Must be a number between 1 and 50")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	suggestions, computed, err := app.data.Suggestions.Get(r.Context(), user.ID, limit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !computed {
+		err = app.data.Suggestions.Refresh(r.Context(), user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		suggestions, _, err = app.data.Suggestions.Get(r.Context(), user.ID, limit)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = response.JSON(w, http.StatusOK, suggestions)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// refreshSuggestions recomputes suggestions that are older than the TTL.
+func (app *application) refreshSuggestions(ctx context.Context) error {
+	count, err := app.data.Suggestions.RefreshStale(ctx, app.config.Suggestions.TTL, app.config.Suggestions.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		app.logger.DebugContext(ctx, "refreshed suggestions", "users", count)
+	}
+
+	return nil
+}
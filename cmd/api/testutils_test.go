@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"athifirshad.com/bettergram/internal/config"
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/events"
+	"athifirshad.com/bettergram/internal/metrics"
+	"athifirshad.com/bettergram/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	data.BcryptCost = bcrypt.MinCost
+}
+
+// newTestApplication returns an application backed by the in-memory models,
+// with uploads stored in a temporary directory and rate limiting turned off.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.RateLimit.Enabled = false
+	cfg.Upload.Dir = t.TempDir()
+	cfg.Upload.StagingDir = t.TempDir()
+	cfg.Upload.PartialDir = t.TempDir()
+
+	store, err := storage.New(cfg.Upload.Dir, cfg.Upload.StagingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return &application{
+		config:  cfg,
+		logger:  logger,
+		storage: store,
+		events:  events.New(nil, logger),
+		metrics: metrics.New(nil),
+		data:    data.NewMemoryModels(),
+	}
+}
+
+type testServer struct {
+	*httptest.Server
+	app *application
+}
+
+func newTestServer(t *testing.T, app *application) *testServer {
+	t.Helper()
+
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		ts.Close()
+		app.wg.Wait()
+	})
+
+	return &testServer{Server: ts, app: app}
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// decode unmarshals the response body into v, failing the test if it isn't
+// valid JSON.
+func (res testResponse) decode(t *testing.T, v any) {
+	t.Helper()
+
+	err := json.Unmarshal(res.body, v)
+	if err != nil {
+		t.Fatalf("decoding %q: %s", res.body, err)
+	}
+}
+
+// do sends a request with body, which is encoded as JSON unless it is an
+// io.Reader, authenticated with token if it isn't empty. It waits for any
+// background tasks the request started before returning.
+func (ts *testServer) do(t *testing.T, method, path, token string, body any) testResponse {
+	t.Helper()
+
+	var r io.Reader
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		r = body
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return ts.send(t, req)
+}
+
+func (ts *testServer) send(t *testing.T, req *http.Request) testResponse {
+	t.Helper()
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.app.wg.Wait()
+
+	return testResponse{status: res.StatusCode, header: res.Header, body: body}
+}
+
+// register creates a user through the API and returns an authentication
+// token for them.
+func (ts *testServer) register(t *testing.T, username string) (*data.User, string) {
+	t.Helper()
+
+	email := username + "@example.com"
+
+	res := ts.do(t, http.MethodPost, "/users", "", map[string]string{
+		"username": username,
+		"email":    email,
+		"password": "pa55word",
+	})
+	if res.status != http.StatusCreated {
+		t.Fatalf("registering %s: got status %d: %s", username, res.status, res.body)
+	}
+
+	var user data.User
+	res.decode(t, &user)
+
+	res = ts.do(t, http.MethodPost, "/users/login", "", map[string]string{
+		"email":    email,
+		"password": "pa55word",
+	})
+	if res.status != http.StatusOK {
+		t.Fatalf("logging in %s: got status %d: %s", username, res.status, res.body)
+	}
+
+	var token struct {
+		Token string `json:"authentication_token"`
+	}
+	res.decode(t, &token)
+
+	return &user, token.Token
+}
+
+// createPhoto adds a photo for user directly through the models.
+func (ts *testServer) createPhoto(t *testing.T, user *data.User, caption string) *data.Photo {
+	t.Helper()
+
+	photo := &data.Photo{
+		UserID:   user.ID,
+		PhotoURL: "/uploads/" + caption,
+		Caption:  caption,
+	}
+
+	err := ts.app.data.Photos.Insert(context.Background(), photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return photo
+}
+
+func checkStatus(t *testing.T, res testResponse, want int) {
+	t.Helper()
+
+	if res.status != want {
+		t.Fatalf("got status %d; want %d: %s", res.status, want, res.body)
+	}
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"errors"
 	"net/http"
-	"time"
 
 	"athifirshad.com/bettergram/internal/data"
 	"athifirshad.com/bettergram/internal/request"
@@ -22,29 +20,12 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.data.Users.GetByEmail(input.Email)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			response.InvalidCredentials(w, r)
-		default:
-			app.serverError(w, r, err)
-		}
-		return
-	}
-
-	match, err := user.Password.Matches(input.Password)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	if !match {
-		response.InvalidCredentials(w, r)
+	user, ok := app.authenticateCredentials(w, r, input.Email, input.Password)
+	if !ok {
 		return
 	}
 
-	token, err := app.data.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	token, err := app.data.Tokens.New(r.Context(), user.ID, app.config.Auth.TokenTTL, data.ScopeAuthentication)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/response"
+	"athifirshad.com/bettergram/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// The resumable upload endpoints implement the core of the tus 1.0.0 protocol
+// (https://tus.io/protocols/resumable-upload) together with the creation,
+// checksum, termination and expiration extensions.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,checksum,termination,expiration"
+
+	statusChecksumMismatch = 460
+)
+
+func (app *application) uploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", "sha256")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.config.Upload.MaxSize, 10))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) createUpload(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	if !app.checkTusResumable(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		app.badRequest(w, r, errors.New("Upload-Length header must be a positive integer"))
+		return
+	}
+
+	if length > app.config.Upload.MaxSize {
+		message := fmt.Sprintf("upload must not be larger than %d bytes", app.config.Upload.MaxSize)
+		app.errorMessage(w, r, http.StatusRequestEntityTooLarge, message, nil)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input, err := readPhotoInput(func(key string) string { return metadata[key] })
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+	validatePhotoInput(&v, input)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	upload := &data.Upload{
+		UserID:         user.ID,
+		Filename:       filepath.Base(metadata["filename"]),
+		Caption:        input.Caption,
+		AltText:        input.AltText,
+		Latitude:       input.Latitude,
+		Longitude:      input.Longitude,
+		PlaceName:      input.PlaceName,
+		ImportLocation: input.ImportLocation,
+		Length:         length,
+		ExpiresAt:      time.Now().Add(app.config.Upload.SessionTTL),
+	}
+
+	if checksum, ok := metadata["checksum"]; ok {
+		upload.Checksum, err = parseChecksum(checksum)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+	}
+
+	err = os.MkdirAll(app.config.Upload.PartialDir, os.ModePerm)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.data.Uploads.Insert(r.Context(), upload)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	file, err := os.Create(app.partialUploadPath(upload.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	file.Close()
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Location", fmt.Sprintf("%s/photos/uploads/%s", app.config.BaseURL, upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	err = response.JSON(w, http.StatusCreated, upload)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getUploadOffset(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) patchUpload(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		app.errorMessage(w, r, http.StatusUnsupportedMediaType, "content type must be application/offset+octet-stream", nil)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.badRequest(w, r, errors.New("Upload-Offset header must be a non-negative integer"))
+		return
+	}
+
+	var chunkChecksum []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		algorithm, value, _ := strings.Cut(header, " ")
+		if algorithm != "sha256" {
+			app.badRequest(w, r, fmt.Errorf("unsupported checksum algorithm %q", algorithm))
+			return
+		}
+
+		chunkChecksum, err = base64.StdEncoding.DecodeString(value)
+		if err != nil || len(chunkChecksum) != sha256.Size {
+			app.badRequest(w, r, errors.New("Upload-Checksum header contains an invalid sha256 checksum"))
+			return
+		}
+	}
+
+	// Chunks can be large and arrive over slow connections, so they get their
+	// own deadline instead of the server-wide read and write timeouts.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.config.Upload.ChunkTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+
+	file, err := os.OpenFile(app.partialUploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	// Chunks for the same session would write over each other, so the
+	// partial file stays locked until the offset has been updated, and the
+	// session is read again once the lock is held.
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			app.errorMessage(w, r, http.StatusLocked, "another request is writing to this upload", nil)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	upload, err = app.data.Uploads.Get(r.Context(), upload.ID, upload.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if offset != upload.Offset {
+		app.errorMessage(w, r, http.StatusConflict, "upload offset does not match the current offset of the upload", nil)
+		return
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	hash := sha256.New()
+	body := io.LimitReader(r.Body, upload.Length-offset+1)
+
+	written, copyErr := io.Copy(io.MultiWriter(file, hash), body)
+	if offset+written > upload.Length {
+		app.errorMessage(w, r, http.StatusRequestEntityTooLarge, "chunk exceeds the declared upload length", nil)
+		return
+	}
+
+	if chunkChecksum != nil {
+		if copyErr != nil {
+			app.badRequest(w, r, copyErr)
+			return
+		}
+
+		if !bytes.Equal(hash.Sum(nil), chunkChecksum) {
+			app.errorMessage(w, r, statusChecksumMismatch, "chunk checksum does not match", nil)
+			return
+		}
+	}
+
+	// Without a checksum, whatever was received before a disconnect is kept
+	// so the client can resume from the new offset.
+	err = app.data.Uploads.UpdateOffset(r.Context(), upload, offset+written, time.Now().Add(app.config.Upload.SessionTTL))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.errorMessage(w, r, http.StatusConflict, "upload offset does not match the current offset of the upload", nil)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if copyErr != nil {
+		app.badRequest(w, r, copyErr)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if !upload.Complete() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	photo, err := app.finalizeUpload(r.Context(), upload)
+	if err != nil {
+		switch {
+		case errors.Is(err, errChecksumMismatch):
+			app.errorMessage(w, r, statusChecksumMismatch, "upload checksum does not match", nil)
+		default:
+			app.storePhotoFailed(w, r, err)
+		}
+		return
+	}
+
+	photo.Mentions = app.saveMentions(r, app.contextGetUser(r), photo.ID, nil, photo.Caption)
+
+	err = response.JSON(w, http.StatusCreated, photo)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deleteUpload(w http.ResponseWriter, r *http.Request) {
+	upload, ok := app.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.data.Uploads.Delete(r.Context(), upload.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = os.Remove(app.partialUploadPath(upload.ID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUpload authenticates the request and loads the upload session named in
+// the URL, writing an error response and returning false if it can't.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request) (*data.Upload, bool) {
+	user := app.contextGetUser(r)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return nil, false
+	}
+
+	if !app.checkTusResumable(w, r) {
+		return nil, false
+	}
+
+	uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	upload, err := app.data.Uploads.Get(r.Context(), uploadID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func (app *application) checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		headers := http.Header{"Tus-Version": []string{tusVersion}}
+		app.errorMessage(w, r, http.StatusPreconditionFailed, "unsupported Tus-Resumable version", headers)
+		return false
+	}
+	return true
+}
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// finalizeUpload verifies a completed upload and stores it as a photo. The
+// upload session is removed once the photo is stored or the upload is
+// rejected. After any other error it is kept, so that the client can retry by
+// sending an empty chunk at the final offset.
+func (app *application) finalizeUpload(ctx context.Context, upload *data.Upload) (photo *photoResponse, err error) {
+	partialPath := app.partialUploadPath(upload.ID)
+
+	defer func() {
+		if err != nil && !uploadRejected(err) {
+			return
+		}
+
+		// The session must go even if the client has disconnected.
+		ctx := context.WithoutCancel(ctx)
+
+		err := app.data.Uploads.Delete(ctx, upload.ID)
+		if err != nil {
+			app.logger.ErrorContext(ctx, "deleting finalized upload failed", "error", err, "upload", upload.ID)
+		}
+
+		err = os.Remove(partialPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			app.logger.ErrorContext(ctx, "removing finalized upload failed", "error", err, "upload", upload.ID)
+		}
+	}()
+
+	src, err := os.Open(partialPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	if upload.Checksum != nil {
+		hash := sha256.New()
+
+		_, err = io.Copy(hash, io.LimitReader(src, upload.Length))
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(hash.Sum(nil), upload.Checksum) {
+			return nil, errChecksumMismatch
+		}
+
+		_, err = src.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := app.data.Users.GetByID(ctx, upload.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := createPhotoInput{
+		Caption:        upload.Caption,
+		AltText:        upload.AltText,
+		Latitude:       upload.Latitude,
+		Longitude:      upload.Longitude,
+		PlaceName:      upload.PlaceName,
+		ImportLocation: upload.ImportLocation,
+	}
+
+	return app.storePhoto(ctx, user, io.LimitReader(src, upload.Length), input)
+}
+
+// uploadRejected reports whether finalizeUpload failed because of the upload
+// itself, so that retrying it can't succeed.
+func uploadRejected(err error) bool {
+	for _, rejected := range []error{errChecksumMismatch, errBannedPhoto, errUnsupportedImage, errImageTooLarge, errDuplicatePhoto} {
+		if errors.Is(err, rejected) {
+			return true
+		}
+	}
+	return false
+}
+
+// expireUploads deletes abandoned upload sessions along with the partial
+// files they left behind.
+func (app *application) expireUploads(ctx context.Context) error {
+	ids, err := app.data.Uploads.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := os.Remove(app.partialUploadPath(id))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if len(ids) > 0 {
+		app.logger.InfoContext(ctx, "expired upload sessions", "count", len(ids))
+	}
+
+	return nil
+}
+
+func (app *application) partialUploadPath(id uuid.UUID) string {
+	return filepath.Join(app.config.Upload.PartialDir, id.String())
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header, a comma
+// separated list of keys each followed by a space and a base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata value for %q is not valid base64", key)
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+// parseChecksum decodes a whole-file checksum given as "sha256 <base64>".
+func parseChecksum(value string) ([]byte, error) {
+	algorithm, encoded, _ := strings.Cut(value, " ")
+	if algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	checksum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(checksum) != sha256.Size {
+		return nil, errors.New("checksum metadata contains an invalid sha256 checksum")
+	}
+
+	return checksum, nil
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"errors"
 	"net/http"
-	"time"
 
 	"athifirshad.com/bettergram/internal/data"
 	"athifirshad.com/bettergram/internal/request"
@@ -38,7 +37,7 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.data.Users.Insert(user)
+	err = app.data.Users.Insert(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -51,6 +50,8 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.metrics.Registrations.Inc()
+
 	err = response.JSON(w, http.StatusCreated, user)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -70,42 +71,63 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.data.Users.GetByEmail(input.Email)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			response.InvalidCredentials(w, r)
-		default:
-			app.serverError(w, r, err)
-		}
+	user, ok := app.authenticateCredentials(w, r, input.Email, input.Password)
+	if !ok {
 		return
 	}
 
-	match, err := user.Password.Matches(input.Password)
+	token, err := app.data.Tokens.New(r.Context(), user.ID, app.config.Auth.TokenTTL, data.ScopeAuthentication)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	if !match {
-		response.InvalidCredentials(w, r)
-		return
-	}
-
-	token, err := app.data.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = response.JSON(w, http.StatusOK, map[string]string{"authentication_token": token.Plaintext})
 	if err != nil {
 		app.serverError(w, r, err)
 	}
+}
 
-	err = response.JSON(w, http.StatusOK, map[string]string{"authentication_token": token.Plaintext})
+func (app *application) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := response.JSON(w, http.StatusOK, user)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
 }
 
-func (app *application) getUserProfile(w http.ResponseWriter, r *http.Request) {
+func (app *application) updateUserProfile(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
-	err := response.JSON(w, http.StatusOK, user)
+	if user == data.AnonymousUser {
+		app.invalidAuthenticationToken(w, r)
+		return
+	}
+
+	var input struct {
+		AltTextReminders *bool `json:"alt_text_reminders"`
+		IsPrivate        *bool `json:"is_private"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.AltTextReminders != nil {
+		user.AltTextReminders = *input.AltTextReminders
+	}
+	if input.IsPrivate != nil {
+		user.IsPrivate = *input.IsPrivate
+	}
+
+	err = app.data.Users.Update(r.Context(), user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, user)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
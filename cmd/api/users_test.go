@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"athifirshad.com/bettergram/internal/data"
+)
+
+func TestRegisterUser(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	res := ts.do(t, http.MethodPost, "/users", "", map[string]string{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"password": "pa55word",
+	})
+	checkStatus(t, res, http.StatusCreated)
+
+	var user data.User
+	res.decode(t, &user)
+
+	if user.ID == 0 || user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("got user %+v", user)
+	}
+	if strings.Contains(string(res.body), "pa55word") {
+		t.Error("response contains the password")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		want     string
+	}{
+		{"duplicate email", "bob", "alice@example.com", "A user with this email address already exists"},
+		{"duplicate username", "alice", "bob@example.com", "A user with this username already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.do(t, http.MethodPost, "/users", "", map[string]string{
+				"username": tt.username,
+				"email":    tt.email,
+				"password": "pa55word",
+			})
+			checkStatus(t, res, http.StatusBadRequest)
+
+			var body struct{ Error string }
+			res.decode(t, &body)
+
+			if body.Error != tt.want {
+				t.Errorf("got error %q; want %q", body.Error, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		res := ts.do(t, http.MethodPost, "/users", "", strings.NewReader(`{"username":`))
+		checkStatus(t, res, http.StatusBadRequest)
+	})
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	ts.register(t, "alice")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/users/login", http.StatusOK},
+		{"/tokens", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res := ts.do(t, http.MethodPost, tt.path, "", map[string]string{
+				"email":    "alice@example.com",
+				"password": "wrong",
+			})
+			checkStatus(t, res, http.StatusUnauthorized)
+
+			res = ts.do(t, http.MethodPost, tt.path, "", map[string]string{
+				"email":    "nobody@example.com",
+				"password": "pa55word",
+			})
+			checkStatus(t, res, http.StatusUnauthorized)
+
+			res = ts.do(t, http.MethodPost, tt.path, "", map[string]string{
+				"email":    "alice@example.com",
+				"password": "pa55word",
+			})
+			checkStatus(t, res, tt.want)
+		})
+	}
+}
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	user, _ := ts.register(t, "alice")
+
+	res := ts.do(t, http.MethodPost, "/tokens", "", map[string]string{
+		"email":    "alice@example.com",
+		"password": "pa55word",
+	})
+	checkStatus(t, res, http.StatusCreated)
+
+	var body struct {
+		Token data.Token `json:"authentication_token"`
+	}
+	res.decode(t, &body)
+
+	if len(body.Token.Plaintext) != 26 || body.Token.Expiry.IsZero() {
+		t.Fatalf("got token %+v", body.Token)
+	}
+
+	res = ts.do(t, http.MethodGet, "/users/profile", body.Token.Plaintext, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var profile data.User
+	res.decode(t, &profile)
+
+	if profile.ID != user.ID {
+		t.Errorf("got profile of user %d; want %d", profile.ID, user.ID)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	ts.register(t, "alice")
+
+	// The first failure after the free attempts adds a delay.
+	for range app.config.Login.FreeAttempts + 1 {
+		res := ts.do(t, http.MethodPost, "/users/login", "", map[string]string{
+			"email":    "alice@example.com",
+			"password": "wrong",
+		})
+		checkStatus(t, res, http.StatusUnauthorized)
+
+		var body struct {
+			RequestID string
+		}
+		res.decode(t, &body)
+
+		if body.RequestID == "" || body.RequestID != res.header.Get("X-Request-ID") {
+			t.Errorf("got request ID %q in body; want the X-Request-ID header", body.RequestID)
+		}
+	}
+
+	// The correct password is refused until the delay has passed.
+	res := ts.do(t, http.MethodPost, "/users/login", "", map[string]string{
+		"email":    "alice@example.com",
+		"password": "pa55word",
+	})
+	checkStatus(t, res, http.StatusTooManyRequests)
+
+	if res.header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+// TestLoginKeepsIPFailures checks that logging in to one account doesn't
+// forget the failures from the same client IP against others.
+func TestLoginKeepsIPFailures(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	ts.register(t, "alice")
+	ts.register(t, "bob")
+
+	app.config.Login.IPFreeAttempts = 2
+
+	login := func(username, password string) testResponse {
+		return ts.do(t, http.MethodPost, "/users/login", "", map[string]string{
+			"email":    username + "@example.com",
+			"password": password,
+		})
+	}
+
+	// Successful logins aren't counted as failures, but don't forget
+	// earlier ones either, so the third failure adds a delay.
+	checkStatus(t, login("bob", "wrong"), http.StatusUnauthorized)
+	checkStatus(t, login("alice", "pa55word"), http.StatusOK)
+	checkStatus(t, login("bob", "wrong"), http.StatusUnauthorized)
+	checkStatus(t, login("bob", "wrong"), http.StatusUnauthorized)
+	checkStatus(t, login("bob", "wrong"), http.StatusTooManyRequests)
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	_, token := ts.register(t, "alice")
+
+	res := ts.do(t, http.MethodPatch, "/users/profile", token, map[string]bool{
+		"is_private":         true,
+		"alt_text_reminders": true,
+	})
+	checkStatus(t, res, http.StatusOK)
+
+	res = ts.do(t, http.MethodGet, "/users/profile", token, nil)
+	checkStatus(t, res, http.StatusOK)
+
+	var user data.User
+	res.decode(t, &user)
+
+	if !user.IsPrivate || !user.AltTextReminders {
+		t.Errorf("got user %+v; want private with alt text reminders", user)
+	}
+
+	res = ts.do(t, http.MethodPatch, "/users/profile", token, map[string]string{"is_private": "yes"})
+	checkStatus(t, res, http.StatusBadRequest)
+}
@@ -0,0 +1,340 @@
+// Package config holds the API's settings. Each setting has a default that
+// can be overridden, in increasing order of precedence, by a YAML file, an
+// environment variable and a command-line flag; see Load.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"athifirshad.com/bettergram/internal/data"
+	"athifirshad.com/bettergram/internal/logging"
+	"athifirshad.com/bettergram/internal/ratelimit"
+	"athifirshad.com/bettergram/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Values of upload.duplicates.
+const (
+	DuplicatesAllow  = "allow"
+	DuplicatesWarn   = "warn"
+	DuplicatesReject = "reject"
+)
+
+// Values of ratelimit.backend.
+const (
+	RateLimitMemory   = "memory"
+	RateLimitPostgres = "postgres"
+)
+
+// DefaultReactions are the reaction types offered when none are configured.
+var DefaultReactions = []string{data.DefaultReaction, "love", "haha", "wow", "sad", "angry"}
+
+// Config is the complete configuration of the API.
+//
+// Fields are tagged with their key in the config file. Their flag name is the
+// dash-separated key path (http.port is -http-port) and their environment
+// variable is the upper-cased, underscore-separated path prefixed with
+// BETTERGRAM_ (BETTERGRAM_HTTP_PORT), unless a flag or env tag says otherwise.
+// Fields tagged secret are redacted when the configuration is printed.
+type Config struct {
+	File  string `yaml:"-" flag:"config" env:"BETTERGRAM_CONFIG" usage:"path to a YAML config file"`
+	Print bool   `yaml:"-" flag:"print-config" usage:"print the effective configuration with secrets redacted and exit"`
+
+	BaseURL     string      `yaml:"base_url" usage:"base URL for the application"`
+	HTTP        HTTP        `yaml:"http"`
+	DB          DB          `yaml:"db"`
+	Auth        Auth        `yaml:"auth"`
+	Upload      Upload      `yaml:"upload"`
+	Moderation  Moderation  `yaml:"moderation"`
+	Location    Location    `yaml:"location"`
+	Stories     Stories     `yaml:"stories"`
+	Reactions   []string    `yaml:"reactions" usage:"comma-separated reaction types users can choose from"`
+	Explore     Explore     `yaml:"explore"`
+	Suggestions Suggestions `yaml:"suggestions"`
+	Login       Login       `yaml:"login"`
+	RateLimit   RateLimit   `yaml:"ratelimit"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Log         Log         `yaml:"log"`
+}
+
+type HTTP struct {
+	Port           int           `yaml:"port" usage:"port to listen on for HTTP requests"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout" usage:"how long idle keep-alive connections are kept open"`
+	ReadTimeout    time.Duration `yaml:"read_timeout" usage:"maximum time to read a request, including its body"`
+	WriteTimeout   time.Duration `yaml:"write_timeout" usage:"maximum time to write a response"`
+	ShutdownPeriod time.Duration `yaml:"shutdown_period" usage:"how long in-flight requests are given to finish on shutdown"`
+	CORSOrigins    []string      `yaml:"cors_origins" usage:"comma-separated origins allowed to make cross-origin requests"`
+	MetricsPort    int           `yaml:"metrics_port" usage:"port to serve /metrics on, kept apart from the API so that it isn't public (0 to disable)"`
+}
+
+type DB struct {
+	DSN          string        `yaml:"dsn" env:"DB_DSN" secret:"true" usage:"PostgreSQL connection string"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" usage:"maximum time a query made for a request to look up a single record may take"`
+	WriteTimeout time.Duration `yaml:"write_timeout" usage:"maximum time a query made for a request to insert, update or delete records may take"`
+	ListTimeout  time.Duration `yaml:"list_timeout" usage:"maximum time a query made for a request to list a page of records, such as a feed or search, may take"`
+	JobTimeout   time.Duration `yaml:"job_timeout" usage:"maximum time each run of a background job, such as the explore refresh, may take"`
+	AutoMigrate  bool          `yaml:"auto_migrate" usage:"apply pending database migrations on start"`
+}
+
+type Auth struct {
+	TokenTTL   time.Duration `yaml:"token_ttl" usage:"how long authentication tokens are valid"`
+	BcryptCost int           `yaml:"bcrypt_cost" usage:"bcrypt work factor for hashing passwords"`
+}
+
+type Upload struct {
+	Dir          string        `yaml:"dir" env:"UPLOAD_DIR" usage:"directory uploaded photos are stored in"`
+	MaxPhotoSize int64         `yaml:"max_photo_size" usage:"maximum size in bytes of a photo or story uploaded in a single request"`
+	MaxSize      int64         `yaml:"max_size" usage:"maximum size in bytes of a resumable photo upload"`
+	StagingDir   string        `yaml:"staging_dir" usage:"directory uploads are written to while they are checked, outside dir so that they aren't served (ideally on the same filesystem)"`
+	PartialDir   string        `yaml:"partial_dir" usage:"directory for incomplete resumable uploads (must be shared between instances)"`
+	ChunkTimeout time.Duration `yaml:"chunk_timeout" usage:"maximum time to receive a single resumable upload chunk"`
+	SessionTTL   time.Duration `yaml:"session_ttl" usage:"time after the last received chunk before an upload session is abandoned"`
+	ReapInterval time.Duration `yaml:"reap_interval" usage:"how often abandoned upload sessions are cleaned up"`
+	Duplicates   string        `yaml:"duplicates" flag:"duplicate-uploads" usage:"how to handle uploads identical to a photo the user already posted (allow|warn|reject)"`
+}
+
+type Moderation struct {
+	MaxHashDistance int `yaml:"max_hash_distance" flag:"phash-max-distance" usage:"maximum Hamming distance between perceptual hashes for images to count as the same"`
+}
+
+type Location struct {
+	Precision int `yaml:"precision" usage:"decimal places photo coordinates are rounded to (3 is roughly 100m)"`
+}
+
+type Stories struct {
+	TTL          time.Duration `yaml:"ttl" flag:"story-ttl" usage:"how long stories are shown before they expire"`
+	ReapInterval time.Duration `yaml:"reap_interval" flag:"story-reap-interval" usage:"how often expired stories are deleted"`
+}
+
+type Explore struct {
+	LikeWeight      float64       `yaml:"like_weight" usage:"weight of each like or reaction in explore scores"`
+	CommentWeight   float64       `yaml:"comment_weight" usage:"weight of each comment in explore scores"`
+	Gravity         float64       `yaml:"gravity" usage:"how quickly explore scores decay with a photo's age"`
+	Window          time.Duration `yaml:"window" usage:"maximum age of photos shown in explore"`
+	Generations     int           `yaml:"generations" usage:"number of explore score generations kept for clients still paging through them"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" usage:"how often explore scores are recomputed"`
+}
+
+// Weights returns the explore score weights.
+func (e Explore) Weights() data.ExploreWeights {
+	return data.ExploreWeights{
+		Likes:    e.LikeWeight,
+		Comments: e.CommentWeight,
+		Gravity:  e.Gravity,
+		Window:   e.Window,
+	}
+}
+
+type Suggestions struct {
+	TTL             time.Duration `yaml:"ttl" usage:"how long precomputed follow suggestions are used before they are recomputed"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" usage:"how often expired follow suggestions are recomputed"`
+	BatchSize       int           `yaml:"batch_size" usage:"maximum number of users whose follow suggestions are recomputed per run"`
+}
+
+type Login struct {
+	FreeAttempts   int           `yaml:"free_attempts" usage:"failed logins per account before further attempts are slowed down"`
+	MaxFailures    int           `yaml:"max_failures" usage:"failed logins per account before it is locked"`
+	IPFreeAttempts int           `yaml:"ip_free_attempts" usage:"failed logins per client IP before further attempts are slowed down"`
+	IPMaxFailures  int           `yaml:"ip_max_failures" usage:"failed logins per client IP before it is locked"`
+	Lockout        time.Duration `yaml:"lockout" usage:"how long accounts and client IPs are locked after too many failed logins"`
+	FailureWindow  time.Duration `yaml:"failure_window" usage:"time without failed logins after which failures are forgotten"`
+}
+
+// AccountPolicy returns the policy for failed logins to a single account.
+func (l Login) AccountPolicy() data.LoginPolicy {
+	return data.LoginPolicy{
+		FreeAttempts: l.FreeAttempts,
+		MaxFailures:  l.MaxFailures,
+		Lockout:      l.Lockout,
+		Window:       l.FailureWindow,
+	}
+}
+
+// IPPolicy returns the policy for failed logins from a single client IP.
+func (l Login) IPPolicy() data.LoginPolicy {
+	return data.LoginPolicy{
+		FreeAttempts: l.IPFreeAttempts,
+		MaxFailures:  l.IPMaxFailures,
+		Lockout:      l.Lockout,
+		Window:       l.FailureWindow,
+	}
+}
+
+type RateLimit struct {
+	Enabled    bool            `yaml:"enabled" usage:"enable rate limiting"`
+	Backend    string          `yaml:"backend" usage:"where rate limit buckets are kept (memory|postgres); use postgres to share limits between instances"`
+	TrustProxy bool            `yaml:"trust_proxy" usage:"identify clients by the last X-Forwarded-For address, for use behind a reverse proxy"`
+	Global     ratelimit.Limit `yaml:"global" usage:"requests allowed per user, or per client IP without a valid token, across all routes, as <requests>/<period>"`
+	Login      ratelimit.Limit `yaml:"login" usage:"login attempts allowed per client IP"`
+	Register   ratelimit.Limit `yaml:"register" usage:"registrations allowed per client IP"`
+	Upload     ratelimit.Limit `yaml:"upload" usage:"photo and story uploads allowed per user"`
+}
+
+type Tracing struct {
+	Enabled     bool    `yaml:"enabled" usage:"export OpenTelemetry traces over OTLP/HTTP"`
+	Endpoint    string  `yaml:"endpoint" usage:"OTLP/HTTP endpoint URL traces are sent to (default from OTEL_EXPORTER_OTLP_ENDPOINT, or http://localhost:4318)"`
+	ServiceName string  `yaml:"service_name" usage:"service name traces are reported under"`
+	SampleRatio float64 `yaml:"sample_ratio" usage:"fraction of new traces sampled; requests continuing a sampled trace are always sampled"`
+}
+
+type Log struct {
+	Format string     `yaml:"format" usage:"log output format (text|json); use json when logs are collected"`
+	Level  slog.Level `yaml:"level" usage:"minimum level logged (debug|info|warn|error)"`
+}
+
+// Default returns the configuration used for settings that aren't set
+// anywhere else.
+func Default() Config {
+	return Config{
+		BaseURL: "http://localhost:4000",
+		HTTP: HTTP{
+			Port:           4000,
+			IdleTimeout:    time.Minute,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			ShutdownPeriod: 30 * time.Second,
+			CORSOrigins:    []string{"*"},
+			MetricsPort:    4001,
+		},
+		DB: DB{
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 5 * time.Second,
+			ListTimeout:  10 * time.Second,
+			JobTimeout:   time.Minute,
+		},
+		Auth: Auth{
+			TokenTTL:   24 * time.Hour,
+			BcryptCost: 12,
+		},
+		Upload: Upload{
+			Dir:          "/uploads",
+			MaxPhotoSize: 10 << 20,
+			MaxSize:      200 << 20,
+			StagingDir:   filepath.Join(os.TempDir(), "bettergram-staging"),
+			PartialDir:   filepath.Join(os.TempDir(), "bettergram-uploads"),
+			ChunkTimeout: time.Minute,
+			SessionTTL:   24 * time.Hour,
+			ReapInterval: 10 * time.Minute,
+			Duplicates:   DuplicatesWarn,
+		},
+		Moderation: Moderation{
+			MaxHashDistance: 10,
+		},
+		Location: Location{
+			Precision: 3,
+		},
+		Stories: Stories{
+			TTL:          24 * time.Hour,
+			ReapInterval: 5 * time.Minute,
+		},
+		Reactions: slices.Clone(DefaultReactions),
+		Explore: Explore{
+			LikeWeight:      1,
+			CommentWeight:   2,
+			Gravity:         1.8,
+			Window:          72 * time.Hour,
+			Generations:     6,
+			RefreshInterval: 10 * time.Minute,
+		},
+		Suggestions: Suggestions{
+			TTL:             6 * time.Hour,
+			RefreshInterval: 5 * time.Minute,
+			BatchSize:       500,
+		},
+		Login: Login{
+			FreeAttempts:   3,
+			MaxFailures:    10,
+			IPFreeAttempts: 20,
+			IPMaxFailures:  50,
+			Lockout:        15 * time.Minute,
+			FailureWindow:  time.Hour,
+		},
+		RateLimit: RateLimit{
+			Enabled:  true,
+			Backend:  RateLimitMemory,
+			Global:   ratelimit.Limit{Requests: 50, Period: time.Second},
+			Login:    ratelimit.Limit{Requests: 10, Period: time.Minute},
+			Register: ratelimit.Limit{Requests: 5, Period: time.Hour},
+			Upload:   ratelimit.Limit{Requests: 60, Period: time.Hour},
+		},
+		Tracing: Tracing{
+			ServiceName: "bettergram",
+			SampleRatio: 1,
+		},
+		Log: Log{
+			Format: logging.FormatText,
+			Level:  slog.LevelDebug,
+		},
+	}
+}
+
+var rxReaction = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Validate checks the configuration, returning every problem found.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.BaseURL != "", "base_url must be set")
+	check(validator.Between(c.HTTP.Port, 1, 65535), "http.port must be between 1 and 65535")
+	check(c.HTTP.IdleTimeout > 0 && c.HTTP.ReadTimeout > 0 && c.HTTP.WriteTimeout > 0, "http timeouts must be positive")
+	check(c.HTTP.ShutdownPeriod >= 0, "http.shutdown_period must not be negative")
+	check(len(c.HTTP.CORSOrigins) > 0, "http.cors_origins must not be empty")
+	check(c.HTTP.MetricsPort == 0 || validator.Between(c.HTTP.MetricsPort, 1, 65535), "http.metrics_port must be 0 or between 1 and 65535")
+	check(c.HTTP.MetricsPort != c.HTTP.Port, "http.metrics_port must differ from http.port")
+
+	check(c.DB.DSN != "", "db.dsn must be set (DB_DSN environment variable)")
+	check(c.DB.ReadTimeout > 0 && c.DB.WriteTimeout > 0 && c.DB.ListTimeout > 0 && c.DB.JobTimeout > 0, "db timeouts must be positive")
+
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive")
+	check(validator.Between(c.Auth.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost), "auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+
+	check(c.Upload.Dir != "", "upload.dir must be set")
+	check(c.Upload.StagingDir != "" && !insideDir(c.Upload.StagingDir, c.Upload.Dir), "upload.staging_dir must be set and outside upload.dir")
+	check(c.Upload.MaxPhotoSize > 0 && c.Upload.MaxSize > 0, "upload sizes must be positive")
+	check(validator.In(c.Upload.Duplicates, DuplicatesAllow, DuplicatesWarn, DuplicatesReject), "invalid upload.duplicates value %q", c.Upload.Duplicates)
+
+	check(validator.Between(c.Moderation.MaxHashDistance, 0, 64), "moderation.max_hash_distance must be between 0 and 64")
+	check(c.Stories.TTL > 0, "stories.ttl must be positive")
+	check(c.Explore.Generations >= 1, "explore.generations must be at least 1")
+	check(c.Suggestions.BatchSize >= 1, "suggestions.batch_size must be at least 1")
+
+	for _, policy := range []data.LoginPolicy{c.Login.AccountPolicy(), c.Login.IPPolicy()} {
+		check(policy.FreeAttempts >= 0 && policy.MaxFailures > policy.FreeAttempts, "login max failures must be greater than the free attempts")
+	}
+
+	check(validator.In(c.RateLimit.Backend, RateLimitMemory, RateLimitPostgres), "invalid ratelimit.backend value %q", c.RateLimit.Backend)
+
+	check(c.Tracing.ServiceName != "", "tracing.service_name must be set")
+	check(validator.Between(c.Tracing.SampleRatio, 0, 1), "tracing.sample_ratio must be between 0 and 1")
+
+	check(validator.In(c.Log.Format, logging.FormatText, logging.FormatJSON), "invalid log.format value %q", c.Log.Format)
+
+	// Reactions are stored by name, so removing one from the set hides it
+	// from new reactions but existing ones are still counted.
+	for _, reaction := range c.Reactions {
+		check(rxReaction.MatchString(reaction), "invalid reaction %q: must be 1 to 32 lowercase letters, digits or underscores", reaction)
+	}
+	check(validator.NoDuplicates(c.Reactions), "reactions must not contain duplicates")
+	check(slices.Contains(c.Reactions, data.DefaultReaction), "reactions must include %q, which the like endpoints use", data.DefaultReaction)
+
+	return errors.Join(errs...)
+}
+
+// insideDir reports whether path is dir or somewhere under it.
+func insideDir(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
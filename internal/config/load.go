@@ -0,0 +1,267 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "BETTERGRAM_"
+
+// Load builds the configuration from the defaults, the config file named by
+// -config or BETTERGRAM_CONFIG, environment variables read with getenv and
+// the command-line arguments, each overriding the last, and validates it. It
+// also returns the arguments remaining after the flags.
+func Load(name string, args []string, getenv func(string) string) (Config, []string, error) {
+	// Flags are parsed before anything else so that -config is known, but
+	// only applied once the file and environment have been read.
+	scratch := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	set := map[string]string{}
+	for _, f := range fields(&scratch) {
+		fs.Var(&recordedValue{settingValue{f.value}, f.flag, set}, f.flag, f.usage)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+
+	file, ok := set["config"]
+	if !ok {
+		file = getenv("BETTERGRAM_CONFIG")
+	}
+	if file != "" {
+		err = cfg.readFile(file)
+		if err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	for _, f := range fields(&cfg) {
+		value, ok := set[f.flag]
+		source := "-" + f.flag
+		if !ok {
+			if f.env == "" {
+				continue
+			}
+			value = getenv(f.env)
+			source = f.env
+			if value == "" {
+				continue
+			}
+		}
+
+		err := setValue(f.value, value)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("invalid value %q for %s: %w", value, source, err)
+		}
+	}
+
+	cfg.File = file
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	err = dec.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted returns the configuration as YAML, with secrets replaced.
+func (c Config) Redacted() string {
+	for _, f := range fields(&c) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("[redacted]")
+		}
+	}
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+
+	err := enc.Encode(c)
+	if err != nil {
+		return fmt.Sprintf("# %s\n", err)
+	}
+	return b.String()
+}
+
+// field is a single setting in a Config.
+type field struct {
+	value  reflect.Value
+	flag   string
+	env    string
+	usage  string
+	secret bool
+}
+
+// fields returns the settings in cfg, descending into nested sections.
+func fields(cfg *Config) []field {
+	return appendFields(nil, reflect.ValueOf(cfg).Elem(), nil)
+}
+
+func appendFields(fields []field, v reflect.Value, path []string) []field {
+	t := v.Type()
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		fieldPath := append(path[:len(path):len(path)], key)
+
+		if isSection(sf.Type) {
+			fields = appendFields(fields, v.Field(i), fieldPath)
+			continue
+		}
+
+		f := field{
+			value:  v.Field(i),
+			flag:   sf.Tag.Get("flag"),
+			env:    sf.Tag.Get("env"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		}
+		if f.flag == "" {
+			f.flag = strings.ReplaceAll(strings.Join(fieldPath, "-"), "_", "-")
+		}
+		if f.env == "" && key != "-" {
+			f.env = envPrefix + strings.ToUpper(strings.Join(fieldPath, "_"))
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// isSection reports whether a struct field groups further settings rather
+// than being a setting itself.
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// setValue parses s into the setting v.
+func setValue(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+// settingValue adapts a setting to flag.Value.
+type settingValue struct {
+	v reflect.Value
+}
+
+func (s settingValue) String() string {
+	if !s.v.IsValid() {
+		return ""
+	}
+
+	switch value := s.v.Interface().(type) {
+	case encoding.TextMarshaler:
+		text, _ := value.MarshalText()
+		return string(text)
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (s settingValue) Set(value string) error {
+	return setValue(s.v, value)
+}
+
+func (s settingValue) IsBoolFlag() bool {
+	return s.v.IsValid() && s.v.Kind() == reflect.Bool
+}
+
+// recordedValue remembers the raw value each flag was set to.
+type recordedValue struct {
+	settingValue
+	name string
+	set  map[string]string
+}
+
+func (r *recordedValue) Set(value string) error {
+	err := r.settingValue.Set(value)
+	if err != nil {
+		return err
+	}
+	r.set[r.name] = value
+	return nil
+}
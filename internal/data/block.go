@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrDuplicateBlock = errors.New("already blocked")
+	ErrBlocked        = errors.New("blocked")
+)
+
+type Block struct {
+	BlockerID int64     `json:"blocker_id"`
+	BlockedID int64     `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BlockModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert blocks a user and removes any follows or follow requests between
+// the two users. It returns ErrRecordNotFound if the blocked user doesn't
+// exist.
+func (m BlockModel) Insert(ctx context.Context, block *Block) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		query := `
+			INSERT INTO blocks (blocker_id, blocked_id)
+			VALUES ($1, $2)
+			RETURNING created_at`
+
+		err := tx.QueryRow(ctx, query, block.BlockerID, block.BlockedID).Scan(&block.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM follows
+			WHERE (follower_id = $1 AND followee_id = $2)
+			OR (follower_id = $2 AND followee_id = $1)`,
+			block.BlockerID, block.BlockedID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM follow_requests
+			WHERE (requester_id = $1 AND target_id = $2)
+			OR (requester_id = $2 AND target_id = $1)`,
+			block.BlockerID, block.BlockedID)
+		return err
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateBlock
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m BlockModel) Delete(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		DELETE FROM blocks
+		WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBlockInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	insertFollow(t, models, alice, bob)
+	insertFollow(t, models, bob, alice)
+	insertFollow(t, models, carol, alice)
+
+	block := &Block{BlockerID: alice.ID, BlockedID: bob.ID}
+
+	err := models.Blocks.Insert(ctx, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.CreatedAt.IsZero() {
+		t.Error("creation time was not set")
+	}
+
+	// Follows in both directions are removed, and only between the two.
+	if n := count(t, `SELECT COUNT(*) FROM follows WHERE (follower_id = $1 AND followee_id = $2) OR (follower_id = $2 AND followee_id = $1)`, alice.ID, bob.ID); n != 0 {
+		t.Errorf("got %d follows between alice and bob; want none", n)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM follows`); n != 1 {
+		t.Errorf("got %d follows; want carol's only", n)
+	}
+
+	tests := []struct {
+		name      string
+		blockedID int64
+		want      error
+	}{
+		{"duplicate", bob.ID, ErrDuplicateBlock},
+		{"unknown user", carol.ID + 1, ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.Blocks.Insert(ctx, &Block{BlockerID: alice.ID, BlockedID: tt.blockedID})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A failed block leaves existing follows alone.
+	if n := count(t, `SELECT COUNT(*) FROM follows`); n != 1 {
+		t.Errorf("got %d follows; want carol's only", n)
+	}
+}
+
+func TestBlockDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	insertBlock(t, models, alice, bob)
+
+	err := models.Blocks.Delete(ctx, bob.ID, alice.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v unblocking in the wrong direction; want ErrRecordNotFound", err)
+	}
+
+	err = models.Blocks.Delete(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Blocks.Delete(ctx, alice.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v unblocking twice; want ErrRecordNotFound", err)
+	}
+
+	// Once unblocked, the users can follow each other again.
+	insertFollow(t, models, bob, alice)
+}
@@ -0,0 +1,390 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrDuplicateCollection = errors.New("duplicate collection name")
+
+// Collection is a named, private group of a user's saved photos. Position
+// orders a user's collections, starting from 0.
+type Collection struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     int64     `json:"-"`
+	Name       string    `json:"name"`
+	Position   int       `json:"position"`
+	PhotoCount int       `json:"photo_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SaveModel manages the photos users have bookmarked. Saved photos are only
+// visible to the user who saved them, and photos by owners who have since
+// gone private are hidden unless the user follows them.
+type SaveModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert saves a photo for a user. Saving a photo twice is not an error. It
+// returns ErrRecordNotFound if the photo doesn't exist.
+func (m SaveModel) Insert(ctx context.Context, userID int64, photoID uuid.UUID) error {
+	query := `
+		INSERT INTO saved_photos (user_id, photo_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, userID, photoID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete unsaves a photo, which also removes it from all of the user's
+// collections.
+func (m SaveModel) Delete(ctx context.Context, userID int64, photoID uuid.UUID) error {
+	query := `
+		DELETE FROM saved_photos
+		WHERE user_id = $1 AND photo_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, userID, photoID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetPhotos returns a page of the photos a user has saved, most recently
+// saved first.
+func (m SaveModel) GetPhotos(ctx context.Context, userID int64, filters Filters) ([]*Photo, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), ` + photoColumns + `
+		FROM saved_photos s
+		JOIN photos p ON s.photo_id = p.id
+		JOIN users u ON p.user_id = u.id
+		WHERE s.user_id = $1 AND ` + visibleTo("$1") + `
+		ORDER BY s.created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return PhotoModel{DB: m.DB, Timeouts: m.Timeouts}.queryPhotoPage(ctx, query, filters, userID)
+}
+
+type CollectionModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+const collectionColumns = `c.id, c.user_id, c.name, c.position,
+	(SELECT COUNT(*) FROM collection_photos cp WHERE cp.collection_id = c.id), c.created_at`
+
+func scanCollection(row pgx.Row, collection *Collection) error {
+	return row.Scan(
+		&collection.ID,
+		&collection.UserID,
+		&collection.Name,
+		&collection.Position,
+		&collection.PhotoCount,
+		&collection.CreatedAt,
+	)
+}
+
+// lockCollections serializes changes to the positions of the user's
+// collections until tx ends. The user's row is locked rather than the
+// collections, so that it also holds while the user has none.
+func lockCollections(ctx context.Context, tx pgx.Tx, userID int64) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID)
+	return err
+}
+
+// Insert creates a collection after the user's existing ones.
+func (m CollectionModel) Insert(ctx context.Context, collection *Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name, position)
+		SELECT $1, $2, COALESCE(MAX(position) + 1, 0)
+		FROM collections
+		WHERE user_id = $1
+		RETURNING id, position, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		err := lockCollections(ctx, tx, collection.UserID)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.Position, &collection.CreatedAt)
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateCollection
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns one of the user's collections, or ErrRecordNotFound.
+func (m CollectionModel) Get(ctx context.Context, id uuid.UUID, userID int64) (*Collection, error) {
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE c.id = $1 AND c.user_id = $2`
+
+	var collection Collection
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanCollection(m.DB.QueryRow(ctx, query, id, userID), &collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &collection, nil
+}
+
+// GetAllForUser returns the user's collections in order.
+func (m CollectionModel) GetAllForUser(ctx context.Context, userID int64) ([]*Collection, error) {
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE c.user_id = $1
+		ORDER BY c.position`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		var collection Collection
+		err := scanCollection(rows, &collection)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, &collection)
+	}
+
+	return collections, rows.Err()
+}
+
+// Update renames a collection and moves it to collection.Position, shifting
+// the collections in between. Positions past the end move it to the end.
+func (m CollectionModel) Update(ctx context.Context, collection *Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		err := lockCollections(ctx, tx, collection.UserID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT id
+			FROM collections
+			WHERE user_id = $1
+			ORDER BY position`, collection.UserID)
+		if err != nil {
+			return err
+		}
+
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+
+		current, last := -1, len(ids)-1
+		for i, id := range ids {
+			if id == collection.ID {
+				current = i
+			}
+		}
+
+		if current == -1 {
+			return ErrRecordNotFound
+		}
+
+		target := min(max(collection.Position, 0), last)
+
+		switch {
+		case target < current:
+			_, err = tx.Exec(ctx, `
+				UPDATE collections SET position = position + 1
+				WHERE user_id = $1 AND position >= $2 AND position < $3`,
+				collection.UserID, target, current)
+		case target > current:
+			_, err = tx.Exec(ctx, `
+				UPDATE collections SET position = position - 1
+				WHERE user_id = $1 AND position > $2 AND position <= $3`,
+				collection.UserID, current, target)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE collections SET name = $1, position = $2
+			WHERE id = $3`,
+			collection.Name, target, collection.ID)
+		if err != nil {
+			return err
+		}
+
+		collection.Position = target
+		return nil
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateCollection
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a collection, closing the gap in the user's positions. The
+// photos in it stay saved.
+func (m CollectionModel) Delete(ctx context.Context, id uuid.UUID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		err := lockCollections(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		var position int
+
+		err = tx.QueryRow(ctx, `
+			DELETE FROM collections
+			WHERE id = $1 AND user_id = $2
+			RETURNING position`, id, userID).Scan(&position)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE collections SET position = position - 1
+			WHERE user_id = $1 AND position > $2`, userID, position)
+		return err
+	})
+}
+
+// AddPhoto adds a saved photo to a collection. Adding it twice is not an
+// error. It returns ErrRecordNotFound if the collection doesn't exist or
+// belongs to another user.
+func (m CollectionModel) AddPhoto(ctx context.Context, id uuid.UUID, userID int64, photoID uuid.UUID) error {
+	query := `
+		WITH c AS (
+			SELECT id, user_id
+			FROM collections
+			WHERE id = $1 AND user_id = $2
+		), added AS (
+			INSERT INTO collection_photos (collection_id, user_id, photo_id)
+			SELECT c.id, c.user_id, $3
+			FROM c
+			ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM c)`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	var found bool
+	err := m.DB.QueryRow(ctx, query, id, userID, photoID).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m CollectionModel) RemovePhoto(ctx context.Context, id uuid.UUID, userID int64, photoID uuid.UUID) error {
+	query := `
+		DELETE FROM collection_photos
+		WHERE collection_id = $1 AND user_id = $2 AND photo_id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, id, userID, photoID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetPhotos returns a page of the photos in a collection, most recently
+// added first. Photos by owners who have gone private are hidden unless the
+// user follows them.
+func (m CollectionModel) GetPhotos(ctx context.Context, id uuid.UUID, userID int64, filters Filters) ([]*Photo, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), ` + photoColumns + `
+		FROM collection_photos cp
+		JOIN photos p ON cp.photo_id = p.id
+		JOIN users u ON p.user_id = u.id
+		WHERE cp.collection_id = $1 AND cp.user_id = $2 AND ` + visibleTo("$2") + `
+		ORDER BY cp.added_at DESC
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return PhotoModel{DB: m.DB, Timeouts: m.Timeouts}.queryPhotoPage(ctx, query, filters, id, userID)
+}
@@ -0,0 +1,374 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func insertCollection(t *testing.T, models Models, user *User, name string) *Collection {
+	t.Helper()
+
+	collection := &Collection{UserID: user.ID, Name: name}
+
+	err := models.Collections.Insert(context.Background(), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collection
+}
+
+// collectionNames returns the names of the user's collections in order.
+func collectionNames(t *testing.T, models Models, user *User) string {
+	t.Helper()
+
+	collections, err := models.Collections.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i, collection := range collections {
+		if collection.Position != i {
+			t.Errorf("got %s at position %d; want %d", collection.Name, collection.Position, i)
+		}
+		names = append(names, collection.Name)
+	}
+	return fmt.Sprint(names)
+}
+
+func TestSaves(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	beach := insertPhoto(t, models, alice, "beach")
+	forest := insertPhoto(t, models, carol, "forest")
+	lake := insertPhoto(t, models, carol, "lake")
+
+	// Saving twice is not an error.
+	for _, photo := range []*Photo{beach, forest, lake, beach} {
+		err := models.Saves.Insert(ctx, bob.ID, photo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := models.Saves.Insert(ctx, bob.ID, uuid.New())
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v saving an unknown photo; want ErrRecordNotFound", err)
+	}
+
+	photos, metadata, err := models.Saves.GetPhotos(ctx, bob.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, lake, forest, beach)
+	if metadata.TotalRecords != 3 {
+		t.Errorf("got metadata %+v; want 3 records", metadata)
+	}
+
+	// Photos by owners who have gone private are hidden unless followed.
+	setPrivate(t, models, carol)
+
+	photos, _, err = models.Saves.GetPhotos(ctx, bob.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, beach)
+
+	insertFollow(t, models, bob, carol)
+
+	photos, _, err = models.Saves.GetPhotos(ctx, bob.ID, Filters{Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, beach)
+
+	err = models.Saves.Delete(ctx, bob.ID, beach.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Saves.Delete(ctx, bob.ID, beach.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v unsaving twice; want ErrRecordNotFound", err)
+	}
+
+	photos, _, err = models.Saves.GetPhotos(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos)
+}
+
+func TestCollectionInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	for i, name := range []string{"Beaches", "Forests"} {
+		collection := insertCollection(t, models, alice, name)
+		if collection.ID == uuid.Nil || collection.Position != i || collection.CreatedAt.IsZero() {
+			t.Errorf("got collection %+v; want it at position %d", collection, i)
+		}
+	}
+
+	err := models.Collections.Insert(ctx, &Collection{UserID: alice.ID, Name: "Beaches"})
+	if !errors.Is(err, ErrDuplicateCollection) {
+		t.Errorf("got error %v; want ErrDuplicateCollection", err)
+	}
+
+	// Names and positions are per user.
+	theirs := insertCollection(t, models, bob, "Beaches")
+	if theirs.Position != 0 {
+		t.Errorf("got position %d for bob's first collection; want 0", theirs.Position)
+	}
+
+	if got := collectionNames(t, models, alice); got != "[Beaches Forests]" {
+		t.Errorf("got collections %s", got)
+	}
+
+	_, err = models.Collections.Get(ctx, theirs.ID, alice.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for another user's collection; want ErrRecordNotFound", err)
+	}
+
+	collections, err := models.Collections.GetAllForUser(ctx, insertUser(t, models, "carol").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collections == nil || len(collections) != 0 {
+		t.Errorf("got collections %#v; want an empty list", collections)
+	}
+}
+
+func TestCollectionInsertConcurrent(t *testing.T) {
+	models := newTestModels(t)
+	alice := insertUser(t, models, "alice")
+
+	errs := make(chan error)
+	for i := range 5 {
+		go func() {
+			errs <- models.Collections.Insert(context.Background(), &Collection{UserID: alice.ID, Name: fmt.Sprint(i)})
+		}()
+	}
+
+	for range 5 {
+		err := <-errs
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// collectionNames checks that the positions run from 0 without gaps.
+	collectionNames(t, models, alice)
+}
+
+func TestCollectionUpdate(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	var collections []*Collection
+	for _, name := range []string{"A", "B", "C", "D"} {
+		collections = append(collections, insertCollection(t, models, alice, name))
+	}
+	insertCollection(t, models, bob, "Mine")
+
+	tests := []struct {
+		name       string
+		collection *Collection
+		rename     string
+		position   int
+		want       string
+	}{
+		{"move up", collections[3], "D", 1, "[A D B C]"},
+		{"move down", collections[0], "A", 2, "[D B A C]"},
+		{"past the end", collections[1], "B", 10, "[D A C B]"},
+		{"before the start", collections[2], "C", -1, "[C D A B]"},
+		{"rename in place", collections[0], "Z", 2, "[C D Z B]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.collection.Name = tt.rename
+			tt.collection.Position = tt.position
+
+			err := models.Collections.Update(ctx, tt.collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := collectionNames(t, models, alice); got != tt.want {
+				t.Errorf("got collections %s; want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := collectionNames(t, models, bob); got != "[Mine]" {
+		t.Errorf("got bob's collections %s", got)
+	}
+
+	err := models.Collections.Update(ctx, &Collection{ID: collections[1].ID, UserID: alice.ID, Name: "C", Position: 0})
+	if !errors.Is(err, ErrDuplicateCollection) {
+		t.Errorf("got error %v; want ErrDuplicateCollection", err)
+	}
+
+	err = models.Collections.Update(ctx, &Collection{ID: collections[1].ID, UserID: bob.ID, Name: "Stolen"})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v updating another user's collection; want ErrRecordNotFound", err)
+	}
+
+	// A failed update leaves the order alone.
+	if got := collectionNames(t, models, alice); got != "[C D Z B]" {
+		t.Errorf("got collections %s", got)
+	}
+}
+
+func TestCollectionDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	insertCollection(t, models, alice, "A")
+	middle := insertCollection(t, models, alice, "B")
+	insertCollection(t, models, alice, "C")
+
+	photo := insertPhoto(t, models, bob, "beach")
+
+	err := models.Saves.Insert(ctx, alice.ID, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Collections.AddPhoto(ctx, middle.ID, alice.ID, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Collections.Delete(ctx, middle.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting another user's collection; want ErrRecordNotFound", err)
+	}
+
+	err = models.Collections.Delete(ctx, middle.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := collectionNames(t, models, alice); got != "[A C]" {
+		t.Errorf("got collections %s; want the gap closed", got)
+	}
+
+	// The photos in it stay saved.
+	photos, _, err := models.Saves.GetPhotos(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, photo)
+
+	err = models.Collections.Delete(ctx, middle.ID, alice.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting twice; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCollectionPhotos(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	collection := insertCollection(t, models, alice, "Beaches")
+
+	beach := insertPhoto(t, models, bob, "beach")
+	dunes := insertPhoto(t, models, bob, "dunes")
+	unsaved := insertPhoto(t, models, bob, "unsaved")
+
+	for _, photo := range []*Photo{beach, dunes} {
+		err := models.Saves.Insert(ctx, alice.ID, photo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Adding twice is not an error.
+	for _, photo := range []*Photo{dunes, beach, beach} {
+		err := models.Collections.AddPhoto(ctx, collection.ID, alice.ID, photo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only saved photos can be added.
+	err := models.Collections.AddPhoto(ctx, collection.ID, alice.ID, unsaved.ID)
+	if err == nil {
+		t.Error("got no error adding a photo that isn't saved")
+	}
+
+	err = models.Collections.AddPhoto(ctx, collection.ID, bob.ID, unsaved.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v adding to another user's collection; want ErrRecordNotFound", err)
+	}
+
+	got, err := models.Collections.Get(ctx, collection.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Beaches" || got.PhotoCount != 2 {
+		t.Errorf("got collection %+v; want two photos", got)
+	}
+
+	photos, metadata, err := models.Collections.GetPhotos(ctx, collection.ID, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, beach, dunes)
+	if metadata.TotalRecords != 2 {
+		t.Errorf("got metadata %+v; want 2 records", metadata)
+	}
+
+	photos, _, err = models.Collections.GetPhotos(ctx, collection.ID, bob.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos)
+
+	err = models.Collections.RemovePhoto(ctx, collection.ID, alice.ID, beach.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Collections.RemovePhoto(ctx, collection.ID, alice.ID, beach.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v removing twice; want ErrRecordNotFound", err)
+	}
+
+	// Unsaving a photo removes it from every collection.
+	err = models.Saves.Delete(ctx, alice.ID, dunes.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = models.Collections.Get(ctx, collection.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PhotoCount != 0 {
+		t.Errorf("got %d photos; want none", got.PhotoCount)
+	}
+}
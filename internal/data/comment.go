@@ -9,40 +9,69 @@ import (
 )
 
 type Comment struct {
-	ID        uuid.UUID `json:"id"`
-	PhotoID   uuid.UUID `json:"photo_id"`
-	UserID    int64     `json:"user_id"`
-	Username  string    `json:"username"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID      `json:"id"`
+	PhotoID   uuid.UUID      `json:"photo_id"`
+	UserID    int64          `json:"user_id"`
+	Username  string         `json:"username"`
+	Content   string         `json:"content"`
+	Mentions  []Mention      `json:"mentions"`
+	Reactions ReactionCounts `json:"reactions"`
+	LikeCount int            `json:"like_count"`
+	Pinned    bool           `json:"pinned"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type CommentModelInterface interface {
+	Insert(ctx context.Context, comment *Comment) error
+	GetByPhotoID(ctx context.Context, photoID uuid.UUID, sort string) ([]*Comment, error)
+	Pin(ctx context.Context, photoID, commentID uuid.UUID, userID int64) error
+	Unpin(ctx context.Context, photoID uuid.UUID, userID int64) error
 }
 
 type CommentModel struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
 }
 
-func (m CommentModel) Insert(comment *Comment) error {
+func (m CommentModel) Insert(ctx context.Context, comment *Comment) error {
 	query := `
 		INSERT INTO comments (photo_id, user_id, content)
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at`
 
 	args := []interface{}{comment.PhotoID, comment.UserID, comment.Content}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	return m.DB.QueryRow(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt)
 }
 
-func (m CommentModel) GetByPhotoID(photoID uuid.UUID) ([]*Comment, error) {
+// Sort orders for GetByPhotoID. CommentSortTop orders comments by the number
+// of reactions they have, newest first among equals.
+const (
+	CommentSortNewest = "newest"
+	CommentSortTop    = "top"
+)
+
+// GetByPhotoID returns the comments on a photo in the given sort order, with
+// the comment pinned by the photo's owner, if any, first.
+func (m CommentModel) GetByPhotoID(ctx context.Context, photoID uuid.UUID, sort string) ([]*Comment, error) {
+	orderBy := "c.created_at DESC"
+	if sort == CommentSortTop {
+		orderBy = "like_count DESC, c.created_at DESC"
+	}
+
 	query := `
-		SELECT c.id, c.photo_id, c.user_id, u.username, c.content, c.created_at
+		SELECT c.id, c.photo_id, c.user_id, u.username, c.content, c.created_at, ` + commentMentionsColumn + `, ` + commentReactionsColumn + `,
+			(SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id) AS like_count,
+			COALESCE(c.id = p.pinned_comment_id, false) AS pinned
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
+		JOIN photos p ON c.photo_id = p.id
 		WHERE c.photo_id = $1
-		ORDER BY c.created_at DESC`
+		ORDER BY pinned DESC, ` + orderBy
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
 	defer cancel()
 
 	rows, err := m.DB.Query(ctx, query, photoID)
@@ -62,6 +91,10 @@ func (m CommentModel) GetByPhotoID(photoID uuid.UUID) ([]*Comment, error) {
 			&comment.Username,
 			&comment.Content,
 			&comment.CreatedAt,
+			&comment.Mentions,
+			&comment.Reactions,
+			&comment.LikeCount,
+			&comment.Pinned,
 		)
 		if err != nil {
 			return nil, err
@@ -70,4 +103,48 @@ func (m CommentModel) GetByPhotoID(photoID uuid.UUID) ([]*Comment, error) {
 	}
 
 	return comments, nil
-}
\ No newline at end of file
+}
+
+// Pin pins a comment to the top of a photo owned by userID, replacing any
+// previously pinned comment. It returns ErrRecordNotFound unless the user owns
+// the photo and the comment is on it.
+func (m CommentModel) Pin(ctx context.Context, photoID, commentID uuid.UUID, userID int64) error {
+	query := `
+		UPDATE photos SET pinned_comment_id = $2
+		WHERE id = $1 AND user_id = $3
+		AND EXISTS (SELECT 1 FROM comments WHERE id = $2 AND photo_id = $1)`
+
+	args := []interface{}{photoID, commentID, userID}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Unpin removes the pinned comment from a photo owned by userID.
+func (m CommentModel) Unpin(ctx context.Context, photoID uuid.UUID, userID int64) error {
+	query := `
+		UPDATE photos SET pinned_comment_id = NULL
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, photoID, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCommentInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	comment := insertComment(t, models, photo, alice, "First!")
+
+	if comment.ID == uuid.Nil || comment.CreatedAt.IsZero() {
+		t.Errorf("got comment %+v; want the ID and creation time set", comment)
+	}
+
+	err := models.Comments.Insert(ctx, &Comment{PhotoID: uuid.New(), UserID: alice.ID, Content: "Lost"})
+	if err == nil {
+		t.Error("got no error commenting on an unknown photo")
+	}
+}
+
+func TestCommentGetByPhotoID(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	photo := insertPhoto(t, models, alice, "beach")
+	other := insertPhoto(t, models, alice, "forest")
+
+	comments, err := models.Comments.GetByPhotoID(ctx, photo.ID, CommentSortNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments != nil {
+		t.Errorf("got comments %+v; want nil", comments)
+	}
+
+	popular := insertComment(t, models, photo, bob, "Hi @carol")
+	newest := insertComment(t, models, photo, carol, "Lovely")
+	insertComment(t, models, other, bob, "Elsewhere")
+
+	_, _, err = models.Mentions.Replace(ctx, bob.ID, photo.ID, &popular.ID, ParseMentions(popular.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []*User{alice, carol} {
+		err := models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: popular.ID, UserID: user.ID, Reaction: "love"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []*Comment
+	}{
+		{CommentSortNewest, []*Comment{newest, popular}},
+		{CommentSortTop, []*Comment{popular, newest}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			comments, err := models.Comments.GetByPhotoID(ctx, photo.ID, tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(comments) != len(tt.want) {
+				t.Fatalf("got %d comments; want %d", len(comments), len(tt.want))
+			}
+			for i, comment := range comments {
+				if comment.ID != tt.want[i].ID {
+					t.Errorf("comment %d: got %q; want %q", i, comment.Content, tt.want[i].Content)
+				}
+			}
+		})
+	}
+
+	comments, err = models.Comments.GetByPhotoID(ctx, photo.ID, CommentSortTop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := comments[0]
+	if got.Username != "bob" || got.LikeCount != 2 || got.Reactions["love"] != 2 || got.Pinned {
+		t.Errorf("got comment %+v", got)
+	}
+	if len(got.Mentions) != 1 || got.Mentions[0].UserID != carol.ID || got.Mentions[0].Offset != 3 || got.Mentions[0].Length != 6 {
+		t.Errorf("got mentions %+v; want carol", got.Mentions)
+	}
+}
+
+func TestCommentPin(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	photo := insertPhoto(t, models, alice, "beach")
+	other := insertPhoto(t, models, alice, "forest")
+
+	first := insertComment(t, models, photo, bob, "First!")
+	second := insertComment(t, models, photo, bob, "Second")
+	elsewhere := insertComment(t, models, other, bob, "Elsewhere")
+
+	tests := []struct {
+		name      string
+		commentID uuid.UUID
+		userID    int64
+	}{
+		{"not the owner", first.ID, bob.ID},
+		{"comment on another photo", elsewhere.ID, alice.ID},
+		{"unknown comment", uuid.New(), alice.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.Comments.Pin(ctx, photo.ID, tt.commentID, tt.userID)
+			if !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("got error %v; want ErrRecordNotFound", err)
+			}
+		})
+	}
+
+	pinned := func() []bool {
+		t.Helper()
+
+		comments, err := models.Comments.GetByPhotoID(ctx, photo.ID, CommentSortNewest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var flags []bool
+		for i, comment := range comments {
+			flags = append(flags, comment.Pinned)
+			if i == 0 && comment.Pinned && comment.ID != first.ID {
+				t.Errorf("got %q pinned; want %q", comment.Content, first.Content)
+			}
+		}
+		return flags
+	}
+
+	if got := pinned(); got[0] || got[1] {
+		t.Errorf("got pinned %v; want none", got)
+	}
+
+	err := models.Comments.Pin(ctx, photo.ID, second.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinning a comment replaces the one pinned before and moves it to the
+	// top, ahead of newer comments.
+	err = models.Comments.Pin(ctx, photo.ID, first.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pinned(); !got[0] || got[1] {
+		t.Errorf("got pinned %v; want only the first comment", got)
+	}
+
+	err = models.Comments.Unpin(ctx, photo.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v unpinning another user's photo; want ErrRecordNotFound", err)
+	}
+
+	err = models.Comments.Unpin(ctx, photo.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pinned(); got[0] || got[1] {
+		t.Errorf("got pinned %v; want none", got)
+	}
+
+	// Deleting the pinned comment unpins it.
+	err = models.Comments.Pin(ctx, photo.ID, first.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, `DELETE FROM comments WHERE id = $1`, first.ID)
+
+	if n := count(t, `SELECT COUNT(*) FROM photos WHERE id = $1 AND pinned_comment_id IS NULL`, photo.ID); n != 1 {
+		t.Error("photo still has a pinned comment after it was deleted")
+	}
+}
@@ -0,0 +1,373 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Conversation is a private thread between two or more users.
+type Conversation struct {
+	ID          uuid.UUID            `json:"id"`
+	Members     []ConversationMember `json:"members"`
+	LastMessage *Message             `json:"last_message,omitempty"`
+	UnreadCount int                  `json:"unread_count"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// ConversationMember is a participant in a conversation. LastReadAt serves as
+// a read receipt: every message sent before it has been seen by the member.
+type ConversationMember struct {
+	UserID     int64      `json:"user_id"`
+	Username   string     `json:"username"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID  `json:"id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       int64      `json:"sender_id"`
+	SenderUsername string     `json:"sender_username"`
+	Content        string     `json:"content,omitempty"`
+	PhotoID        *uuid.UUID `json:"photo_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ConversationModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// conversationColumns selects a conversation for the user in $1, including
+// its members, latest message and the number of messages the user hasn't
+// read. Queries must alias conversations as c and join the user's own
+// membership as me.
+const conversationColumns = `
+	c.id, c.created_at, c.updated_at,
+	(SELECT json_agg(json_build_object('user_id', cm.user_id, 'username', u.username, 'last_read_at', cm.last_read_at) ORDER BY cm.joined_at)
+		FROM conversation_members cm JOIN users u ON cm.user_id = u.id
+		WHERE cm.conversation_id = c.id),
+	(SELECT COUNT(*) FROM messages m
+		WHERE m.conversation_id = c.id AND m.sender_id <> $1
+		AND m.created_at > COALESCE(me.last_read_at, '-infinity')),
+	lm.id, lm.sender_id, lm.username, lm.content, lm.photo_id, lm.created_at`
+
+const lastMessageJoin = `
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.sender_id, u.username, m.content, m.photo_id, m.created_at
+		FROM messages m JOIN users u ON m.sender_id = u.id
+		WHERE m.conversation_id = c.id
+		ORDER BY m.created_at DESC
+		LIMIT 1
+	) lm ON true`
+
+func scanConversation(row pgx.Row, conversation *Conversation, extra ...any) error {
+	var (
+		messageID *uuid.UUID
+		message   Message
+		senderID  *int64
+		username  *string
+		content   *string
+		createdAt *time.Time
+	)
+
+	dest := append(extra,
+		&conversation.ID,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+		&conversation.Members,
+		&conversation.UnreadCount,
+		&messageID,
+		&senderID,
+		&username,
+		&content,
+		&message.PhotoID,
+		&createdAt,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	if messageID != nil {
+		message.ID = *messageID
+		message.ConversationID = conversation.ID
+		message.SenderID = *senderID
+		message.SenderUsername = *username
+		message.Content = *content
+		message.CreatedAt = *createdAt
+		conversation.LastMessage = &message
+	}
+	return nil
+}
+
+// GetDirect returns the one-to-one conversation between two users, or
+// ErrRecordNotFound if they haven't started one.
+func (m ConversationModel) GetDirect(ctx context.Context, userID, otherID int64) (*Conversation, error) {
+	query := `
+		SELECT ` + conversationColumns + `
+		FROM conversations c
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1
+		JOIN conversation_members other ON other.conversation_id = c.id AND other.user_id = $2` + lastMessageJoin + `
+		WHERE (SELECT COUNT(*) FROM conversation_members WHERE conversation_id = c.id) = 2
+		LIMIT 1`
+
+	var conversation Conversation
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanConversation(m.DB.QueryRow(ctx, query, userID, otherID), &conversation)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &conversation, nil
+}
+
+// Get returns a conversation the user is a member of, or ErrRecordNotFound.
+func (m ConversationModel) Get(ctx context.Context, id uuid.UUID, userID int64) (*Conversation, error) {
+	query := `
+		SELECT ` + conversationColumns + `
+		FROM conversations c
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1` + lastMessageJoin + `
+		WHERE c.id = $2`
+
+	var conversation Conversation
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanConversation(m.DB.QueryRow(ctx, query, userID, id), &conversation)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &conversation, nil
+}
+
+// GetAllForUser returns a page of the user's conversations, most recently
+// active first.
+func (m ConversationModel) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*Conversation, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), ` + conversationColumns + `
+		FROM conversations c
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1` + lastMessageJoin + `
+		ORDER BY c.updated_at DESC
+		LIMIT $2 OFFSET $3`
+
+	args := []interface{}{userID, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	conversations := []*Conversation{}
+
+	for rows.Next() {
+		var conversation Conversation
+		err := scanConversation(rows, &conversation, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		conversations = append(conversations, &conversation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return conversations, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Insert creates a conversation between creatorID and memberIDs. It returns
+// ErrRecordNotFound if any member doesn't exist and ErrBlocked if the creator
+// and any member have blocked each other.
+func (m ConversationModel) Insert(ctx context.Context, creatorID int64, memberIDs []int64) (uuid.UUID, error) {
+	var id uuid.UUID
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var found int
+		var blocked bool
+
+		err := tx.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(bool_or(EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $1) OR (b.blocker_id = $1 AND b.blocked_id = u.id)
+			)), false)
+			FROM users u
+			WHERE u.id = ANY($2)`, creatorID, memberIDs).Scan(&found, &blocked)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case found != len(memberIDs):
+			return ErrRecordNotFound
+		case blocked:
+			return ErrBlocked
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO conversations (created_by)
+			VALUES ($1)
+			RETURNING id`, creatorID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO conversation_members (conversation_id, user_id)
+			SELECT $1, unnest($2::bigint[])`, id, append([]int64{creatorID}, memberIDs...))
+		return err
+	})
+
+	return id, err
+}
+
+// MarkRead records that the user has read every message in the conversation.
+func (m ConversationModel) MarkRead(ctx context.Context, id uuid.UUID, userID int64) error {
+	query := `
+		UPDATE conversation_members
+		SET last_read_at = NOW()
+		WHERE conversation_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type MessageModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert sends a message, marking the conversation as read for the sender.
+// It returns ErrBlocked if the sender and another member have blocked each
+// other.
+func (m MessageModel) Insert(ctx context.Context, message *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var blocked bool
+
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM conversation_members cm
+				JOIN blocks b ON (b.blocker_id = cm.user_id AND b.blocked_id = $2)
+					OR (b.blocker_id = $2 AND b.blocked_id = cm.user_id)
+				WHERE cm.conversation_id = $1 AND cm.user_id <> $2
+			)`, message.ConversationID, message.SenderID).Scan(&blocked)
+		if err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `
+			INSERT INTO messages (conversation_id, sender_id, content, photo_id)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at`
+
+		args := []interface{}{message.ConversationID, message.SenderID, message.Content, message.PhotoID}
+
+		err = tx.QueryRow(ctx, query, args...).Scan(&message.ID, &message.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE conversations SET updated_at = $2 WHERE id = $1`,
+			message.ConversationID, message.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE conversation_members SET last_read_at = $3
+			WHERE conversation_id = $1 AND user_id = $2`,
+			message.ConversationID, message.SenderID, message.CreatedAt)
+		return err
+	})
+}
+
+// GetByConversationID returns a page of a conversation's messages, newest
+// first.
+func (m MessageModel) GetByConversationID(ctx context.Context, conversationID uuid.UUID, filters Filters) ([]*Message, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), m.id, m.conversation_id, m.sender_id, u.username, m.content, m.photo_id, m.created_at
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.conversation_id = $1
+		ORDER BY m.created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	args := []interface{}{conversationID, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	messages := []*Message{}
+
+	for rows.Next() {
+		var message Message
+		err := rows.Scan(
+			&totalRecords,
+			&message.ID,
+			&message.ConversationID,
+			&message.SenderID,
+			&message.SenderUsername,
+			&message.Content,
+			&message.PhotoID,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return messages, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
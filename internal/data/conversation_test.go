@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func insertMessage(t *testing.T, models Models, id uuid.UUID, sender *User, content string) *Message {
+	t.Helper()
+
+	message := &Message{ConversationID: id, SenderID: sender.ID, Content: content}
+
+	err := models.Messages.Insert(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestConversationInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	insertBlock(t, models, dave, alice)
+
+	id, err := models.Conversations.Insert(ctx, alice.ID, []int64{bob.ID, carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversation, err := models.Conversations.Get(ctx, id, carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conversation.Members) != 3 || conversation.LastMessage != nil || conversation.UnreadCount != 0 {
+		t.Errorf("got conversation %+v; want an empty one with three members", conversation)
+	}
+	for _, member := range conversation.Members {
+		if member.Username == "" || member.LastReadAt != nil {
+			t.Errorf("got member %+v; want a username and no read receipt", member)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		memberIDs []int64
+		want      error
+	}{
+		{"unknown member", []int64{bob.ID, dave.ID + 1}, ErrRecordNotFound},
+		{"blocked by member", []int64{bob.ID, dave.ID}, ErrBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Conversations.Insert(ctx, alice.ID, tt.memberIDs)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM conversations`); n != 1 {
+		t.Errorf("got %d conversations; want 1", n)
+	}
+
+	_, err = models.Conversations.Get(ctx, id, dave.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for a non-member; want ErrRecordNotFound", err)
+	}
+}
+
+func TestConversationGetDirect(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	_, err := models.Conversations.Insert(ctx, alice.ID, []int64{bob.ID, carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Conversations.GetDirect(ctx, alice.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v with only a group conversation; want ErrRecordNotFound", err)
+	}
+
+	id, err := models.Conversations.Insert(ctx, bob.ID, []int64{alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range [][2]*User{{alice, bob}, {bob, alice}} {
+		conversation, err := models.Conversations.GetDirect(ctx, tt[0].ID, tt[1].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conversation.ID != id {
+			t.Errorf("%s and %s: got conversation %s; want %s", tt[0].Username, tt[1].Username, conversation.ID, id)
+		}
+	}
+}
+
+func TestConversationMessages(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	id, err := models.Conversations.Insert(ctx, alice.ID, []int64{bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	photo := insertPhoto(t, models, alice, "beach")
+
+	first := insertMessage(t, models, id, alice, "Hi")
+	second := &Message{ConversationID: id, SenderID: alice.ID, PhotoID: &photo.ID}
+
+	err = models.Messages.Insert(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.ID == uuid.Nil || second.CreatedAt.IsZero() {
+		t.Errorf("got message %+v; want the ID and creation time set", second)
+	}
+
+	conversation, err := models.Conversations.Get(ctx, id, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := conversation.LastMessage
+	if conversation.UnreadCount != 2 || last == nil || last.ID != second.ID || last.SenderUsername != "alice" ||
+		last.PhotoID == nil || *last.PhotoID != photo.ID || !conversation.UpdatedAt.Equal(second.CreatedAt) {
+		t.Errorf("got conversation %+v with last message %+v; want two unread and the photo last", conversation, last)
+	}
+
+	// Sending a message marks the conversation read for the sender.
+	conversation, err = models.Conversations.Get(ctx, id, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.UnreadCount != 0 {
+		t.Errorf("got %d unread for the sender; want 0", conversation.UnreadCount)
+	}
+	for _, member := range conversation.Members {
+		if member.UserID == alice.ID && (member.LastReadAt == nil || !member.LastReadAt.Equal(second.CreatedAt)) {
+			t.Errorf("got alice's last read time %v; want %s", member.LastReadAt, second.CreatedAt)
+		}
+	}
+
+	messages, metadata, err := models.Messages.GetByConversationID(ctx, id, Filters{Page: 1, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != second.ID || metadata.TotalRecords != 2 || metadata.LastPage != 2 {
+		t.Errorf("got %+v and %+v; want the newest message on the first of two pages", messages, metadata)
+	}
+
+	messages, _, err = models.Messages.GetByConversationID(ctx, id, Filters{Page: 2, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != first.ID || messages[0].Content != "Hi" || messages[0].SenderUsername != "alice" {
+		t.Errorf("got %+v; want the first message", messages)
+	}
+
+	err = models.Conversations.MarkRead(ctx, id, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversation, err = models.Conversations.Get(ctx, id, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.UnreadCount != 0 {
+		t.Errorf("got %d unread after marking read; want 0", conversation.UnreadCount)
+	}
+
+	err = models.Conversations.MarkRead(ctx, uuid.New(), bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown conversation; want ErrRecordNotFound", err)
+	}
+
+	// Messages can't be sent once a member has blocked the sender.
+	insertBlock(t, models, bob, alice)
+
+	err = models.Messages.Insert(ctx, &Message{ConversationID: id, SenderID: alice.ID, Content: "Hello?"})
+	if !errors.Is(err, ErrBlocked) {
+		t.Errorf("got error %v; want ErrBlocked", err)
+	}
+}
+
+func TestConversationGetAllForUser(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	withBob, err := models.Conversations.Insert(ctx, alice.ID, []int64{bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withCarol, err := models.Conversations.Insert(ctx, alice.ID, []int64{carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Conversations.Insert(ctx, bob.ID, []int64{carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new message moves the older conversation to the top.
+	insertMessage(t, models, withBob, bob, "Hi")
+
+	conversations, metadata, err := models.Conversations.GetAllForUser(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conversations) != 2 || conversations[0].ID != withBob || conversations[1].ID != withCarol || metadata.TotalRecords != 2 {
+		t.Fatalf("got %+v and %+v; want the conversation with bob then carol", conversations, metadata)
+	}
+	if conversations[0].UnreadCount != 1 || conversations[0].LastMessage == nil || conversations[0].LastMessage.Content != "Hi" {
+		t.Errorf("got conversation %+v; want bob's message unread", conversations[0])
+	}
+
+	conversations, metadata, err = models.Conversations.GetAllForUser(ctx, alice.ID, Filters{Page: 3, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 0 || metadata != (Metadata{}) {
+		t.Errorf("got %+v and %+v past the last page; want nothing", conversations, metadata)
+	}
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exploreLockID is the advisory lock held while explore scores are
+// refreshed, so that only one instance computes each generation.
+const exploreLockID = 0x6578706c6f7265
+
+// ExploreWeights tunes the explore score of a photo, which is
+//
+//	(likes*Likes + comments*Comments) / (ageInHours + 2)^Gravity
+//
+// in the style of Hacker News. Only public photos newer than Window are
+// ranked.
+type ExploreWeights struct {
+	Likes    float64
+	Comments float64
+	Gravity  float64
+	Window   time.Duration
+}
+
+// ExploreModel ranks photos for the explore feed. Scores are computed in
+// generations: each refresh writes a complete new ranking, and clients keep
+// paging through the generation they started with so results don't shift
+// between pages.
+type ExploreModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Refresh computes a new generation of scores and deletes all but the latest
+// keep generations. It returns 0 without doing anything if another instance
+// is already refreshing. Scoring takes longer than a normal query, so it runs
+// until ctx is done instead of using the model's timeout.
+func (m ExploreModel) Refresh(ctx context.Context, weights ExploreWeights, keep int) (int64, error) {
+	var generation int64
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var locked bool
+
+		err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, exploreLockID).Scan(&locked)
+		if err != nil || !locked {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO explore_generations DEFAULT VALUES
+			RETURNING generation`).Scan(&generation)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO explore_scores (generation, photo_id, score, rank)
+			SELECT $1, s.id, s.score, row_number() OVER (ORDER BY s.score DESC, s.created_at DESC)
+			FROM (
+				SELECT p.id, p.created_at,
+					((SELECT COUNT(*) FROM likes l WHERE l.photo_id = p.id) * $2::float8
+					+ (SELECT COUNT(*) FROM comments c WHERE c.photo_id = p.id) * $3::float8)
+					/ power(EXTRACT(EPOCH FROM NOW() - p.created_at)::float8 / 3600 + 2, $4::float8) AS score
+				FROM photos p
+				JOIN users u ON p.user_id = u.id
+				WHERE NOT u.is_private AND p.created_at > NOW() - make_interval(secs => $5::float8)
+			) s`
+
+		args := []interface{}{
+			generation,
+			weights.Likes,
+			weights.Comments,
+			weights.Gravity,
+			weights.Window.Seconds(),
+		}
+
+		_, err = tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM explore_generations
+			WHERE generation <= $1 - $2`, generation, keep)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return generation, nil
+}
+
+// Get returns a page of the explore feed for a viewer from the given
+// generation, or the latest one if generation is 0, along with the generation
+// used. It returns ErrRecordNotFound if the generation has been deleted.
+// Photos that have since become hidden from the viewer are left out.
+func (m ExploreModel) Get(ctx context.Context, viewerID, generation int64, filters Filters) ([]*Photo, int64, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	if generation == 0 {
+		err := m.DB.QueryRow(ctx, `SELECT COALESCE(MAX(generation), 0) FROM explore_generations`).Scan(&generation)
+		if err != nil {
+			return nil, 0, Metadata{}, err
+		}
+
+		if generation == 0 {
+			return []*Photo{}, 0, Metadata{}, nil
+		}
+	} else {
+		err := m.DB.QueryRow(ctx, `SELECT generation FROM explore_generations WHERE generation = $1`, generation).Scan(&generation)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				return nil, 0, Metadata{}, ErrRecordNotFound
+			default:
+				return nil, 0, Metadata{}, err
+			}
+		}
+	}
+
+	query := `
+		SELECT count(*) OVER(), ` + photoColumns + `
+		FROM explore_scores e
+		JOIN photos p ON e.photo_id = p.id
+		JOIN users u ON p.user_id = u.id
+		WHERE e.generation = $1 AND ` + visibleTo("$2") + `
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $2)
+		)
+		ORDER BY e.rank
+		LIMIT $3 OFFSET $4`
+
+	photos, metadata, err := PhotoModel{DB: m.DB, Timeouts: m.Timeouts}.queryPhotoPage(ctx, query, filters, generation, viewerID)
+	if err != nil {
+		return nil, 0, Metadata{}, err
+	}
+
+	return photos, generation, metadata, nil
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testExploreWeights = ExploreWeights{Likes: 1, Comments: 1, Gravity: 1.8, Window: 24 * time.Hour}
+
+func TestExploreRefresh(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	photos, generation, metadata, err := models.Explore.Get(ctx, 0, 0, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photos == nil || len(photos) != 0 || generation != 0 || metadata != (Metadata{}) {
+		t.Errorf("got %+v, generation %d and %+v before any refresh; want nothing", photos, generation, metadata)
+	}
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	setPrivate(t, models, carol)
+
+	boring := insertPhoto(t, models, alice, "boring")
+	quiet := insertPhoto(t, models, alice, "quiet")
+	popular := insertPhoto(t, models, bob, "popular")
+	hidden := insertPhoto(t, models, carol, "hidden")
+	old := insertPhoto(t, models, bob, "old")
+
+	exec(t, `UPDATE photos SET created_at = NOW() - INTERVAL '2 days' WHERE id = $1`, old.ID)
+
+	insertLike(t, models, popular, carol)
+	insertLike(t, models, popular, dave)
+	insertLike(t, models, hidden, dave)
+	insertLike(t, models, old, dave)
+	insertComment(t, models, quiet, dave, "Nice")
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := models.Explore.Refresh(ctx, testExploreWeights, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got generation %d; want %d", got, want)
+		}
+	}
+
+	// Older generations are deleted once there are more than keep.
+	if n := count(t, `SELECT COUNT(*) FROM explore_generations`); n != 2 {
+		t.Errorf("got %d generations; want 2", n)
+	}
+
+	_, _, _, err = models.Explore.Get(ctx, dave.ID, 1, Filters{Page: 1, PageSize: 10})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for a deleted generation; want ErrRecordNotFound", err)
+	}
+
+	photos, generation, metadata, err = models.Explore.Get(ctx, dave.ID, 0, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generation != 3 || metadata.TotalRecords != 3 {
+		t.Errorf("got generation %d and %+v; want the latest with 3 records", generation, metadata)
+	}
+
+	// Private and old photos aren't ranked.
+	checkPhotos(t, photos, popular, quiet, boring)
+
+	photos, generation, _, err = models.Explore.Get(ctx, dave.ID, 2, Filters{Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generation != 2 {
+		t.Errorf("got generation %d; want 2", generation)
+	}
+	checkPhotos(t, photos, boring)
+}
+
+func TestExploreGetHidden(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	alices := insertPhoto(t, models, alice, "beach")
+	bobs := insertPhoto(t, models, bob, "forest")
+
+	generation, err := models.Explore.Refresh(ctx, testExploreWeights, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made after the refresh still hide photos.
+	insertBlock(t, models, dave, bob)
+	setPrivate(t, models, alice)
+	insertFollow(t, models, carol, alice)
+
+	// Neither photo has any likes or comments, so the newest ranks first.
+	tests := []struct {
+		name   string
+		viewer *User
+		want   []*Photo
+	}{
+		{"owner", alice, []*Photo{bobs, alices}},
+		{"follower", carol, []*Photo{bobs, alices}},
+		{"blocked", bob, []*Photo{bobs}},
+		{"blocker", dave, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photos, _, _, err := models.Explore.Get(ctx, tt.viewer.ID, generation, Filters{Page: 1, PageSize: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPhotos(t, photos, tt.want...)
+		})
+	}
+}
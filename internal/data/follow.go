@@ -0,0 +1,223 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrDuplicateFollow        = errors.New("already following")
+	ErrDuplicateFollowRequest = errors.New("already requested to follow")
+)
+
+// Follow is an accepted follow, or a pending request to follow a private
+// user. Only accepted follows are stored in the follows table, so the
+// visibility checks that look there don't count pending requests.
+type Follow struct {
+	FollowerID int64     `json:"follower_id"`
+	FolloweeID int64     `json:"followee_id"`
+	Pending    bool      `json:"pending"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowRequest is a pending request to follow a private user.
+type FollowRequest struct {
+	RequesterID int64     `json:"requester_id"`
+	Username    string    `json:"username"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FollowModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert records that one user follows another. Following a private user
+// only records a request, which the user must approve, and sets
+// follow.Pending. It returns ErrRecordNotFound if the followee doesn't exist,
+// ErrBlocked if either user has blocked the other, and ErrDuplicateFollow or
+// ErrDuplicateFollowRequest if the follower already follows the followee or
+// has already asked to.
+func (m FollowModel) Insert(ctx context.Context, follow *Follow) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var private, blocked, following bool
+
+		err := tx.QueryRow(ctx, `
+			SELECT u.is_private,
+				EXISTS (
+					SELECT 1 FROM blocks
+					WHERE (blocker_id = $1 AND blocked_id = u.id) OR (blocker_id = u.id AND blocked_id = $1)
+				),
+				EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = u.id)
+			FROM users u
+			WHERE u.id = $2`,
+			follow.FollowerID, follow.FolloweeID).Scan(&private, &blocked, &following)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case blocked:
+			return ErrBlocked
+		case following:
+			return ErrDuplicateFollow
+		}
+
+		if private {
+			follow.Pending = true
+			return tx.QueryRow(ctx, `
+				INSERT INTO follow_requests (requester_id, target_id)
+				VALUES ($1, $2)
+				RETURNING created_at`,
+				follow.FollowerID, follow.FolloweeID).Scan(&follow.CreatedAt)
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO follows (follower_id, followee_id)
+			VALUES ($1, $2)
+			RETURNING created_at`,
+			follow.FollowerID, follow.FolloweeID).Scan(&follow.CreatedAt)
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && follow.Pending:
+			return ErrDuplicateFollowRequest
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return ErrDuplicateFollow
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a follow, or withdraws a pending request to follow. It
+// returns ErrRecordNotFound if the follower was doing neither.
+func (m FollowModel) Delete(ctx context.Context, followerID, followeeID int64) error {
+	query := `
+		WITH deleted_follow AS (
+			DELETE FROM follows
+			WHERE follower_id = $1 AND followee_id = $2
+			RETURNING 1
+		), deleted_request AS (
+			DELETE FROM follow_requests
+			WHERE requester_id = $1 AND target_id = $2
+			RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM deleted_follow) + (SELECT count(*) FROM deleted_request)`
+
+	var deleted int
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, followerID, followeeID).Scan(&deleted)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetRequests returns the pending requests to follow a user, oldest first.
+func (m FollowModel) GetRequests(ctx context.Context, targetID int64, filters Filters) ([]*FollowRequest, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), r.requester_id, u.username, r.created_at
+		FROM follow_requests r
+		JOIN users u ON r.requester_id = u.id
+		WHERE r.target_id = $1
+		ORDER BY r.created_at, r.requester_id
+		LIMIT $2 OFFSET $3`
+
+	args := []interface{}{targetID, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	requests := []*FollowRequest{}
+
+	for rows.Next() {
+		var request FollowRequest
+		err := rows.Scan(&totalRecords, &request.RequesterID, &request.Username, &request.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		requests = append(requests, &request)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return requests, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Approve turns a pending request to follow targetID into a follow. It
+// returns ErrRecordNotFound if there is no such request.
+func (m FollowModel) Approve(ctx context.Context, targetID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			DELETE FROM follow_requests
+			WHERE requester_id = $1 AND target_id = $2`,
+			requesterID, targetID)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected() == 0 {
+			return ErrRecordNotFound
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO follows (follower_id, followee_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`,
+			requesterID, targetID)
+		return err
+	})
+}
+
+// Decline removes a pending request to follow targetID. It returns
+// ErrRecordNotFound if there is no such request.
+func (m FollowModel) Decline(ctx context.Context, targetID, requesterID int64) error {
+	query := `
+		DELETE FROM follow_requests
+		WHERE requester_id = $1 AND target_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, requesterID, targetID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFollowInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	follow := &Follow{FollowerID: alice.ID, FolloweeID: bob.ID}
+
+	err := models.Follows.Insert(ctx, follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if follow.CreatedAt.IsZero() {
+		t.Error("creation time was not set")
+	}
+
+	insertBlock(t, models, carol, alice)
+
+	tests := []struct {
+		name       string
+		followerID int64
+		followeeID int64
+		want       error
+	}{
+		{"duplicate", alice.ID, bob.ID, ErrDuplicateFollow},
+		{"blocked by followee", alice.ID, carol.ID, ErrBlocked},
+		{"blocked followee", carol.ID, alice.ID, ErrBlocked},
+		{"unknown followee", alice.ID, carol.ID + 1, ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.Follows.Insert(ctx, &Follow{FollowerID: tt.followerID, FolloweeID: tt.followeeID})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Following back is a separate follow.
+	insertFollow(t, models, bob, alice)
+
+	if n := count(t, `SELECT COUNT(*) FROM follows`); n != 2 {
+		t.Errorf("got %d follows; want 2", n)
+	}
+}
+
+func TestFollowDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	insertFollow(t, models, alice, bob)
+	insertFollow(t, models, bob, alice)
+
+	err := models.Follows.Delete(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Follows.Delete(ctx, alice.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v unfollowing twice; want ErrRecordNotFound", err)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM follows WHERE follower_id = $1 AND followee_id = $2`, bob.ID, alice.ID); n != 1 {
+		t.Error("the follow in the other direction was removed")
+	}
+}
+
+func TestFollowRequests(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	setPrivate(t, models, alice)
+
+	follow := &Follow{FollowerID: bob.ID, FolloweeID: alice.ID}
+
+	err := models.Follows.Insert(ctx, follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !follow.Pending {
+		t.Error("following a private user was not pending")
+	}
+	if n := count(t, `SELECT COUNT(*) FROM follows`); n != 0 {
+		t.Errorf("got %d follows before approval; want 0", n)
+	}
+
+	err = models.Follows.Insert(ctx, &Follow{FollowerID: bob.ID, FolloweeID: alice.ID})
+	if !errors.Is(err, ErrDuplicateFollowRequest) {
+		t.Errorf("got error %v asking twice; want ErrDuplicateFollowRequest", err)
+	}
+
+	err = models.Follows.Insert(ctx, &Follow{FollowerID: carol.ID, FolloweeID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, metadata, err := models.Follows.GetRequests(ctx, alice.ID, Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[0].Username != "bob" || requests[1].Username != "carol" || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d requests (%+v); want bob's and carol's", len(requests), metadata)
+	}
+
+	err = models.Follows.Approve(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Follows.Approve(ctx, alice.ID, bob.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v approving twice; want ErrRecordNotFound", err)
+	}
+
+	err = models.Follows.Decline(ctx, alice.ID, carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Follows.Decline(ctx, alice.ID, carol.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v declining twice; want ErrRecordNotFound", err)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM follows WHERE follower_id = $1 AND followee_id = $2`, bob.ID, alice.ID); n != 1 {
+		t.Error("the approved request didn't become a follow")
+	}
+	if n := count(t, `SELECT COUNT(*) FROM follow_requests`); n != 0 {
+		t.Errorf("got %d requests left; want 0", n)
+	}
+
+	// Withdrawing a request deletes it like an unfollow.
+	err = models.Follows.Insert(ctx, &Follow{FollowerID: carol.ID, FolloweeID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Follows.Delete(ctx, carol.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM follow_requests`); n != 0 {
+		t.Errorf("got %d requests after withdrawing; want 0", n)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,26 +15,37 @@ type Like struct {
 	ID        uuid.UUID `json:"id"`
 	PhotoID   uuid.UUID `json:"photo_id"`
 	UserID    int64     `json:"user_id"`
+	Reaction  string    `json:"reaction"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type LikeModelInterface interface {
+	Insert(ctx context.Context, like *Like) error
+	Upsert(ctx context.Context, like *Like) (bool, error)
+	Delete(ctx context.Context, photoID uuid.UUID, userID int64) error
+	GetLikesCount(ctx context.Context, photoID uuid.UUID) (int, error)
+}
+
 type LikeModel struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
 }
 
 var ErrDuplicateLike = errors.New("post already liked")
 
-func (m LikeModel) Insert(like *Like) error {
+// Insert adds a reaction, returning ErrDuplicateLike if the user has already
+// reacted to the photo.
+func (m LikeModel) Insert(ctx context.Context, like *Like) error {
 	query := `
-		INSERT INTO likes (photo_id, user_id)
-		SELECT $1, $2
+		INSERT INTO likes (photo_id, user_id, reaction)
+		SELECT $1, $2, $3
 		WHERE NOT EXISTS (
 			SELECT 1 FROM likes WHERE photo_id = $1 AND user_id = $2
 		)
 		RETURNING id, created_at`
 
-	args := []interface{}{like.PhotoID, like.UserID}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []interface{}{like.PhotoID, like.UserID, like.Reaction}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	err := m.DB.QueryRow(ctx, query, args...).Scan(&like.ID, &like.CreatedAt)
@@ -46,25 +58,53 @@ func (m LikeModel) Insert(like *Like) error {
 	return nil
 }
 
-func (m LikeModel) Delete(photoID uuid.UUID, userID int64) error {
+// Upsert sets the user's reaction to a photo, replacing any earlier one. It
+// reports whether the user hadn't reacted before, and returns
+// ErrRecordNotFound if the photo doesn't exist.
+func (m LikeModel) Upsert(ctx context.Context, like *Like) (bool, error) {
+	query := `
+		INSERT INTO likes (photo_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (photo_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction
+		RETURNING id, created_at, xmax = 0`
+
+	var inserted bool
+	args := []interface{}{like.PhotoID, like.UserID, like.Reaction}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&like.ID, &like.CreatedAt, &inserted)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+	return inserted, nil
+}
+
+func (m LikeModel) Delete(ctx context.Context, photoID uuid.UUID, userID int64) error {
 	query := `
 		DELETE FROM likes
 		WHERE photo_id = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	_, err := m.DB.Exec(ctx, query, photoID, userID)
 	return err
 }
 
-func (m LikeModel) GetLikesCount(photoID uuid.UUID) (int, error) {
+func (m LikeModel) GetLikesCount(ctx context.Context, photoID uuid.UUID) (int, error) {
 	query := `
 		SELECT COUNT(*) FROM likes
 		WHERE photo_id = $1`
 
 	var count int
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
 	err := m.DB.QueryRow(ctx, query, photoID).Scan(&count)
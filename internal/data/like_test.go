@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestLikeInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	like := &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: "love"}
+
+	err := models.Likes.Insert(ctx, like)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if like.ID == uuid.Nil || like.CreatedAt.IsZero() {
+		t.Errorf("got like %+v; want the ID and creation time set", like)
+	}
+
+	// Any earlier reaction counts as a like, whatever its type.
+	err = models.Likes.Insert(ctx, &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: DefaultReaction})
+	if !errors.Is(err, ErrDuplicateLike) {
+		t.Errorf("got error %v; want ErrDuplicateLike", err)
+	}
+
+	err = models.Likes.Insert(ctx, &Like{PhotoID: photo.ID, UserID: alice.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := models.Photos.GetByID(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Reactions) != 2 || got.Reactions["love"] != 1 || got.Reactions[DefaultReaction] != 1 {
+		t.Errorf("got reactions %v; want one love and one like", got.Reactions)
+	}
+
+	var pgErr *pgconn.PgError
+	err = models.Likes.Insert(ctx, &Like{PhotoID: uuid.New(), UserID: bob.ID, Reaction: DefaultReaction})
+	if !errors.As(err, &pgErr) || pgErr.Code != "23503" {
+		t.Errorf("got error %v liking an unknown photo; want a foreign key violation", err)
+	}
+}
+
+func TestLikeUpsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	first := &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: "love"}
+
+	inserted, err := models.Likes.Upsert(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Error("got inserted false for a first reaction")
+	}
+
+	second := &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: "haha"}
+
+	inserted, err = models.Likes.Upsert(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted {
+		t.Error("got inserted true for a changed reaction")
+	}
+	if second.ID != first.ID {
+		t.Errorf("got like %s; want the existing like %s", second.ID, first.ID)
+	}
+
+	got, err := models.Photos.GetByID(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Reactions) != 1 || got.Reactions["haha"] != 1 {
+		t.Errorf("got reactions %v; want a single haha", got.Reactions)
+	}
+
+	_, err = models.Likes.Upsert(ctx, &Like{PhotoID: uuid.New(), UserID: bob.ID, Reaction: "love"})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown photo; want ErrRecordNotFound", err)
+	}
+}
+
+func TestLikeDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	for _, user := range []*User{alice, bob} {
+		err := models.Likes.Insert(ctx, &Like{PhotoID: photo.ID, UserID: user.ID, Reaction: DefaultReaction})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := models.Likes.GetLikesCount(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d likes; want 2", n)
+	}
+
+	// Deleting twice is not an error.
+	for range 2 {
+		err := models.Likes.Delete(ctx, photo.ID, bob.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err = models.Likes.GetLikesCount(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d likes after unliking; want 1", n)
+	}
+
+	n, err = models.Likes.GetLikesCount(ctx, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d likes for an unknown photo; want 0", n)
+	}
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginPolicy controls how failed logins slow down further attempts. After
+// FreeAttempts consecutive failures each attempt must wait twice as long as
+// the last, starting at one second, and after MaxFailures attempts are locked
+// out for Lockout. Failures are forgotten once none have happened for Window.
+type LoginPolicy struct {
+	FreeAttempts int
+	MaxFailures  int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// Delay returns how long to wait after the given number of consecutive
+// failures.
+func (p LoginPolicy) Delay(failures int) time.Duration {
+	switch {
+	case failures >= p.MaxFailures:
+		return p.Lockout
+	case failures <= p.FreeAttempts:
+		return 0
+	}
+
+	shift := min(failures-p.FreeAttempts-1, 30)
+	return min(time.Second<<shift, p.Lockout)
+}
+
+// LoginKey is a key that login attempts are counted against, with the policy
+// that applies to it.
+type LoginKey struct {
+	Key    string
+	Policy LoginPolicy
+}
+
+type LoginFailureModelInterface interface {
+	Reserve(ctx context.Context, keys ...LoginKey) (time.Duration, []time.Duration, error)
+	Reset(ctx context.Context, keys ...string) error
+	Release(ctx context.Context, key LoginKey) error
+	DeleteExpired(ctx context.Context, window time.Duration) error
+}
+
+// LoginFailureModel counts consecutive failed logins. Counters are keyed by
+// strings such as "email:<address>" or "ip:<address>", so that attempts can
+// be limited both per account and per client.
+type LoginFailureModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Reserve counts a login attempt as a failure against each key before the
+// password is checked, so that concurrent guesses can't all slip in before
+// the first failure is recorded, and Reset forgets it if the login succeeds.
+// If any key is still waiting out an earlier failure, nothing is counted and
+// it returns how long the caller must wait. Otherwise it returns 0 and the
+// delay each key is now under, in the order given.
+func (m LoginFailureModel) Reserve(ctx context.Context, keys ...LoginKey) (time.Duration, []time.Duration, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Key
+	}
+
+	var wait time.Duration
+	var delays []time.Duration
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		// Make sure every key has a row to lock, so that concurrent attempts
+		// for a new key wait for each other too.
+		_, err := tx.Exec(ctx, `
+			INSERT INTO login_failures (key, failures, last_failure_at, locked_until)
+			SELECT unnest($1::text[]), 0, NOW(), NOW()
+			ON CONFLICT (key) DO NOTHING`, names)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT key, failures,
+				EXTRACT(EPOCH FROM NOW() - last_failure_at)::float8,
+				GREATEST(EXTRACT(EPOCH FROM locked_until - NOW()), 0)::float8
+			FROM login_failures
+			WHERE key = ANY($1)
+			ORDER BY key
+			FOR UPDATE`, names)
+		if err != nil {
+			return err
+		}
+
+		type counter struct {
+			failures int
+			idle     time.Duration
+		}
+
+		counters := make(map[string]counter, len(keys))
+		for rows.Next() {
+			var key string
+			var c counter
+			var idle, locked float64
+			err := rows.Scan(&key, &c.failures, &idle, &locked)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			c.idle = time.Duration(idle * float64(time.Second))
+			counters[key] = c
+			wait = max(wait, time.Duration(locked*float64(time.Second)))
+		}
+		rows.Close()
+
+		err = rows.Err()
+		if err != nil || wait > 0 {
+			return err
+		}
+
+		for _, key := range keys {
+			c := counters[key.Key]
+
+			failures := c.failures + 1
+			if c.idle > key.Policy.Window {
+				failures = 1
+			}
+
+			delay := key.Policy.Delay(failures)
+			delays = append(delays, delay)
+
+			_, err := tx.Exec(ctx, `
+				UPDATE login_failures
+				SET failures = $2, last_failure_at = NOW(), locked_until = NOW() + make_interval(secs => $3::float8)
+				WHERE key = $1`, key.Key, failures, delay.Seconds())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return wait, delays, nil
+}
+
+// Reset forgets the failures counted against the keys.
+func (m LoginFailureModel) Reset(ctx context.Context, keys ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, `DELETE FROM login_failures WHERE key = ANY($1)`, keys)
+	return err
+}
+
+// Release takes back the failure Reserve counted against key for an attempt
+// that turned out to succeed, keeping any earlier failures. The delay is
+// shortened to match, but not extended.
+func (m LoginFailureModel) Release(ctx context.Context, key LoginKey) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var failures int
+
+		err := tx.QueryRow(ctx, `
+			SELECT failures FROM login_failures
+			WHERE key = $1
+			FOR UPDATE`, key.Key).Scan(&failures)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		failures = max(failures-1, 0)
+
+		_, err = tx.Exec(ctx, `
+			UPDATE login_failures
+			SET failures = $2, locked_until = LEAST(locked_until, last_failure_at + make_interval(secs => $3::float8))
+			WHERE key = $1`, key.Key, failures, key.Policy.Delay(failures).Seconds())
+		return err
+	})
+}
+
+// DeleteExpired removes counters that no longer affect logins: those that
+// aren't locked and have had no failures for window. The deadline is left to
+// ctx, as the table may have grown large since the last cleanup.
+func (m LoginFailureModel) DeleteExpired(ctx context.Context, window time.Duration) error {
+	query := `
+		DELETE FROM login_failures
+		WHERE locked_until < NOW() AND last_failure_at < NOW() - make_interval(secs => $1::float8)`
+
+	_, err := m.DB.Exec(ctx, query, window.Seconds())
+	return err
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testLoginPolicy = LoginPolicy{FreeAttempts: 2, MaxFailures: 5, Lockout: time.Hour, Window: 24 * time.Hour}
+
+// unlock lifts the delays on every counter, so that further attempts are
+// counted rather than refused.
+func unlock(t *testing.T) {
+	t.Helper()
+	exec(t, `UPDATE login_failures SET locked_until = NOW()`)
+}
+
+func TestLoginFailureReserve(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	key := LoginKey{Key: "email:alice@example.com", Policy: testLoginPolicy}
+
+	for _, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, time.Hour, time.Hour} {
+		wait, delays, err := models.LoginFailures.Reserve(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 || len(delays) != 1 || delays[0] != want {
+			t.Errorf("got a wait of %s and delays %v; want none and %s", wait, delays, want)
+		}
+		unlock(t)
+	}
+
+	if n := count(t, `SELECT failures FROM login_failures WHERE key = $1`, key.Key); n != 6 {
+		t.Errorf("got %d failures; want 6", n)
+	}
+
+	// Failures are forgotten once none have happened for the window.
+	exec(t, `UPDATE login_failures SET last_failure_at = NOW() - INTERVAL '25 hours'`)
+
+	_, delays, err := models.LoginFailures.Reserve(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delays) != 1 || delays[0] != 0 {
+		t.Errorf("got delays %v after the window; want none", delays)
+	}
+	if n := count(t, `SELECT failures FROM login_failures WHERE key = $1`, key.Key); n != 1 {
+		t.Errorf("got %d failures after the window; want 1", n)
+	}
+}
+
+func TestLoginFailureReserveLocked(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	email := LoginKey{Key: "email:alice@example.com", Policy: testLoginPolicy}
+	ip := LoginKey{Key: "ip:192.0.2.1", Policy: testLoginPolicy}
+
+	for range testLoginPolicy.MaxFailures - 1 {
+		_, _, err := models.LoginFailures.Reserve(ctx, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlock(t)
+	}
+
+	_, _, err := models.LoginFailures.Reserve(ctx, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attempts are refused while any key is locked, without being counted.
+	wait, delays, err := models.LoginFailures.Reserve(ctx, email, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= testLoginPolicy.Lockout-time.Minute || wait > testLoginPolicy.Lockout || delays != nil {
+		t.Errorf("got a wait of %s and delays %v; want about %s and none", wait, delays, testLoginPolicy.Lockout)
+	}
+
+	if n := count(t, `SELECT failures FROM login_failures WHERE key = $1`, email.Key); n != 0 {
+		t.Errorf("got %d failures for the refused key; want 0", n)
+	}
+
+	err = models.LoginFailures.Reset(ctx, email.Key, ip.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait, delays, err = models.LoginFailures.Reserve(ctx, email, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 0 || len(delays) != 2 || delays[0] != 0 || delays[1] != 0 {
+		t.Errorf("got a wait of %s and delays %v after resetting; want none", wait, delays)
+	}
+}
+
+func TestLoginFailureRelease(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	key := LoginKey{Key: "ip:192.0.2.1", Policy: testLoginPolicy}
+
+	for range testLoginPolicy.FreeAttempts + 1 {
+		_, _, err := models.LoginFailures.Reserve(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Taking back the last attempt lifts the delay it added, but keeps the
+	// failures before it.
+	err := models.LoginFailures.Release(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, `SELECT failures FROM login_failures WHERE key = $1`, key.Key); n != testLoginPolicy.FreeAttempts {
+		t.Errorf("got %d failures; want %d", n, testLoginPolicy.FreeAttempts)
+	}
+
+	wait, _, err := models.LoginFailures.Reserve(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 0 {
+		t.Errorf("got a wait of %s after releasing; want none", wait)
+	}
+
+	err = models.LoginFailures.Release(ctx, LoginKey{Key: "ip:192.0.2.2", Policy: testLoginPolicy})
+	if err != nil {
+		t.Errorf("got error %v releasing an unknown key; want none", err)
+	}
+}
+
+func TestLoginFailureDeleteExpired(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"recent", "locked", "expired"} {
+		_, _, err := models.LoginFailures.Reserve(ctx, LoginKey{Key: key, Policy: testLoginPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exec(t, `UPDATE login_failures SET last_failure_at = NOW() - INTERVAL '2 days' WHERE key <> 'recent'`)
+	exec(t, `UPDATE login_failures SET locked_until = NOW() + INTERVAL '1 hour' WHERE key = 'locked'`)
+
+	err := models.LoginFailures.DeleteExpired(ctx, testLoginPolicy.Window)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]int{"recent": 1, "locked": 1, "expired": 0} {
+		if n := count(t, `SELECT COUNT(*) FROM login_failures WHERE key = $1`, key); n != want {
+			t.Errorf("got %d counters for %s; want %d", n, key, want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// memoryStore holds the tables of the in-memory backend. A single lock guards
+// all of them, so that operations touching several tables are atomic like the
+// transactions they stand in for. Rows are kept in insertion order.
+type memoryStore struct {
+	mu sync.Mutex
+
+	nextUserID    int64
+	users         []*User
+	tokens        []*Token
+	photos        []*memoryPhoto
+	blobs         map[string]int
+	likes         []*Like
+	comments      []*Comment
+	mentions      []*memoryMention
+	notifications []*memoryNotification
+	loginFailures map[string]*memoryLoginFailure
+	nextBannedID  int64
+	bannedHashes  []*BannedHash
+}
+
+type memoryPhoto struct {
+	Photo
+	pinnedCommentID *uuid.UUID
+}
+
+type memoryMention struct {
+	Mention
+	authorID  int64
+	photoID   uuid.UUID
+	commentID *uuid.UUID
+}
+
+type memoryNotification struct {
+	Notification
+	groupKey string
+	read     bool
+}
+
+type memoryLoginFailure struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// NewMemoryModels returns models that keep their data in memory instead of
+// Postgres, for testing handlers without a database. They follow the
+// semantics of the Postgres models, including their errors, and deleting a
+// photo removes its likes, comments, mentions and notifications as the
+// foreign keys would. The backend has no follows or blocks, so private users'
+// photos are only visible to the users themselves.
+//
+// Only the models that are interfaces in Models are provided. The others are
+// left unset and must not be used.
+func NewMemoryModels() Models {
+	s := &memoryStore{
+		blobs:         map[string]int{},
+		loginFailures: map[string]*memoryLoginFailure{},
+	}
+
+	return Models{
+		Users:         memoryUserModel{s},
+		Tokens:        memoryTokenModel{s},
+		Photos:        memoryPhotoModel{s},
+		Likes:         memoryLikeModel{s},
+		Comments:      memoryCommentModel{s},
+		Notifications: memoryNotificationModel{s},
+		Mentions:      memoryMentionModel{s},
+		LoginFailures: memoryLoginFailureModel{s},
+		BannedHashes:  memoryBannedHashModel{s},
+	}
+}
+
+// foreignKeyViolation returns the error Postgres reports when a row refers to
+// one that doesn't exist.
+func foreignKeyViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23503",
+		Message:        `insert or update violates foreign key constraint "` + constraint + `"`,
+		ConstraintName: constraint,
+	}
+}
+
+// newestFirst sorts rows by their creation time, newest first. Rows created
+// at the same time are put in reverse insertion order.
+func newestFirst[T any](rows []T, createdAt func(T) time.Time) {
+	slices.Reverse(rows)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return createdAt(rows[i]).After(createdAt(rows[j]))
+	})
+}
+
+func (s *memoryStore) user(id int64) *User {
+	for _, user := range s.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) username(id int64) string {
+	if user := s.user(id); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+type memoryUserModel struct {
+	s *memoryStore
+}
+
+// checkUnique returns the error Insert and Update give when another user has
+// the same username or email. Postgres checks the username first, as its
+// constraint was created first.
+func (m memoryUserModel) checkUnique(user *User) error {
+	for _, other := range m.s.users {
+		if other.ID != user.ID && other.Username == user.Username {
+			return ErrDuplicateUsername
+		}
+	}
+	for _, other := range m.s.users {
+		if other.ID != user.ID && other.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+	return nil
+}
+
+func (m memoryUserModel) Insert(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	err := m.checkUnique(&User{Username: user.Username, Email: user.Email})
+	if err != nil {
+		return err
+	}
+
+	m.s.nextUserID++
+	user.ID = m.s.nextUserID
+	user.CreatedAt = time.Now()
+
+	m.s.users = append(m.s.users, &User{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		Username:  user.Username,
+		Email:     user.Email,
+		Password:  password{hash: user.Password.hash},
+	})
+	return nil
+}
+
+func (m memoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, user := range m.s.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryUserModel) Authenticate(ctx context.Context, email, plaintextPassword string) (*User, error) {
+	user, err := m.GetByEmail(ctx, email)
+	if err != nil {
+		dummy := password{hash: dummyPasswordHash()}
+		_, err := dummy.Matches(plaintextPassword)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	match, err := user.Password.Matches(plaintextPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (m memoryUserModel) GetByID(ctx context.Context, id int64) (*User, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	user := m.s.user(id)
+	if user == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (m memoryUserModel) Update(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored := m.s.user(user.ID)
+	if stored == nil {
+		return nil
+	}
+
+	err := m.checkUnique(user)
+	if err != nil {
+		return err
+	}
+
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.Password = password{hash: user.Password.hash}
+	stored.AltTextReminders = user.AltTextReminders
+	stored.IsPrivate = user.IsPrivate
+	return nil
+}
+
+func (m memoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, token := range m.s.tokens {
+		if string(token.Hash) == string(tokenHash[:]) && token.Scope == tokenScope && token.Expiry.After(time.Now()) {
+			if user := m.s.user(token.UserID); user != nil {
+				found := *user
+				return &found, nil
+			}
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+type memoryTokenModel struct {
+	s *memoryStore
+}
+
+func (m memoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if m.s.user(token.UserID) == nil {
+		return foreignKeyViolation("tokens_user_id_fkey")
+	}
+
+	stored := *token
+	m.s.tokens = append(m.s.tokens, &stored)
+	return nil
+}
+
+func (m memoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.tokens = slices.DeleteFunc(m.s.tokens, func(token *Token) bool {
+		return token.Scope == scope && token.UserID == userID
+	})
+	return nil
+}
+
+type memoryLoginFailureModel struct {
+	s *memoryStore
+}
+
+func (m memoryLoginFailureModel) Reserve(ctx context.Context, keys ...LoginKey) (time.Duration, []time.Duration, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := time.Now()
+
+	var wait time.Duration
+	for _, key := range keys {
+		if failure, ok := m.s.loginFailures[key.Key]; ok && failure.lockedUntil.After(now) {
+			wait = max(wait, failure.lockedUntil.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return wait, nil, nil
+	}
+
+	var delays []time.Duration
+	for _, key := range keys {
+		failure, ok := m.s.loginFailures[key.Key]
+		switch {
+		case !ok:
+			failure = &memoryLoginFailure{failures: 1}
+			m.s.loginFailures[key.Key] = failure
+		case failure.lastFailureAt.Before(now.Add(-key.Policy.Window)):
+			failure.failures = 1
+		default:
+			failure.failures++
+		}
+
+		delay := key.Policy.Delay(failure.failures)
+		failure.lastFailureAt = now
+		failure.lockedUntil = now.Add(delay)
+		delays = append(delays, delay)
+	}
+
+	return 0, delays, nil
+}
+
+func (m memoryLoginFailureModel) Reset(ctx context.Context, keys ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.s.loginFailures, key)
+	}
+	return nil
+}
+
+func (m memoryLoginFailureModel) Release(ctx context.Context, key LoginKey) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	failure, ok := m.s.loginFailures[key.Key]
+	if !ok {
+		return nil
+	}
+
+	failure.failures = max(failure.failures-1, 0)
+	lockedUntil := failure.lastFailureAt.Add(key.Policy.Delay(failure.failures))
+	if lockedUntil.Before(failure.lockedUntil) {
+		failure.lockedUntil = lockedUntil
+	}
+	return nil
+}
+
+func (m memoryLoginFailureModel) DeleteExpired(ctx context.Context, window time.Duration) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := time.Now()
+	for key, failure := range m.s.loginFailures {
+		if failure.lockedUntil.Before(now) && failure.lastFailureAt.Before(now.Add(-window)) {
+			delete(m.s.loginFailures, key)
+		}
+	}
+	return nil
+}
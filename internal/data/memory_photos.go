@@ -0,0 +1,734 @@
+package data
+
+import (
+	"context"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// earthRadius is the radius in metres used by the Postgres earthdistance
+// module.
+const earthRadius = 6378168
+
+func (s *memoryStore) photo(id uuid.UUID) *memoryPhoto {
+	for _, photo := range s.photos {
+		if photo.ID == id {
+			return photo
+		}
+	}
+	return nil
+}
+
+// visible mirrors visibleTo, except that there are no followers.
+func (s *memoryStore) visible(photo *memoryPhoto, viewerID int64) bool {
+	owner := s.user(photo.UserID)
+	return owner == nil || !owner.IsPrivate || owner.ID == viewerID
+}
+
+// photoRow returns a copy of photo with the columns Postgres computes from
+// other tables filled in.
+func (s *memoryStore) photoRow(photo *memoryPhoto) *Photo {
+	row := photo.Photo
+	row.Username = s.username(photo.UserID)
+	row.Mentions = s.mentionsOf(photo.ID, nil)
+	row.Reactions = ReactionCounts{}
+	for _, like := range s.likes {
+		if like.PhotoID == photo.ID {
+			row.Reactions[like.Reaction]++
+		}
+	}
+	return &row
+}
+
+// photoRows returns the photos matching keep, newest first.
+func (s *memoryStore) photoRows(keep func(*memoryPhoto) bool) []*Photo {
+	var matched []*memoryPhoto
+	for _, photo := range s.photos {
+		if keep(photo) {
+			matched = append(matched, photo)
+		}
+	}
+
+	newestFirst(matched, func(p *memoryPhoto) time.Time { return p.CreatedAt })
+
+	var photos []*Photo
+	for _, photo := range matched {
+		photos = append(photos, s.photoRow(photo))
+	}
+	return photos
+}
+
+func (s *memoryStore) mentionsOf(photoID uuid.UUID, commentID *uuid.UUID) []Mention {
+	mentions := []Mention{}
+	for _, mention := range s.mentions {
+		if mention.photoID == photoID && sameID(mention.commentID, commentID) {
+			found := mention.Mention
+			found.Username = s.username(mention.UserID)
+			mentions = append(mentions, found)
+		}
+	}
+
+	sort.SliceStable(mentions, func(i, j int) bool {
+		return mentions[i].Offset < mentions[j].Offset
+	})
+	return mentions
+}
+
+// sameID compares nullable IDs like IS NOT DISTINCT FROM.
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type memoryPhotoModel struct {
+	s *memoryStore
+}
+
+func (m memoryPhotoModel) Insert(ctx context.Context, photo *Photo) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if m.s.user(photo.UserID) == nil {
+		return foreignKeyViolation("photos_user_id_fkey")
+	}
+
+	if photo.ContentHash != "" {
+		m.s.blobs[photo.ContentHash]++
+	}
+
+	photo.ID = uuid.New()
+	photo.CreatedAt = time.Now()
+
+	stored := &memoryPhoto{Photo: *photo}
+	stored.Username = ""
+	stored.Mentions = nil
+	stored.Reactions = nil
+	m.s.photos = append(m.s.photos, stored)
+	return nil
+}
+
+func (m memoryPhotoModel) GetByID(ctx context.Context, id uuid.UUID) (*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(id)
+	if photo == nil {
+		return nil, pgx.ErrNoRows
+	}
+	return m.s.photoRow(photo), nil
+}
+
+func (m memoryPhotoModel) GetVisible(ctx context.Context, id uuid.UUID, viewerID int64) (*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(id)
+	if photo == nil || !m.s.visible(photo, viewerID) {
+		return nil, pgx.ErrNoRows
+	}
+	return m.s.photoRow(photo), nil
+}
+
+func (m memoryPhotoModel) GetByUserAndHash(ctx context.Context, userID int64, contentHash string) (*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photos := m.s.photoRows(func(p *memoryPhoto) bool {
+		return p.UserID == userID && p.ContentHash == contentHash
+	})
+	if len(photos) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return photos[0], nil
+}
+
+func (m memoryPhotoModel) GetByUserID(ctx context.Context, userID int64) ([]*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return m.s.photoRows(func(p *memoryPhoto) bool {
+		return p.UserID == userID
+	}), nil
+}
+
+func (m memoryPhotoModel) Search(ctx context.Context, query string, viewerID int64) ([]*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), query)
+	}
+
+	return m.s.photoRows(func(p *memoryPhoto) bool {
+		return (contains(p.Caption) || contains(p.AltText) || contains(m.s.username(p.UserID))) && m.s.visible(p, viewerID)
+	}), nil
+}
+
+func (m memoryPhotoModel) GetAll(ctx context.Context, viewerID int64) ([]*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return m.s.photoRows(func(p *memoryPhoto) bool {
+		return m.s.visible(p, viewerID)
+	}), nil
+}
+
+func (m memoryPhotoModel) Update(ctx context.Context, photo *Photo) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if stored := m.s.photo(photo.ID); stored != nil {
+		stored.Caption = photo.Caption
+		stored.AltText = photo.AltText
+	}
+	return nil
+}
+
+// distance returns the great-circle distance in metres between two points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func (m memoryPhotoModel) GetNearby(ctx context.Context, latitude, longitude, radius float64, limit int, viewerID int64) ([]*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	distanceTo := func(p *Photo) float64 {
+		return distance(latitude, longitude, *p.Latitude, *p.Longitude)
+	}
+
+	photos := m.s.photoRows(func(p *memoryPhoto) bool {
+		return p.Latitude != nil && p.Longitude != nil && distanceTo(&p.Photo) <= radius && m.s.visible(p, viewerID)
+	})
+
+	sort.SliceStable(photos, func(i, j int) bool {
+		return distanceTo(photos[i]) < distanceTo(photos[j])
+	})
+	return photos[:min(len(photos), limit)], nil
+}
+
+func (m memoryPhotoModel) GetSimilar(ctx context.Context, id uuid.UUID, maxDistance, limit int, viewerID int64) ([]*Photo, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	source := m.s.photo(id)
+	if source == nil || source.PHash == nil {
+		return nil, nil
+	}
+
+	hashDistance := func(p *Photo) int {
+		return bits.OnesCount64(uint64(*p.PHash ^ *source.PHash))
+	}
+
+	photos := m.s.photoRows(func(p *memoryPhoto) bool {
+		return p.ID != id && p.PHash != nil && hashDistance(&p.Photo) <= maxDistance && m.s.visible(p, viewerID)
+	})
+
+	sort.SliceStable(photos, func(i, j int) bool {
+		return hashDistance(photos[i]) < hashDistance(photos[j])
+	})
+	return photos[:min(len(photos), limit)], nil
+}
+
+func (m memoryPhotoModel) Delete(ctx context.Context, id uuid.UUID, userID int64, release func(*Photo) error) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(id)
+	if photo == nil || photo.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	// release is called before anything is changed, so that an error leaves
+	// the photo in place as a rolled back transaction would.
+	lastUse := photo.ContentHash == "" || m.s.blobs[photo.ContentHash] <= 1
+	if lastUse {
+		err := release(&Photo{
+			ID:          photo.ID,
+			UserID:      photo.UserID,
+			PhotoURL:    photo.PhotoURL,
+			ContentHash: photo.ContentHash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if photo.ContentHash != "" {
+		m.s.blobs[photo.ContentHash]--
+		if lastUse {
+			delete(m.s.blobs, photo.ContentHash)
+		}
+	}
+
+	m.s.photos = slices.DeleteFunc(m.s.photos, func(p *memoryPhoto) bool { return p.ID == id })
+	m.s.likes = slices.DeleteFunc(m.s.likes, func(l *Like) bool { return l.PhotoID == id })
+	m.s.comments = slices.DeleteFunc(m.s.comments, func(c *Comment) bool { return c.PhotoID == id })
+	m.s.mentions = slices.DeleteFunc(m.s.mentions, func(mn *memoryMention) bool { return mn.photoID == id })
+	m.s.notifications = slices.DeleteFunc(m.s.notifications, func(n *memoryNotification) bool {
+		return n.PhotoID != nil && *n.PhotoID == id
+	})
+	return nil
+}
+
+// FileVisible only checks photos, since there are no stories.
+func (m memoryPhotoModel) FileVisible(ctx context.Context, url string, viewerID int64) (bool, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, photo := range m.s.photos {
+		if photo.PhotoURL == url && m.s.visible(photo, viewerID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryLikeModel struct {
+	s *memoryStore
+}
+
+func (m memoryLikeModel) like(photoID uuid.UUID, userID int64) *Like {
+	for _, like := range m.s.likes {
+		if like.PhotoID == photoID && like.UserID == userID {
+			return like
+		}
+	}
+	return nil
+}
+
+func (m memoryLikeModel) Insert(ctx context.Context, like *Like) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if m.like(like.PhotoID, like.UserID) != nil {
+		return ErrDuplicateLike
+	}
+
+	if m.s.photo(like.PhotoID) == nil {
+		return foreignKeyViolation("likes_photo_id_fkey")
+	}
+
+	like.ID = uuid.New()
+	like.CreatedAt = time.Now()
+
+	stored := *like
+	m.s.likes = append(m.s.likes, &stored)
+	return nil
+}
+
+func (m memoryLikeModel) Upsert(ctx context.Context, like *Like) (bool, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if existing := m.like(like.PhotoID, like.UserID); existing != nil {
+		existing.Reaction = like.Reaction
+		like.ID = existing.ID
+		like.CreatedAt = existing.CreatedAt
+		return false, nil
+	}
+
+	if m.s.photo(like.PhotoID) == nil {
+		return false, ErrRecordNotFound
+	}
+
+	like.ID = uuid.New()
+	like.CreatedAt = time.Now()
+
+	stored := *like
+	m.s.likes = append(m.s.likes, &stored)
+	return true, nil
+}
+
+func (m memoryLikeModel) Delete(ctx context.Context, photoID uuid.UUID, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.likes = slices.DeleteFunc(m.s.likes, func(l *Like) bool {
+		return l.PhotoID == photoID && l.UserID == userID
+	})
+	return nil
+}
+
+func (m memoryLikeModel) GetLikesCount(ctx context.Context, photoID uuid.UUID) (int, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	count := 0
+	for _, like := range m.s.likes {
+		if like.PhotoID == photoID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memoryCommentModel struct {
+	s *memoryStore
+}
+
+func (m memoryCommentModel) Insert(ctx context.Context, comment *Comment) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if m.s.photo(comment.PhotoID) == nil {
+		return foreignKeyViolation("comments_photo_id_fkey")
+	}
+
+	comment.ID = uuid.New()
+	comment.CreatedAt = time.Now()
+
+	m.s.comments = append(m.s.comments, &Comment{
+		ID:        comment.ID,
+		PhotoID:   comment.PhotoID,
+		UserID:    comment.UserID,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+	})
+	return nil
+}
+
+// GetByPhotoID orders comments like the Postgres model. There are no comment
+// reactions in memory, so every comment has a like count of 0 and the top
+// order is the same as the newest.
+func (m memoryCommentModel) GetByPhotoID(ctx context.Context, photoID uuid.UUID, sort string) ([]*Comment, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(photoID)
+	if photo == nil {
+		return nil, nil
+	}
+
+	var matched []*Comment
+	for _, comment := range m.s.comments {
+		if comment.PhotoID == photoID {
+			matched = append(matched, comment)
+		}
+	}
+
+	newestFirst(matched, func(c *Comment) time.Time { return c.CreatedAt })
+
+	var comments []*Comment
+	for _, comment := range matched {
+		row := *comment
+		row.Username = m.s.username(comment.UserID)
+		row.Mentions = m.s.mentionsOf(photoID, &comment.ID)
+		row.Reactions = ReactionCounts{}
+		row.Pinned = photo.pinnedCommentID != nil && *photo.pinnedCommentID == comment.ID
+
+		if row.Pinned {
+			comments = append([]*Comment{&row}, comments...)
+		} else {
+			comments = append(comments, &row)
+		}
+	}
+	return comments, nil
+}
+
+func (m memoryCommentModel) Pin(ctx context.Context, photoID, commentID uuid.UUID, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(photoID)
+	if photo == nil || photo.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	for _, comment := range m.s.comments {
+		if comment.ID == commentID && comment.PhotoID == photoID {
+			photo.pinnedCommentID = &commentID
+			return nil
+		}
+	}
+	return ErrRecordNotFound
+}
+
+func (m memoryCommentModel) Unpin(ctx context.Context, photoID uuid.UUID, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	photo := m.s.photo(photoID)
+	if photo == nil || photo.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	photo.pinnedCommentID = nil
+	return nil
+}
+
+type memoryMentionModel struct {
+	s *memoryStore
+}
+
+func (m memoryMentionModel) Replace(ctx context.Context, authorID int64, photoID uuid.UUID, commentID *uuid.UUID, mentions []Mention) ([]Mention, []int64, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	seen := map[int64]bool{}
+	m.s.mentions = slices.DeleteFunc(m.s.mentions, func(mn *memoryMention) bool {
+		if mn.photoID == photoID && sameID(mn.commentID, commentID) {
+			seen[mn.UserID] = true
+			return true
+		}
+		return false
+	})
+
+	var added []int64
+	for _, mention := range mentions {
+		var user *User
+		for _, u := range m.s.users {
+			if u.Username == mention.Username {
+				user = u
+			}
+		}
+		if user == nil {
+			continue
+		}
+
+		if m.s.photo(photoID) == nil {
+			return nil, nil, foreignKeyViolation("mentions_photo_id_fkey")
+		}
+
+		mention.UserID = user.ID
+		m.s.mentions = append(m.s.mentions, &memoryMention{
+			Mention:   mention,
+			authorID:  authorID,
+			photoID:   photoID,
+			commentID: commentID,
+		})
+
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			added = append(added, user.ID)
+		}
+	}
+
+	return m.s.mentionsOf(photoID, commentID), added, nil
+}
+
+type memoryNotificationModel struct {
+	s *memoryStore
+}
+
+func (m memoryNotificationModel) insert(n *Notification) {
+	n.ID = uuid.New()
+	n.CreatedAt = time.Now()
+
+	m.s.notifications = append(m.s.notifications, &memoryNotification{
+		Notification: *n,
+		groupKey:     n.groupKey(),
+	})
+}
+
+func (m memoryNotificationModel) Insert(ctx context.Context, n *Notification) error {
+	if n.UserID == n.ActorID {
+		return nil
+	}
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.insert(n)
+	return nil
+}
+
+func (m memoryNotificationModel) InsertForPhotoOwner(ctx context.Context, n *Notification) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if n.PhotoID == nil {
+		return nil
+	}
+
+	photo := m.s.photo(*n.PhotoID)
+	if photo == nil || photo.UserID == n.ActorID {
+		return nil
+	}
+
+	n.UserID = photo.UserID
+	m.insert(n)
+	return nil
+}
+
+func (m memoryNotificationModel) DeleteByActor(ctx context.Context, actorID int64, notificationType string, photoID *uuid.UUID, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.notifications = slices.DeleteFunc(m.s.notifications, func(n *memoryNotification) bool {
+		return n.ActorID == actorID && n.Type == notificationType && sameID(n.PhotoID, photoID) && (userID == 0 || n.UserID == userID)
+	})
+	return nil
+}
+
+func (m memoryNotificationModel) GetGroups(ctx context.Context, userID int64, filters Filters) ([]*NotificationGroup, Metadata, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var notifications []*memoryNotification
+	for _, n := range m.s.notifications {
+		if n.UserID == userID {
+			notifications = append(notifications, n)
+		}
+	}
+
+	newestFirst(notifications, func(n *memoryNotification) time.Time { return n.CreatedAt })
+
+	groups := []*NotificationGroup{}
+	byKey := map[string]*NotificationGroup{}
+	actorIDs := map[*NotificationGroup]map[int64]bool{}
+
+	for _, n := range notifications {
+		key := n.groupKey + "\x00" + n.Type
+		if n.PhotoID != nil {
+			key += "\x00" + n.PhotoID.String()
+		}
+
+		group, ok := byKey[key]
+		if !ok {
+			group = &NotificationGroup{
+				Key:       n.groupKey,
+				Type:      n.Type,
+				PhotoID:   n.PhotoID,
+				CommentID: n.CommentID,
+				Actors:    []string{},
+				LatestAt:  n.CreatedAt,
+			}
+			byKey[key] = group
+			actorIDs[group] = map[int64]bool{}
+			groups = append(groups, group)
+		}
+
+		if n.ActorID != 0 && !actorIDs[group][n.ActorID] {
+			actorIDs[group][n.ActorID] = true
+			if len(group.Actors) < maxGroupActors {
+				group.Actors = append(group.Actors, m.s.username(n.ActorID))
+			}
+		}
+
+		group.Unread = group.Unread || !n.read
+	}
+
+	// Like count(*) OVER(), the total is 0 when the page is past the end.
+	totalRecords := len(groups)
+	start := min(max(filters.offset(), 0), totalRecords)
+	end := min(start+filters.limit(), totalRecords)
+	groups = groups[start:end]
+	if len(groups) == 0 {
+		totalRecords = 0
+	}
+
+	for _, group := range groups {
+		group.ActorCount = len(actorIDs[group])
+		group.summarize()
+	}
+
+	return groups, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m memoryNotificationModel) CountUnread(ctx context.Context, userID int64) (int, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	keys := map[string]bool{}
+	for _, n := range m.s.notifications {
+		if n.UserID == userID && !n.read {
+			keys[n.groupKey] = true
+		}
+	}
+	return len(keys), nil
+}
+
+func (m memoryNotificationModel) MarkRead(ctx context.Context, userID int64, groupKey string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, n := range m.s.notifications {
+		if n.UserID == userID && (groupKey == "" || n.groupKey == groupKey) {
+			n.read = true
+		}
+	}
+	return nil
+}
+
+type memoryBannedHashModel struct {
+	s *memoryStore
+}
+
+func (m memoryBannedHashModel) Insert(ctx context.Context, banned *BannedHash) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if banned.CreatedBy != nil && m.s.user(*banned.CreatedBy) == nil {
+		return foreignKeyViolation("banned_hashes_created_by_fkey")
+	}
+
+	m.s.nextBannedID++
+	banned.ID = m.s.nextBannedID
+	banned.CreatedAt = time.Now()
+
+	stored := *banned
+	m.s.bannedHashes = append(m.s.bannedHashes, &stored)
+	return nil
+}
+
+func (m memoryBannedHashModel) GetAll(ctx context.Context) ([]*BannedHash, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var banned []*BannedHash
+	for _, b := range m.s.bannedHashes {
+		found := *b
+		banned = append(banned, &found)
+	}
+
+	newestFirst(banned, func(b *BannedHash) time.Time { return b.CreatedAt })
+	return banned, nil
+}
+
+func (m memoryBannedHashModel) Match(ctx context.Context, hash PHash, maxDistance int) (*BannedHash, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var closest *BannedHash
+	closestDistance := maxDistance + 1
+	for _, b := range m.s.bannedHashes {
+		if d := bits.OnesCount64(uint64(b.Hash ^ hash)); d < closestDistance {
+			closest, closestDistance = b, d
+		}
+	}
+
+	if closest == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *closest
+	return &found, nil
+}
+
+func (m memoryBannedHashModel) Delete(ctx context.Context, id int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	n := len(m.s.bannedHashes)
+	m.s.bannedHashes = slices.DeleteFunc(m.s.bannedHashes, func(b *BannedHash) bool { return b.ID == id })
+	if len(m.s.bannedHashes) == n {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Mention is an @username reference in a caption or comment. Offset and
+// Length are measured in Unicode code points and cover the leading @.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// maxUsernameRunes matches the length of the users.username column.
+const maxUsernameRunes = 50
+
+func isUsernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// ParseMentions finds the @username references in text. An @ only starts a
+// mention at the beginning of the text or after a character that can't be
+// part of a username, so email addresses aren't treated as mentions. The
+// returned mentions have no UserID, since they haven't been resolved yet.
+func ParseMentions(text string) []Mention {
+	runes := []rune(text)
+
+	var mentions []Mention
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isUsernameRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+
+		// A trailing full stop ends the sentence rather than the username.
+		for end > i+1 && runes[end-1] == '.' {
+			end--
+		}
+
+		if end > i+1 && end-i-1 <= maxUsernameRunes {
+			mentions = append(mentions, Mention{
+				Username: string(runes[i+1 : end]),
+				Offset:   i,
+				Length:   end - i,
+			})
+		}
+
+		i = end - 1
+	}
+
+	return mentions
+}
+
+// photoMentionsColumn and commentMentionsColumn select the mentions of a
+// caption or comment as a JSON array, for queries aliasing photos as p and
+// comments as c.
+const (
+	photoMentionsColumn = `COALESCE((
+		SELECT json_agg(json_build_object('user_id', m.user_id, 'username', mu.username, 'offset', m.mention_offset, 'length', m.mention_length) ORDER BY m.mention_offset)
+		FROM mentions m JOIN users mu ON m.user_id = mu.id
+		WHERE m.photo_id = p.id AND m.comment_id IS NULL), '[]')`
+	commentMentionsColumn = `COALESCE((
+		SELECT json_agg(json_build_object('user_id', m.user_id, 'username', mu.username, 'offset', m.mention_offset, 'length', m.mention_length) ORDER BY m.mention_offset)
+		FROM mentions m JOIN users mu ON m.user_id = mu.id
+		WHERE m.comment_id = c.id), '[]')`
+)
+
+type MentionModelInterface interface {
+	Replace(ctx context.Context, authorID int64, photoID uuid.UUID, commentID *uuid.UUID, mentions []Mention) ([]Mention, []int64, error)
+}
+
+type MentionModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Replace resolves the usernames in mentions and stores them for a caption,
+// or for a comment if commentID is not nil, replacing any mentions saved
+// before. Unknown usernames and users who have blocked the author are
+// skipped. It returns the stored mentions and the IDs of users who weren't
+// mentioned in the previous version of the text.
+func (m MentionModel) Replace(ctx context.Context, authorID int64, photoID uuid.UUID, commentID *uuid.UUID, mentions []Mention) ([]Mention, []int64, error) {
+	usernames := make([]string, len(mentions))
+	offsets := make([]int, len(mentions))
+	lengths := make([]int, len(mentions))
+	for i, mention := range mentions {
+		usernames[i] = mention.Username
+		offsets[i] = mention.Offset
+		lengths[i] = mention.Length
+	}
+
+	saved := []Mention{}
+	var added []int64
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			DELETE FROM mentions
+			WHERE photo_id = $1 AND comment_id IS NOT DISTINCT FROM $2
+			RETURNING user_id`, photoID, commentID)
+		if err != nil {
+			return err
+		}
+
+		previous, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return err
+		}
+
+		query := `
+			WITH inserted AS (
+				INSERT INTO mentions (user_id, author_id, photo_id, comment_id, mention_offset, mention_length)
+				SELECT u.id, $1, $2, $3, t.mention_offset, t.mention_length
+				FROM unnest($4::text[], $5::int[], $6::int[]) AS t(username, mention_offset, mention_length)
+				JOIN users u ON u.username = t.username
+				WHERE NOT EXISTS (
+					SELECT 1 FROM blocks b WHERE b.blocker_id = u.id AND b.blocked_id = $1
+				)
+				RETURNING user_id, mention_offset, mention_length
+			)
+			SELECT i.user_id, u.username, i.mention_offset, i.mention_length
+			FROM inserted i
+			JOIN users u ON i.user_id = u.id
+			ORDER BY i.mention_offset`
+
+		args := []interface{}{authorID, photoID, commentID, usernames, offsets, lengths}
+
+		rows, err = tx.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		seen := map[int64]bool{}
+		for _, id := range previous {
+			seen[id] = true
+		}
+
+		for rows.Next() {
+			var mention Mention
+			err := rows.Scan(&mention.UserID, &mention.Username, &mention.Offset, &mention.Length)
+			if err != nil {
+				return err
+			}
+			saved = append(saved, mention)
+
+			if !seen[mention.UserID] {
+				seen[mention.UserID] = true
+				added = append(added, mention.UserID)
+			}
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return saved, added, nil
+}
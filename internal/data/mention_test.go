@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMentionReplace(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	// Dave has blocked Alice, so she can't mention him.
+	insertBlock(t, models, dave, alice)
+
+	photo := insertPhoto(t, models, alice, "beach")
+
+	saved, added, err := models.Mentions.Replace(ctx, alice.ID, photo.ID, nil, ParseMentions("With @bob, @nobody and @dave"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 1 || saved[0] != (Mention{UserID: bob.ID, Username: "bob", Offset: 5, Length: 4}) {
+		t.Errorf("got mentions %+v; want bob", saved)
+	}
+	if fmt.Sprint(added) != fmt.Sprint([]int64{bob.ID}) {
+		t.Errorf("got added %v; want bob", added)
+	}
+
+	// Editing the caption only reports newly mentioned users.
+	saved, added, err = models.Mentions.Replace(ctx, alice.ID, photo.ID, nil, ParseMentions("@carol and @bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 2 || saved[0].UserID != carol.ID || saved[1].UserID != bob.ID || saved[1].Offset != 11 {
+		t.Errorf("got mentions %+v; want carol then bob", saved)
+	}
+	if fmt.Sprint(added) != fmt.Sprint([]int64{carol.ID}) {
+		t.Errorf("got added %v; want carol", added)
+	}
+
+	// Mentions in a comment are kept apart from the caption's.
+	comment := insertComment(t, models, photo, bob, "Thanks @alice")
+
+	saved, added, err = models.Mentions.Replace(ctx, bob.ID, photo.ID, &comment.ID, ParseMentions(comment.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].UserID != alice.ID || len(added) != 1 {
+		t.Errorf("got mentions %+v and added %v; want alice", saved, added)
+	}
+
+	got, err := models.Photos.GetByID(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Mentions) != 2 {
+		t.Errorf("got caption mentions %+v; want carol and bob", got.Mentions)
+	}
+
+	saved, added, err = models.Mentions.Replace(ctx, alice.ID, photo.ID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || len(saved) != 0 || added != nil {
+		t.Errorf("got mentions %#v and added %v; want an empty list and nothing added", saved, added)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM mentions`); n != 1 {
+		t.Errorf("got %d mentions; want the comment's only", n)
+	}
+}
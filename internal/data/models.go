@@ -1,21 +1,89 @@
 package data
 
-import "github.com/jackc/pgx/v5/pgxpool"
+import (
+	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IsCanceled reports whether err is from a query abandoned because its
+// context was canceled, such as when the client disconnects mid-request.
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// IsTimeout reports whether err is from a query that ran past its deadline,
+// either the context's or the server's statement_timeout.
+func IsTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "57014" {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err)
+}
+
+// Models holds the data models. The user, token, photo, like, comment,
+// notification, mention, login failure and banned hash models are interfaces,
+// so that they can be backed by NewMemoryModels in tests as well as by
+// Postgres. The others only exist in Postgres.
 type Models struct {
-	Users    UserModel
-	Tokens   TokenModel
-	Photos   PhotoModel
-	Likes    LikeModel
-	Comments CommentModel
+	Users            UserModelInterface
+	Tokens           TokenModelInterface
+	Photos           PhotoModelInterface
+	Likes            LikeModelInterface
+	Comments         CommentModelInterface
+	CommentReactions CommentReactionModel
+	Uploads          UploadModel
+	BannedHashes     BannedHashModelInterface
+	Follows          FollowModel
+	Notifications    NotificationModelInterface
+	Blocks           BlockModel
+	Mentions         MentionModelInterface
+	Conversations    ConversationModel
+	Messages         MessageModel
+	Stories          StoryModel
+	Saves            SaveModel
+	Collections      CollectionModel
+	Explore          ExploreModel
+	Suggestions      SuggestionModel
+	LoginFailures    LoginFailureModelInterface
 }
 
-func NewModels(db *pgxpool.Pool) Models {
+// Timeouts bounds how long the queries made for a request may take, by the
+// kind of query.
+type Timeouts struct {
+	Read  time.Duration // looking up single records
+	Write time.Duration // inserts, updates and deletes
+	List  time.Duration // pages of records, such as feeds and search results
+}
+
+// NewModels returns the models backed by db, with each query given the
+// timeout for its kind to complete.
+func NewModels(db *pgxpool.Pool, timeouts Timeouts) Models {
 	return Models{
-		Users:    UserModel{DB: db},
-		Tokens:   TokenModel{DB: db},
-		Photos:   PhotoModel{DB: db},
-		Likes:    LikeModel{DB: db},
-		Comments: CommentModel{DB: db},
+		Users:            UserModel{DB: db, Timeouts: timeouts},
+		Tokens:           TokenModel{DB: db, Timeouts: timeouts},
+		Photos:           PhotoModel{DB: db, Timeouts: timeouts},
+		Likes:            LikeModel{DB: db, Timeouts: timeouts},
+		Comments:         CommentModel{DB: db, Timeouts: timeouts},
+		CommentReactions: CommentReactionModel{DB: db, Timeouts: timeouts},
+		Uploads:          UploadModel{DB: db, Timeouts: timeouts},
+		BannedHashes:     BannedHashModel{DB: db, Timeouts: timeouts},
+		Follows:          FollowModel{DB: db, Timeouts: timeouts},
+		Notifications:    NotificationModel{DB: db, Timeouts: timeouts},
+		Blocks:           BlockModel{DB: db, Timeouts: timeouts},
+		Mentions:         MentionModel{DB: db, Timeouts: timeouts},
+		Conversations:    ConversationModel{DB: db, Timeouts: timeouts},
+		Messages:         MessageModel{DB: db, Timeouts: timeouts},
+		Stories:          StoryModel{DB: db, Timeouts: timeouts},
+		Saves:            SaveModel{DB: db, Timeouts: timeouts},
+		Collections:      CollectionModel{DB: db, Timeouts: timeouts},
+		Explore:          ExploreModel{DB: db, Timeouts: timeouts},
+		Suggestions:      SuggestionModel{DB: db, Timeouts: timeouts},
+		LoginFailures:    LoginFailureModel{DB: db, Timeouts: timeouts},
 	}
-}
\ No newline at end of file
+}
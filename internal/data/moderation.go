@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BannedHash is a perceptual hash of an image moderators have removed.
+// Uploads within the configured Hamming distance of it are rejected.
+type BannedHash struct {
+	ID        int64     `json:"id"`
+	Hash      PHash     `json:"hash"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy *int64    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BannedHashModelInterface interface {
+	Insert(ctx context.Context, banned *BannedHash) error
+	GetAll(ctx context.Context) ([]*BannedHash, error)
+	Match(ctx context.Context, hash PHash, maxDistance int) (*BannedHash, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type BannedHashModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+func (m BannedHashModel) Insert(ctx context.Context, banned *BannedHash) error {
+	query := `
+		INSERT INTO banned_hashes (phash, reason, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	args := []interface{}{int64(banned.Hash), banned.Reason, banned.CreatedBy}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRow(ctx, query, args...).Scan(&banned.ID, &banned.CreatedAt)
+}
+
+func (m BannedHashModel) GetAll(ctx context.Context) ([]*BannedHash, error) {
+	query := `
+		SELECT id, phash, reason, created_by, created_at
+		FROM banned_hashes
+		ORDER BY created_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var banned []*BannedHash
+	for rows.Next() {
+		var b BannedHash
+		err := rows.Scan(&b.ID, &b.Hash, &b.Reason, &b.CreatedBy, &b.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		banned = append(banned, &b)
+	}
+
+	return banned, rows.Err()
+}
+
+// Match returns the closest banned hash within maxDistance bits of hash, or
+// ErrRecordNotFound if the hash isn't close to anything on the banlist.
+func (m BannedHashModel) Match(ctx context.Context, hash PHash, maxDistance int) (*BannedHash, error) {
+	query := `
+		SELECT id, phash, reason, created_by, created_at
+		FROM banned_hashes
+		WHERE bit_count((phash # $1)::bit(64)) <= $2
+		ORDER BY bit_count((phash # $1)::bit(64))
+		LIMIT 1`
+
+	var b BannedHash
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, int64(hash), maxDistance).Scan(&b.ID, &b.Hash, &b.Reason, &b.CreatedBy, &b.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &b, nil
+}
+
+func (m BannedHashModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM banned_hashes
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
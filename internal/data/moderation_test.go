@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBannedHashes(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	banned, err := models.BannedHashes.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banned) != 0 {
+		t.Errorf("got banned hashes %+v; want none", banned)
+	}
+
+	far := &BannedHash{Hash: 0b1111, Reason: "spam", CreatedBy: &alice.ID}
+	near := &BannedHash{Hash: 0b1}
+	for _, b := range []*BannedHash{far, near} {
+		err := models.BannedHashes.Insert(ctx, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.ID == 0 || b.CreatedAt.IsZero() {
+			t.Errorf("got banned hash %+v; want the ID and creation time set", b)
+		}
+	}
+
+	banned, err = models.BannedHashes.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banned) != 2 || banned[0].ID != near.ID || banned[1].Reason != "spam" || banned[1].CreatedBy == nil || *banned[1].CreatedBy != alice.ID {
+		t.Errorf("got banned hashes %+v; want both, newest first", banned)
+	}
+
+	tests := []struct {
+		name        string
+		hash        PHash
+		maxDistance int
+		want        *BannedHash
+	}{
+		{"exact", 0b1111, 0, far},
+		{"closest", 0b11, 4, near},
+		{"too far", -1, 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.BannedHashes.Match(ctx, tt.hash, tt.maxDistance)
+			switch {
+			case tt.want == nil:
+				if !errors.Is(err, ErrRecordNotFound) {
+					t.Errorf("got %+v, %v; want ErrRecordNotFound", got, err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case got.ID != tt.want.ID || got.Hash != tt.want.Hash:
+				t.Errorf("got banned hash %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+
+	err = models.BannedHashes.Delete(ctx, near.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.BannedHashes.Delete(ctx, near.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting twice; want ErrRecordNotFound", err)
+	}
+
+	// The ban outlives the moderator who added it.
+	exec(t, `DELETE FROM users WHERE id = $1`, alice.ID)
+
+	banned, err = models.BannedHashes.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banned) != 1 || banned[0].ID != far.ID || banned[0].CreatedBy != nil {
+		t.Errorf("got banned hashes %+v; want the first without a creator", banned)
+	}
+}
@@ -0,0 +1,290 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	NotificationLike    = "like"
+	NotificationComment = "comment"
+	NotificationFollow  = "follow"
+	NotificationMention = "mention"
+	// NotificationFollowRequest asks a private user to approve a follow.
+	NotificationFollowRequest = "follow_request"
+	// NotificationFailedLogins warns that an account was locked after
+	// repeated failed logins. It has no actor.
+	NotificationFailedLogins = "failed_logins"
+)
+
+// Notification is a single event to show to a user, such as someone liking
+// one of their photos.
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    int64      `json:"user_id"`
+	ActorID   int64      `json:"actor_id"`
+	Type      string     `json:"type"`
+	PhotoID   *uuid.UUID `json:"photo_id,omitempty"`
+	CommentID *uuid.UUID `json:"comment_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// groupKey returns the key used to collapse repeated events into one entry.
+// Likes and comments are grouped per photo, follows, follow requests and
+// failed logins per day, and each mention is shown on its own.
+func (n *Notification) groupKey() string {
+	switch {
+	case n.Type == NotificationFollow || n.Type == NotificationFollowRequest || n.Type == NotificationFailedLogins:
+		return n.Type + ":" + time.Now().UTC().Format(time.DateOnly)
+	case n.Type == NotificationMention && n.CommentID != nil:
+		return n.Type + ":" + n.CommentID.String()
+	case n.PhotoID != nil:
+		return n.Type + ":" + n.PhotoID.String()
+	default:
+		return n.Type
+	}
+}
+
+// NotificationGroup is one or more notifications sharing a group key, shown
+// to the user as a single entry like "alice and 12 others liked your photo".
+type NotificationGroup struct {
+	Key        string     `json:"key"`
+	Type       string     `json:"type"`
+	PhotoID    *uuid.UUID `json:"photo_id,omitempty"`
+	CommentID  *uuid.UUID `json:"comment_id,omitempty"`
+	Actors     []string   `json:"actors"`
+	ActorCount int        `json:"actor_count"`
+	Summary    string     `json:"summary"`
+	Unread     bool       `json:"unread"`
+	LatestAt   time.Time  `json:"latest_at"`
+}
+
+// maxGroupActors is the number of most recent actors listed in a group.
+const maxGroupActors = 3
+
+var notificationActions = map[string]string{
+	NotificationLike:          "liked your photo",
+	NotificationComment:       "commented on your photo",
+	NotificationFollow:        "started following you",
+	NotificationFollowRequest: "asked to follow you",
+	NotificationMention:       "mentioned you",
+}
+
+func (g *NotificationGroup) summarize() {
+	if g.Type == NotificationFailedLogins {
+		g.Summary = "Your account was temporarily locked after repeated failed login attempts"
+		return
+	}
+
+	var actors string
+	switch {
+	case len(g.Actors) == 0:
+		actors = "Someone"
+	case g.ActorCount == 2 && len(g.Actors) == 2:
+		actors = g.Actors[0] + " and " + g.Actors[1]
+	case g.ActorCount > 1:
+		others := "others"
+		if g.ActorCount == 2 {
+			others = "other"
+		}
+		actors = fmt.Sprintf("%s and %d %s", g.Actors[0], g.ActorCount-1, others)
+	default:
+		actors = g.Actors[0]
+	}
+
+	g.Summary = actors + " " + notificationActions[g.Type]
+}
+
+type NotificationModelInterface interface {
+	Insert(ctx context.Context, n *Notification) error
+	InsertForPhotoOwner(ctx context.Context, n *Notification) error
+	DeleteByActor(ctx context.Context, actorID int64, notificationType string, photoID *uuid.UUID, userID int64) error
+	GetGroups(ctx context.Context, userID int64, filters Filters) ([]*NotificationGroup, Metadata, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	MarkRead(ctx context.Context, userID int64, groupKey string) error
+}
+
+type NotificationModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert adds a notification for n.UserID. Notifications about a user's own
+// actions are silently dropped, and an ActorID of 0 stores one without an
+// actor.
+func (m NotificationModel) Insert(ctx context.Context, n *Notification) error {
+	if n.UserID == n.ActorID {
+		return nil
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, photo_id, comment_id, group_key)
+		VALUES ($1, NULLIF($2::bigint, 0), $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []interface{}{n.UserID, n.ActorID, n.Type, n.PhotoID, n.CommentID, n.groupKey()}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRow(ctx, query, args...).Scan(&n.ID, &n.CreatedAt)
+}
+
+// InsertForPhotoOwner adds a notification for the owner of n.PhotoID and
+// sets n.UserID to them. Nothing is inserted, and n.ID is left unset, if the
+// owner is the actor.
+func (m NotificationModel) InsertForPhotoOwner(ctx context.Context, n *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, photo_id, comment_id, group_key)
+		SELECT p.user_id, $1, $2, p.id, $4, $5
+		FROM photos p
+		WHERE p.id = $3 AND p.user_id <> $1
+		RETURNING id, user_id, created_at`
+
+	args := []interface{}{n.ActorID, n.Type, n.PhotoID, n.CommentID, n.groupKey()}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&n.ID, &n.UserID, &n.CreatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// DeleteByActor removes the notifications an actor caused for an action that
+// has since been undone, such as an unlike or unfollow. photoID is nil for
+// notifications that aren't about a photo, and a userID of 0 matches any
+// recipient.
+func (m NotificationModel) DeleteByActor(ctx context.Context, actorID int64, notificationType string, photoID *uuid.UUID, userID int64) error {
+	query := `
+		DELETE FROM notifications
+		WHERE actor_id = $1 AND type = $2 AND photo_id IS NOT DISTINCT FROM $3
+		AND ($4 = 0 OR user_id = $4)`
+
+	args := []interface{}{actorID, notificationType, photoID, userID}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, args...)
+	return err
+}
+
+// GetGroups returns a page of a user's notifications, grouped and ordered by
+// their most recent event.
+func (m NotificationModel) GetGroups(ctx context.Context, userID int64, filters Filters) ([]*NotificationGroup, Metadata, error) {
+	// The actors are listed from their latest notification in the group, one
+	// entry per actor, since the same user can appear several times, for
+	// example when they comment on a photo more than once.
+	query := `
+		SELECT g.total, g.group_key, g.type, g.photo_id, g.comment_id,
+			ARRAY(
+				SELECT a.username
+				FROM (
+					SELECT DISTINCT ON (n.actor_id) u.username, n.created_at
+					FROM notifications n
+					JOIN users u ON n.actor_id = u.id
+					WHERE n.user_id = $1 AND n.group_key = g.group_key AND n.type = g.type
+					AND n.photo_id IS NOT DISTINCT FROM g.photo_id
+					ORDER BY n.actor_id, n.created_at DESC
+				) a
+				ORDER BY a.created_at DESC
+				LIMIT $4
+			),
+			g.actor_count, g.unread, g.latest_at
+		FROM (
+			SELECT count(*) OVER() AS total, n.group_key, n.type, n.photo_id,
+				(array_agg(n.comment_id ORDER BY n.created_at DESC))[1] AS comment_id,
+				COUNT(DISTINCT n.actor_id) AS actor_count,
+				bool_or(n.read_at IS NULL) AS unread,
+				MAX(n.created_at) AS latest_at
+			FROM notifications n
+			WHERE n.user_id = $1
+			GROUP BY n.group_key, n.type, n.photo_id
+			ORDER BY MAX(n.created_at) DESC
+			LIMIT $2 OFFSET $3
+		) g
+		ORDER BY g.latest_at DESC`
+
+	args := []interface{}{userID, filters.limit(), filters.offset(), maxGroupActors}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	groups := []*NotificationGroup{}
+
+	for rows.Next() {
+		group := NotificationGroup{Actors: []string{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&group.Key,
+			&group.Type,
+			&group.PhotoID,
+			&group.CommentID,
+			&group.Actors,
+			&group.ActorCount,
+			&group.Unread,
+			&group.LatestAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		group.summarize()
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return groups, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// CountUnread returns the number of notification groups with at least one
+// unread notification.
+func (m NotificationModel) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT group_key)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	var count int
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkRead marks a user's notifications in the given group as read, or all
+// of them if groupKey is empty.
+func (m NotificationModel) MarkRead(ctx context.Context, userID int64, groupKey string) error {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+		AND ($2 = '' OR group_key = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, userID, groupKey)
+	return err
+}
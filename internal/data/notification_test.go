@@ -0,0 +1,323 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNotificationInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	follow := &Notification{UserID: alice.ID, ActorID: bob.ID, Type: NotificationFollow}
+
+	err := models.Notifications.Insert(ctx, follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if follow.ID == uuid.Nil || follow.CreatedAt.IsZero() {
+		t.Errorf("got notification %+v; want the ID and creation time set", follow)
+	}
+
+	// Users aren't notified of their own actions.
+	self := &Notification{UserID: alice.ID, ActorID: alice.ID, Type: NotificationFollow}
+
+	err = models.Notifications.Insert(ctx, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.ID != uuid.Nil {
+		t.Error("a notification was stored for the user's own action")
+	}
+
+	// Notifications without an actor are stored with a NULL actor_id.
+	err = models.Notifications.Insert(ctx, &Notification{UserID: alice.ID, Type: NotificationFailedLogins})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND actor_id IS NULL`, alice.ID); n != 1 {
+		t.Errorf("got %d notifications without an actor; want 1", n)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM notifications`); n != 2 {
+		t.Errorf("got %d notifications; want 2", n)
+	}
+}
+
+func TestNotificationInsertForPhotoOwner(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	like := &Notification{ActorID: bob.ID, Type: NotificationLike, PhotoID: &photo.ID}
+
+	err := models.Notifications.InsertForPhotoOwner(ctx, like)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if like.ID == uuid.Nil || like.UserID != alice.ID {
+		t.Errorf("got notification %+v; want it sent to alice", like)
+	}
+
+	for _, n := range []*Notification{
+		{ActorID: alice.ID, Type: NotificationLike, PhotoID: &photo.ID},
+		{ActorID: bob.ID, Type: NotificationLike, PhotoID: &uuid.UUID{}},
+	} {
+		err := models.Notifications.InsertForPhotoOwner(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.ID != uuid.Nil {
+			t.Errorf("got notification %+v; want nothing stored", n)
+		}
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM notifications`); n != 1 {
+		t.Errorf("got %d notifications; want 1", n)
+	}
+}
+
+func TestNotificationDeleteByActor(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	beach := insertPhoto(t, models, alice, "beach")
+	forest := insertPhoto(t, models, alice, "forest")
+
+	for _, n := range []*Notification{
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationLike, PhotoID: &beach.ID},
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationLike, PhotoID: &forest.ID},
+		{UserID: alice.ID, ActorID: carol.ID, Type: NotificationLike, PhotoID: &beach.ID},
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationFollow},
+		{UserID: carol.ID, ActorID: bob.ID, Type: NotificationFollow},
+	} {
+		err := models.Notifications.Insert(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := models.Notifications.DeleteByActor(ctx, bob.ID, NotificationLike, &beach.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Notifications.DeleteByActor(ctx, bob.ID, NotificationFollow, nil, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := testDB.Query(ctx, `SELECT user_id, actor_id, type, photo_id FROM notifications ORDER BY created_at`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var left []Notification
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.UserID, &n.ActorID, &n.Type, &n.PhotoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, n)
+	}
+
+	if len(left) != 3 ||
+		left[0].ActorID != bob.ID || *left[0].PhotoID != forest.ID ||
+		left[1].ActorID != carol.ID ||
+		left[2].UserID != carol.ID || left[2].Type != NotificationFollow {
+		t.Errorf("got notifications %+v; want bob's forest like, carol's like and carol's follow", left)
+	}
+}
+
+func TestNotificationGetGroups(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	groups, metadata, err := models.Notifications.GetGroups(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 || metadata != (Metadata{}) {
+		t.Errorf("got %+v and %+v; want no groups", groups, metadata)
+	}
+
+	var actors []*User
+	for _, username := range []string{"bob", "carol", "dave", "erin"} {
+		actor := insertUser(t, models, username)
+		actors = append(actors, actor)
+
+		err := models.Notifications.Insert(ctx, &Notification{UserID: alice.ID, ActorID: actor.ID, Type: NotificationLike, PhotoID: &photo.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bob comments many times after carol, but is listed once, and carol
+	// isn't pushed out of the list by his repeated comments.
+	for _, actor := range append([]*User{actors[1]}, slices.Repeat([]*User{actors[0]}, 25)...) {
+		comment := insertComment(t, models, photo, actor, "Nice")
+
+		err := models.Notifications.Insert(ctx, &Notification{UserID: alice.ID, ActorID: actor.ID, Type: NotificationComment, PhotoID: &photo.ID, CommentID: &comment.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = models.Notifications.Insert(ctx, &Notification{UserID: alice.ID, Type: NotificationFailedLogins})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, metadata, err = models.Notifications.GetGroups(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 3 || metadata.TotalRecords != 3 {
+		t.Fatalf("got %d groups and %+v; want 3", len(groups), metadata)
+	}
+
+	tests := []struct {
+		key     string
+		typ     string
+		actors  []string
+		count   int
+		summary string
+	}{
+		{
+			NotificationFailedLogins + ":" + groups[0].LatestAt.UTC().Format(time.DateOnly),
+			NotificationFailedLogins,
+			nil,
+			0,
+			"Your account was temporarily locked after repeated failed login attempts",
+		},
+		{
+			NotificationComment + ":" + photo.ID.String(),
+			NotificationComment,
+			[]string{"bob", "carol"},
+			2,
+			"bob and carol commented on your photo",
+		},
+		{
+			NotificationLike + ":" + photo.ID.String(),
+			NotificationLike,
+			[]string{"erin", "dave", "carol"},
+			4,
+			"erin and 3 others liked your photo",
+		},
+	}
+
+	for i, tt := range tests {
+		group := groups[i]
+
+		if group.Key != tt.key || group.Type != tt.typ || fmt.Sprint(group.Actors) != fmt.Sprint(tt.actors) ||
+			group.ActorCount != tt.count || group.Summary != tt.summary || !group.Unread {
+			t.Errorf("group %d: got %+v", i, group)
+		}
+	}
+
+	if groups[1].CommentID == nil || groups[1].PhotoID == nil || *groups[1].PhotoID != photo.ID {
+		t.Errorf("got comment group %+v; want the photo and latest comment", groups[1])
+	}
+
+	groups, metadata, err = models.Notifications.GetGroups(ctx, alice.ID, Filters{Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Type != NotificationLike || metadata.LastPage != 2 || metadata.TotalRecords != 3 {
+		t.Errorf("got %+v and %+v; want the like group on the last page", groups, metadata)
+	}
+}
+
+func TestNotificationMarkRead(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	beach := insertPhoto(t, models, alice, "beach")
+	forest := insertPhoto(t, models, alice, "forest")
+
+	for _, n := range []*Notification{
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationLike, PhotoID: &beach.ID},
+		{UserID: alice.ID, ActorID: carol.ID, Type: NotificationLike, PhotoID: &beach.ID},
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationLike, PhotoID: &forest.ID},
+		{UserID: alice.ID, ActorID: bob.ID, Type: NotificationFollow},
+		{UserID: bob.ID, ActorID: alice.ID, Type: NotificationFollow},
+	} {
+		err := models.Notifications.Insert(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkUnread := func(userID int64, want int) {
+		t.Helper()
+
+		n, err := models.Notifications.CountUnread(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("got %d unread groups for user %d; want %d", n, userID, want)
+		}
+	}
+
+	checkUnread(alice.ID, 3)
+	checkUnread(bob.ID, 1)
+
+	err := models.Notifications.MarkRead(ctx, alice.ID, NotificationLike+":"+beach.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUnread(alice.ID, 2)
+
+	// Marking another user's group has no effect.
+	err = models.Notifications.MarkRead(ctx, carol.ID, NotificationLike+":"+forest.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUnread(alice.ID, 2)
+
+	err = models.Notifications.MarkRead(ctx, alice.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUnread(alice.ID, 0)
+	checkUnread(bob.ID, 1)
+
+	groups, _, err := models.Notifications.GetGroups(ctx, alice.ID, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range groups {
+		if group.Unread {
+			t.Errorf("got group %+v; want it read", group)
+		}
+	}
+}
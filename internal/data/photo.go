@@ -2,167 +2,449 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Photo struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Username  string    `json:"username"`  
-	PhotoURL  string    `json:"photo_url"`
-	Caption   string    `json:"caption,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uuid.UUID      `json:"id"`
+	UserID      int64          `json:"user_id"`
+	Username    string         `json:"username"`
+	PhotoURL    string         `json:"photo_url"`
+	Caption     string         `json:"caption,omitempty"`
+	AltText     string         `json:"alt_text"`
+	Latitude    *float64       `json:"latitude,omitempty"`
+	Longitude   *float64       `json:"longitude,omitempty"`
+	PlaceName   string         `json:"place_name,omitempty"`
+	ContentHash string         `json:"-"`
+	Size        int64          `json:"-"`
+	PHash       *PHash         `json:"-"`
+	Mentions    []Mention      `json:"mentions"`
+	Reactions   ReactionCounts `json:"reactions"`
+	CreatedAt   time.Time      `json:"created_at"`
 }
+
+// PHash is a 64-bit perceptual hash. It is stored in Postgres as a BIGINT and
+// rendered in JSON as 16 hex digits.
+type PHash int64
+
+func (h PHash) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%016x"`, uint64(h))), nil
+}
+
+func (h *PHash) UnmarshalJSON(data []byte) error {
+	unquoted, err := strconv.Unquote(string(data))
+	if err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseUint(unquoted, 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid perceptual hash %q", unquoted)
+	}
+
+	*h = PHash(value)
+	return nil
+}
+
+type PhotoModelInterface interface {
+	Insert(ctx context.Context, photo *Photo) error
+	GetByID(ctx context.Context, id uuid.UUID) (*Photo, error)
+	GetVisible(ctx context.Context, id uuid.UUID, viewerID int64) (*Photo, error)
+	GetByUserAndHash(ctx context.Context, userID int64, contentHash string) (*Photo, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*Photo, error)
+	Search(ctx context.Context, query string, viewerID int64) ([]*Photo, error)
+	GetAll(ctx context.Context, viewerID int64) ([]*Photo, error)
+	Update(ctx context.Context, photo *Photo) error
+	GetNearby(ctx context.Context, latitude, longitude, radius float64, limit int, viewerID int64) ([]*Photo, error)
+	GetSimilar(ctx context.Context, id uuid.UUID, maxDistance, limit int, viewerID int64) ([]*Photo, error)
+	Delete(ctx context.Context, id uuid.UUID, userID int64, release func(*Photo) error) error
+	FileVisible(ctx context.Context, url string, viewerID int64) (bool, error)
+}
+
 type PhotoModel struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// photoColumns is the column list shared by every query that returns photos.
+// Queries must alias photos as p and join users as u.
+const photoColumns = `p.id, p.user_id, u.username, p.photo_url, COALESCE(p.caption, ''), p.alt_text, p.latitude, p.longitude, p.place_name, COALESCE(p.content_hash, ''), p.phash, p.created_at, ` + photoMentionsColumn + `, ` + photoReactionsColumn
+
+// visibleTo returns a condition hiding photos by private users from anyone
+// but the owner and their followers. Pending follow requests aren't in the
+// follows table, so they don't count. param is the placeholder holding the
+// viewer's ID, which is 0 for anonymous users. Queries must join users as u.
+func visibleTo(param string) string {
+	return `(NOT u.is_private OR u.id = ` + param + ` OR EXISTS (
+		SELECT 1 FROM follows f WHERE f.follower_id = ` + param + ` AND f.followee_id = u.id))`
+}
+
+// scanPhoto reads the photoColumns of a row into photo. Any extra
+// destinations are scanned first, for columns selected before them.
+func scanPhoto(row pgx.Row, photo *Photo, extra ...any) error {
+	return row.Scan(append(extra,
+		&photo.ID,
+		&photo.UserID,
+		&photo.Username,
+		&photo.PhotoURL,
+		&photo.Caption,
+		&photo.AltText,
+		&photo.Latitude,
+		&photo.Longitude,
+		&photo.PlaceName,
+		&photo.ContentHash,
+		&photo.PHash,
+		&photo.CreatedAt,
+		&photo.Mentions,
+		&photo.Reactions,
+	)...)
+}
+
+func (m PhotoModel) queryPhotos(ctx context.Context, query string, args ...any) ([]*Photo, error) {
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var photos []*Photo
+	for rows.Next() {
+		var photo Photo
+		err := scanPhoto(rows, &photo)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, &photo)
+	}
+
+	return photos, rows.Err()
+}
+
+// queryPhotoPage runs a query selecting count(*) OVER() followed by
+// photoColumns, where the last two arguments are the limit and offset.
+func (m PhotoModel) queryPhotoPage(ctx context.Context, query string, filters Filters, args ...any) ([]*Photo, Metadata, error) {
+	rows, err := m.DB.Query(ctx, query, append(args, filters.limit(), filters.offset())...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	photos := []*Photo{}
+
+	for rows.Next() {
+		var photo Photo
+		err := scanPhoto(rows, &photo, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		photos = append(photos, &photo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return photos, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 }
 
-func (m PhotoModel) Insert(photo *Photo) error {
+// Insert adds a photo. When the photo has a content hash, the reference count
+// of the matching blob is incremented in the same transaction, creating the
+// blob if this is the first photo to use it.
+func (m PhotoModel) Insert(ctx context.Context, photo *Photo) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		var contentHash *string
+		if photo.ContentHash != "" {
+			contentHash = &photo.ContentHash
+
+			_, err := tx.Exec(ctx, `
+				INSERT INTO blobs (hash, size, ref_count)
+				VALUES ($1, $2, 1)
+				ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1`,
+				photo.ContentHash, photo.Size)
+			if err != nil {
+				return err
+			}
+		}
+
+		query := `
+			INSERT INTO photos (id, user_id, photo_url, caption, alt_text, latitude, longitude, place_name, content_hash, phash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING created_at`
+
+		photo.ID = uuid.New()
+		args := []interface{}{
+			photo.ID,
+			photo.UserID,
+			photo.PhotoURL,
+			photo.Caption,
+			photo.AltText,
+			photo.Latitude,
+			photo.Longitude,
+			photo.PlaceName,
+			contentHash,
+			photo.PHash,
+		}
+
+		return tx.QueryRow(ctx, query, args...).Scan(&photo.CreatedAt)
+	})
+}
+
+func (m PhotoModel) GetByID(ctx context.Context, id uuid.UUID) (*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = $1`
+
+	var photo Photo
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanPhoto(m.DB.QueryRow(ctx, query, id), &photo)
+	if err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// GetVisible returns a photo if the viewer is allowed to see it, and
+// pgx.ErrNoRows otherwise.
+func (m PhotoModel) GetVisible(ctx context.Context, id uuid.UUID, viewerID int64) (*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = $1 AND ` + visibleTo("$2")
+
+	var photo Photo
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanPhoto(m.DB.QueryRow(ctx, query, id, viewerID), &photo)
+	if err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// FileVisible reports whether the viewer can see a photo or an unexpired
+// story stored at url. Identical uploads share a file, so it is enough for
+// any one of them to be visible.
+func (m PhotoModel) FileVisible(ctx context.Context, url string, viewerID int64) (bool, error) {
 	query := `
-		INSERT INTO photos (id, user_id, photo_url, caption)
-		VALUES ($1, $2, $3, $4)
-		RETURNING created_at`
+		SELECT EXISTS (
+			SELECT 1 FROM photos p
+			JOIN users u ON p.user_id = u.id
+			WHERE p.photo_url = $1 AND ` + visibleTo("$2") + `
+		) OR EXISTS (
+			SELECT 1 FROM stories s
+			WHERE s.photo_url = $1 AND s.expires_at > NOW()
+			AND (s.user_id = $2 OR s.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $2))
+			AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $2 AND b.blocked_id = s.user_id) OR (b.blocker_id = s.user_id AND b.blocked_id = $2)
+			)
+		)`
 
-	photo.ID = uuid.New() 
-	args := []interface{}{photo.ID, photo.UserID, photo.PhotoURL, photo.Caption}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	var visible bool
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
-	return m.DB.QueryRow(ctx, query, args...).Scan(&photo.CreatedAt)
-}
-
-func (m PhotoModel) GetByID(id uuid.UUID) (*Photo, error) {
-    query := `
-        SELECT p.id, p.user_id, u.username, p.photo_url, p.caption, p.created_at
-        FROM photos p
-        JOIN users u ON p.user_id = u.id
-        WHERE p.id = $1`
-
-    var photo Photo
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-
-    err := m.DB.QueryRow(ctx, query, id).Scan(
-        &photo.ID,
-        &photo.UserID,
-        &photo.Username,
-        &photo.PhotoURL,
-        &photo.Caption,
-        &photo.CreatedAt,
-    )
-    if err != nil {
-        return nil, err
-    }
-    return &photo, nil
-}
-func (m PhotoModel) GetByUserID(userID int64) ([]*Photo, error) {
-    query := `
-        SELECT p.id, p.user_id, u.username, p.photo_url, p.caption, p.created_at
-        FROM photos p
-        JOIN users u ON p.user_id = u.id
-        WHERE p.user_id = $1
-        ORDER BY p.created_at DESC`
-
-    rows, err := m.DB.Query(context.Background(), query, userID)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var photos []*Photo
-    for rows.Next() {
-        var photo Photo
-        err := rows.Scan(
-            &photo.ID,
-            &photo.UserID,
-            &photo.Username,
-            &photo.PhotoURL,
-            &photo.Caption,
-            &photo.CreatedAt,
-        )
-        if err != nil {
-            return nil, err
-        }
-        photos = append(photos, &photo)
-    }
-
-    return photos, nil
-}
-
-func (m PhotoModel) Search(query string) ([]*Photo, error) {
-    sqlQuery := `
-        SELECT p.id, p.user_id, u.username, p.photo_url, p.caption, p.created_at
-        FROM photos p
-        JOIN users u ON p.user_id = u.id
-        WHERE p.caption ILIKE $1 OR u.username ILIKE $1
-        ORDER BY p.created_at DESC
-    `
-
-    args := []interface{}{"%" + query + "%"}
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-
-    rows, err := m.DB.Query(ctx, sqlQuery, args...)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var photos []*Photo
-    for rows.Next() {
-        var photo Photo
-        err := rows.Scan(
-            &photo.ID,
-            &photo.UserID,
-            &photo.Username,
-            &photo.PhotoURL,
-            &photo.Caption,
-            &photo.CreatedAt,
-        )
-        if err != nil {
-            return nil, err
-        }
-        photos = append(photos, &photo)
-    }
-
-    return photos, nil
-}
-
-func (m PhotoModel) GetAll() ([]*Photo, error) {
-    query := `
-        SELECT p.id, p.user_id, u.username, p.photo_url, p.caption, p.created_at
-        FROM photos p
-        JOIN users u ON p.user_id = u.id
-        ORDER BY p.created_at DESC`
-
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-
-    rows, err := m.DB.Query(ctx, query)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var photos []*Photo
-    for rows.Next() {
-        var photo Photo
-        err := rows.Scan(
-            &photo.ID,
-            &photo.UserID,
-            &photo.Username,
-            &photo.PhotoURL,
-            &photo.Caption,
-            &photo.CreatedAt,
-        )
-        if err != nil {
-            return nil, err
-        }
-        photos = append(photos, &photo)
-    }
-
-    return photos, nil
-}
\ No newline at end of file
+	err := m.DB.QueryRow(ctx, query, url, viewerID).Scan(&visible)
+	return visible, err
+}
+
+// GetByUserAndHash returns a photo the user has already posted with exactly
+// the same content, or ErrRecordNotFound if there is none.
+func (m PhotoModel) GetByUserAndHash(ctx context.Context, userID int64, contentHash string) (*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.user_id = $1 AND p.content_hash = $2
+		ORDER BY p.created_at DESC
+		LIMIT 1`
+
+	var photo Photo
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := scanPhoto(m.DB.QueryRow(ctx, query, userID, contentHash), &photo)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &photo, nil
+}
+
+func (m PhotoModel) GetByUserID(ctx context.Context, userID int64) ([]*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.user_id = $1
+		ORDER BY p.created_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryPhotos(ctx, query, userID)
+}
+
+func (m PhotoModel) Search(ctx context.Context, query string, viewerID int64) ([]*Photo, error) {
+	sqlQuery := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE (p.caption ILIKE $1 OR p.alt_text ILIKE $1 OR u.username ILIKE $1)
+		AND ` + visibleTo("$2") + `
+		ORDER BY p.created_at DESC`
+
+	args := []interface{}{"%" + query + "%", viewerID}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryPhotos(ctx, sqlQuery, args...)
+}
+
+func (m PhotoModel) GetAll(ctx context.Context, viewerID int64) ([]*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE ` + visibleTo("$1") + `
+		ORDER BY p.created_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryPhotos(ctx, query, viewerID)
+}
+
+// Update saves the caption and alt text of a photo.
+func (m PhotoModel) Update(ctx context.Context, photo *Photo) error {
+	query := `
+		UPDATE photos
+		SET caption = $1, alt_text = $2
+		WHERE id = $3`
+
+	args := []interface{}{photo.Caption, photo.AltText, photo.ID}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, args...)
+	return err
+}
+
+// GetNearby returns up to limit geotagged photos within radius metres of the
+// given point, closest first.
+func (m PhotoModel) GetNearby(ctx context.Context, latitude, longitude, radius float64, limit int, viewerID int64) ([]*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.latitude IS NOT NULL
+		AND earth_box(ll_to_earth($1, $2), $3) @> ll_to_earth(p.latitude, p.longitude)
+		AND earth_distance(ll_to_earth($1, $2), ll_to_earth(p.latitude, p.longitude)) <= $3
+		AND ` + visibleTo("$5") + `
+		ORDER BY earth_distance(ll_to_earth($1, $2), ll_to_earth(p.latitude, p.longitude)), p.created_at DESC
+		LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryPhotos(ctx, query, latitude, longitude, radius, limit, viewerID)
+}
+
+// GetSimilar returns up to limit photos whose perceptual hash is within
+// maxDistance bits of the given photo's, closest first.
+func (m PhotoModel) GetSimilar(ctx context.Context, id uuid.UUID, maxDistance, limit int, viewerID int64) ([]*Photo, error) {
+	query := `
+		SELECT ` + photoColumns + `
+		FROM photos p
+		JOIN users u ON p.user_id = u.id
+		CROSS JOIN (SELECT phash FROM photos WHERE id = $1) source
+		WHERE p.id <> $1
+		AND p.phash IS NOT NULL
+		AND bit_count((p.phash # source.phash)::bit(64)) <= $2
+		AND ` + visibleTo("$4") + `
+		ORDER BY bit_count((p.phash # source.phash)::bit(64)), p.created_at DESC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryPhotos(ctx, query, id, maxDistance, limit, viewerID)
+}
+
+// Delete removes a photo owned by the given user and decrements the
+// reference count of its blob. If no other photo uses the file any more,
+// release is called before the transaction commits so the file can be
+// removed while the blob row is still locked against concurrent uploads.
+// Photos stored before content addressing are always released.
+func (m PhotoModel) Delete(ctx context.Context, id uuid.UUID, userID int64, release func(*Photo) error) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		query := `
+			DELETE FROM photos
+			WHERE id = $1 AND user_id = $2
+			RETURNING id, user_id, photo_url, COALESCE(content_hash, '')`
+
+		var photo Photo
+		err := tx.QueryRow(ctx, query, id, userID).Scan(
+			&photo.ID,
+			&photo.UserID,
+			&photo.PhotoURL,
+			&photo.ContentHash,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		if photo.ContentHash == "" {
+			return release(&photo)
+		}
+
+		var refCount int
+		err = tx.QueryRow(ctx, `
+			UPDATE blobs SET ref_count = ref_count - 1
+			WHERE hash = $1
+			RETURNING ref_count`, photo.ContentHash).Scan(&refCount)
+		if err != nil {
+			return err
+		}
+
+		if refCount > 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM blobs WHERE hash = $1`, photo.ContentHash)
+		if err != nil {
+			return err
+		}
+
+		return release(&photo)
+	})
+}
@@ -0,0 +1,551 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPhotoInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	latitude, longitude, phash := 51.5074, -0.1278, PHash(42)
+
+	photo := &Photo{
+		UserID:      alice.ID,
+		PhotoURL:    "/uploads/abc.jpg",
+		Caption:     "beach",
+		AltText:     "Waves on sand",
+		Latitude:    &latitude,
+		Longitude:   &longitude,
+		PlaceName:   "London",
+		ContentHash: "abc",
+		Size:        1024,
+		PHash:       &phash,
+	}
+
+	err := models.Photos.Insert(ctx, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if photo.ID == uuid.Nil || photo.CreatedAt.IsZero() {
+		t.Errorf("got photo %+v; want the ID and creation time set", photo)
+	}
+
+	got, err := models.Photos.GetByID(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Username != "alice" || got.Caption != "beach" || got.AltText != "Waves on sand" || got.PlaceName != "London" ||
+		got.ContentHash != "abc" || got.PHash == nil || *got.PHash != phash ||
+		got.Latitude == nil || *got.Latitude != latitude || got.Longitude == nil || *got.Longitude != longitude {
+		t.Errorf("got photo %+v", got)
+	}
+	if len(got.Mentions) != 0 || len(got.Reactions) != 0 {
+		t.Errorf("got mentions %v and reactions %v; want none", got.Mentions, got.Reactions)
+	}
+
+	// A second photo with the same content shares the blob.
+	err = models.Photos.Insert(ctx, &Photo{UserID: bob.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, `SELECT ref_count FROM blobs WHERE hash = 'abc'`); n != 2 {
+		t.Errorf("got a blob reference count of %d; want 2", n)
+	}
+
+	// Photos without a content hash don't reference a blob.
+	insertPhoto(t, models, alice, "forest")
+
+	if n := count(t, `SELECT COUNT(*) FROM blobs`); n != 1 {
+		t.Errorf("got %d blobs; want 1", n)
+	}
+}
+
+func TestPhotoGet(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	_, err := models.Photos.GetByID(ctx, uuid.New())
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got error %v for an unknown photo; want pgx.ErrNoRows", err)
+	}
+
+	older := &Photo{UserID: alice.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1}
+	newer := &Photo{UserID: alice.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1}
+	for _, photo := range []*Photo{older, newer} {
+		err := models.Photos.Insert(ctx, photo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := models.Photos.GetByUserAndHash(ctx, alice.ID, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != newer.ID {
+		t.Errorf("got photo %s; want the newest, %s", got.ID, newer.ID)
+	}
+
+	for _, tt := range []struct {
+		userID int64
+		hash   string
+	}{
+		{alice.ID, "def"},
+		{bob.ID, "abc"},
+	} {
+		_, err := models.Photos.GetByUserAndHash(ctx, tt.userID, tt.hash)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("user %d, hash %s: got error %v; want ErrRecordNotFound", tt.userID, tt.hash, err)
+		}
+	}
+
+	forest := insertPhoto(t, models, alice, "forest")
+	insertPhoto(t, models, bob, "lake")
+
+	photos, err := models.Photos.GetByUserID(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, photos, forest, newer, older)
+}
+
+// TestPhotoVisibility checks that photos of private users are only returned
+// to the owner and their followers.
+func TestPhotoVisibility(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	insertFollow(t, models, bob, alice)
+	setPrivate(t, models, alice)
+
+	// A pending request doesn't make dave a follower.
+	err := models.Follows.Insert(ctx, &Follow{FollowerID: dave.ID, FolloweeID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := insertPhoto(t, models, alice, "sunset beach")
+	public := insertPhoto(t, models, carol, "beach party")
+
+	tests := []struct {
+		name     string
+		viewerID int64
+		visible  bool
+	}{
+		{"owner", alice.ID, true},
+		{"follower", bob.ID, true},
+		{"other user", carol.ID, false},
+		{"requested to follow", dave.ID, false},
+		{"anonymous", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Photos.GetVisible(ctx, private.ID, tt.viewerID)
+			switch {
+			case tt.visible && err != nil:
+				t.Errorf("got error %v; want the photo", err)
+			case !tt.visible && !errors.Is(err, pgx.ErrNoRows):
+				t.Errorf("got error %v; want pgx.ErrNoRows", err)
+			}
+
+			visible, err := models.Photos.FileVisible(ctx, private.PhotoURL, tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if visible != tt.visible {
+				t.Errorf("got file visible %t; want %t", visible, tt.visible)
+			}
+
+			want := []*Photo{public}
+			if tt.visible {
+				want = []*Photo{public, private}
+			}
+
+			photos, err := models.Photos.GetAll(ctx, tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPhotos(t, photos, want...)
+
+			photos, err = models.Photos.Search(ctx, "beach", tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPhotos(t, photos, want...)
+		})
+	}
+}
+
+func TestPhotoSearch(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	beach := insertPhoto(t, models, alice, "At the BEACH")
+	forest := insertPhoto(t, models, bob, "forest")
+
+	described := &Photo{UserID: bob.ID, PhotoURL: "/uploads/x.jpg", AltText: "A sandy beach"}
+	err := models.Photos.Insert(ctx, described)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []*Photo
+	}{
+		{"beach", []*Photo{described, beach}},
+		{"BOB", []*Photo{described, forest}},
+		{"mountain", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			photos, err := models.Photos.Search(ctx, tt.query, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPhotos(t, photos, tt.want...)
+		})
+	}
+}
+
+func TestPhotoUpdate(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	photo := insertPhoto(t, models, alice, "beach")
+
+	photo.Caption = "forest"
+	photo.AltText = "Tall trees"
+
+	err := models.Photos.Update(ctx, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := models.Photos.GetByID(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Caption != "forest" || got.AltText != "Tall trees" || got.PhotoURL != photo.PhotoURL {
+		t.Errorf("got photo %+v; want the caption and alt text updated", got)
+	}
+}
+
+func TestPhotoGetNearby(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	insertPhoto(t, models, alice, "no location")
+
+	var photos []*Photo
+	for _, place := range []struct {
+		user                *User
+		latitude, longitude float64
+	}{
+		{alice, 51.5079, -0.0877}, // London Bridge, about 2.8km away
+		{alice, 51.5014, -0.1419}, // Buckingham Palace, about 1.2km away
+		{alice, 48.8566, 2.3522},  // Paris
+		{bob, 51.5081, -0.1281},   // Trafalgar Square, about 80m away
+	} {
+		photo := &Photo{UserID: place.user.ID, PhotoURL: "/uploads/x.jpg", Latitude: &place.latitude, Longitude: &place.longitude}
+
+		err := models.Photos.Insert(ctx, photo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		photos = append(photos, photo)
+	}
+
+	setPrivate(t, models, bob)
+
+	got, err := models.Photos.GetNearby(ctx, 51.5074, -0.1278, 5000, 10, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got, photos[1], photos[0])
+
+	got, err = models.Photos.GetNearby(ctx, 51.5074, -0.1278, 5000, 10, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got, photos[3], photos[1], photos[0])
+
+	got, err = models.Photos.GetNearby(ctx, 51.5074, -0.1278, 5000, 1, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got, photos[1])
+}
+
+func TestPhotoGetSimilar(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	insertPhoto(t, models, alice, "no hash")
+
+	var photos []*Photo
+	for _, tt := range []struct {
+		user  *User
+		phash PHash
+	}{
+		{alice, 0},
+		{alice, 0b111}, // 3 bits away
+		{alice, 0b1},   // 1 bit away
+		{alice, -1},    // 64 bits away
+		{bob, 0b11},    // 2 bits away
+	} {
+		phash := tt.phash
+		photo := &Photo{UserID: tt.user.ID, PhotoURL: "/uploads/x.jpg", PHash: &phash}
+
+		err := models.Photos.Insert(ctx, photo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		photos = append(photos, photo)
+	}
+
+	setPrivate(t, models, bob)
+
+	got, err := models.Photos.GetSimilar(ctx, photos[0].ID, 4, 10, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got, photos[2], photos[1])
+
+	got, err = models.Photos.GetSimilar(ctx, photos[0].ID, 4, 2, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got, photos[2], photos[4])
+
+	got, err = models.Photos.GetSimilar(ctx, uuid.New(), 64, 10, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPhotos(t, got)
+}
+
+func TestPhotoDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	var released []*Photo
+	release := func(photo *Photo) error {
+		released = append(released, photo)
+		return nil
+	}
+
+	first := &Photo{UserID: alice.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1}
+	second := &Photo{UserID: bob.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1}
+	for _, photo := range []*Photo{first, second} {
+		err := models.Photos.Insert(ctx, photo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := models.Photos.Delete(ctx, first.ID, bob.ID, release)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting another user's photo; want ErrRecordNotFound", err)
+	}
+
+	err = models.Photos.Delete(ctx, first.ID, alice.ID, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(released) != 0 {
+		t.Errorf("released %d photos while the blob is still used; want none", len(released))
+	}
+	if n := count(t, `SELECT ref_count FROM blobs WHERE hash = 'abc'`); n != 1 {
+		t.Errorf("got a blob reference count of %d; want 1", n)
+	}
+
+	err = models.Photos.Delete(ctx, first.ID, alice.ID, release)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting a photo twice; want ErrRecordNotFound", err)
+	}
+
+	// A failed release rolls the delete back.
+	failure := errors.New("disk on fire")
+	err = models.Photos.Delete(ctx, second.ID, bob.ID, func(*Photo) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("got error %v; want the release error", err)
+	}
+
+	_, err = models.Photos.GetByID(ctx, second.ID)
+	if err != nil {
+		t.Errorf("got error %v; want the photo kept after a failed release", err)
+	}
+
+	err = models.Photos.Delete(ctx, second.ID, bob.ID, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(released) != 1 || released[0].ID != second.ID || released[0].ContentHash != "abc" {
+		t.Errorf("got released photos %+v; want the last user of the blob", released)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM blobs`); n != 0 {
+		t.Errorf("got %d blobs; want the unused blob deleted", n)
+	}
+
+	// Photos stored before content addressing are always released.
+	legacy := insertPhoto(t, models, alice, "legacy")
+
+	err = models.Photos.Delete(ctx, legacy.ID, alice.ID, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(released) != 2 || released[1].PhotoURL != legacy.PhotoURL {
+		t.Errorf("got released photos %+v; want the legacy photo released", released)
+	}
+}
+
+// TestPhotoDeleteCascades checks that deleting a photo removes everything
+// attached to it, and only unlinks it from messages.
+func TestPhotoDeleteCascades(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	photo := insertPhoto(t, models, alice, "beach")
+	other := insertPhoto(t, models, alice, "forest")
+
+	comment := insertComment(t, models, photo, bob, "Nice @alice")
+	insertComment(t, models, other, bob, "Also nice")
+
+	err := models.Comments.Pin(ctx, photo.ID, comment.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Likes.Insert(ctx, &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: comment.ID, UserID: alice.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Notifications.InsertForPhotoOwner(ctx, &Notification{ActorID: bob.ID, Type: NotificationComment, PhotoID: &photo.ID, CommentID: &comment.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = models.Mentions.Replace(ctx, bob.ID, photo.ID, &comment.ID, ParseMentions(comment.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Saves.Insert(ctx, bob.ID, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection := &Collection{UserID: bob.ID, Name: "Beaches"}
+	err = models.Collections.Insert(ctx, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Collections.AddPhoto(ctx, collection.ID, bob.ID, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Explore.Refresh(ctx, ExploreWeights{Likes: 1, Comments: 1, Gravity: 1.8, Window: 24 * time.Hour}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := models.Conversations.Insert(ctx, bob.ID, []int64{alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &Message{ConversationID: id, SenderID: bob.ID, PhotoID: &photo.ID}
+	err = models.Messages.Insert(ctx, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Photos.Delete(ctx, photo.ID, alice.ID, func(*Photo) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"likes", "comments", "notifications", "mentions", "saved_photos", "collection_photos", "explore_scores"} {
+		if n := count(t, `SELECT COUNT(*) FROM `+table+` WHERE photo_id = $1`, photo.ID); n != 0 {
+			t.Errorf("%d rows left in %s", n, table)
+		}
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM comment_reactions WHERE comment_id = $1`, comment.ID); n != 0 {
+		t.Errorf("%d rows left in comment_reactions", n)
+	}
+
+	// The other photo, the collection and the message are kept.
+	comments, err := models.Comments.GetByPhotoID(ctx, other.ID, CommentSortNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 {
+		t.Errorf("got %d comments on the other photo; want 1", len(comments))
+	}
+
+	_, err = models.Collections.Get(ctx, collection.ID, bob.ID)
+	if err != nil {
+		t.Errorf("got error %v; want the collection kept", err)
+	}
+
+	messages, _, err := models.Messages.GetByConversationID(ctx, id, Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].PhotoID != nil {
+		t.Errorf("got messages %+v; want the message kept without its photo", messages)
+	}
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultReaction is the reaction stored by the like endpoints. It must be
+// part of every configured reaction set.
+const DefaultReaction = "like"
+
+// ReactionCounts maps each reaction type to the number of users who chose
+// it. Types nobody has chosen are left out.
+type ReactionCounts map[string]int
+
+func (c ReactionCounts) MarshalJSON() ([]byte, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]int(c))
+}
+
+// photoReactionsColumn and commentReactionsColumn select the reaction counts
+// of a photo or comment as a JSON object, for queries aliasing photos as p
+// and comments as c.
+const (
+	photoReactionsColumn = `COALESCE((
+		SELECT json_object_agg(r.reaction, r.n)
+		FROM (SELECT reaction, COUNT(*) AS n FROM likes WHERE photo_id = p.id GROUP BY reaction) r), '{}')`
+	commentReactionsColumn = `COALESCE((
+		SELECT json_object_agg(r.reaction, r.n)
+		FROM (SELECT reaction, COUNT(*) AS n FROM comment_reactions WHERE comment_id = c.id GROUP BY reaction) r), '{}')`
+)
+
+type CommentReaction struct {
+	CommentID uuid.UUID `json:"comment_id"`
+	UserID    int64     `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CommentReactionModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert adds a reaction to a comment. It returns ErrDuplicateLike if the
+// user has already reacted to it and ErrRecordNotFound if the comment doesn't
+// exist.
+func (m CommentReactionModel) Insert(ctx context.Context, reaction *CommentReaction) error {
+	query := `
+		INSERT INTO comment_reactions (comment_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING created_at`
+
+	args := []interface{}{reaction.CommentID, reaction.UserID, reaction.Reaction}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&reaction.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrDuplicateLike
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Upsert sets the user's reaction to a comment, replacing any earlier one.
+// It reports whether the user hadn't reacted before, and returns
+// ErrRecordNotFound if the comment doesn't exist.
+func (m CommentReactionModel) Upsert(ctx context.Context, reaction *CommentReaction) (bool, error) {
+	query := `
+		INSERT INTO comment_reactions (comment_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (comment_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction
+		RETURNING created_at, xmax = 0`
+
+	var inserted bool
+	args := []interface{}{reaction.CommentID, reaction.UserID, reaction.Reaction}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&reaction.CreatedAt, &inserted)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+	return inserted, nil
+}
+
+func (m CommentReactionModel) Delete(ctx context.Context, commentID uuid.UUID, userID int64) error {
+	query := `
+		DELETE FROM comment_reactions
+		WHERE comment_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, commentID, userID)
+	return err
+}
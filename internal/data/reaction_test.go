@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCommentReactionInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+	comment := insertComment(t, models, photo, bob, "Nice")
+
+	reaction := &CommentReaction{CommentID: comment.ID, UserID: alice.ID, Reaction: "love"}
+
+	err := models.CommentReactions.Insert(ctx, reaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reaction.CreatedAt.IsZero() {
+		t.Error("creation time was not set")
+	}
+
+	err = models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: comment.ID, UserID: alice.ID, Reaction: DefaultReaction})
+	if !errors.Is(err, ErrDuplicateLike) {
+		t.Errorf("got error %v; want ErrDuplicateLike", err)
+	}
+
+	err = models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: uuid.New(), UserID: alice.ID, Reaction: DefaultReaction})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown comment; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCommentReactionUpsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+	comment := insertComment(t, models, photo, bob, "Nice")
+
+	for _, tt := range []struct {
+		reaction string
+		inserted bool
+	}{
+		{"love", true},
+		{"haha", false},
+	} {
+		inserted, err := models.CommentReactions.Upsert(ctx, &CommentReaction{CommentID: comment.ID, UserID: alice.ID, Reaction: tt.reaction})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != tt.inserted {
+			t.Errorf("%s: got inserted %t; want %t", tt.reaction, inserted, tt.inserted)
+		}
+	}
+
+	comments, err := models.Comments.GetByPhotoID(ctx, photo.ID, CommentSortNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := comments[0].Reactions; len(got) != 1 || got["haha"] != 1 {
+		t.Errorf("got reactions %v; want a single haha", got)
+	}
+
+	_, err = models.CommentReactions.Upsert(ctx, &CommentReaction{CommentID: uuid.New(), UserID: alice.ID, Reaction: "love"})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown comment; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCommentReactionDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	photo := insertPhoto(t, models, alice, "beach")
+	comment := insertComment(t, models, photo, bob, "Nice")
+
+	for _, user := range []*User{alice, bob} {
+		err := models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: comment.ID, UserID: user.ID, Reaction: DefaultReaction})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleting twice is not an error.
+	for range 2 {
+		err := models.CommentReactions.Delete(ctx, comment.ID, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM comment_reactions WHERE comment_id = $1`, comment.ID); n != 1 {
+		t.Errorf("got %d reactions; want bob's only", n)
+	}
+}
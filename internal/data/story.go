@@ -0,0 +1,324 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Story is a photo that disappears from feeds once it expires.
+type Story struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Username    string    `json:"username"`
+	PhotoURL    string    `json:"photo_url"`
+	Caption     string    `json:"caption,omitempty"`
+	AltText     string    `json:"alt_text"`
+	ContentHash string    `json:"-"`
+	Size        int64     `json:"-"`
+	Viewed      bool      `json:"viewed"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// StoryFeedEntry holds the active stories of one author, oldest first.
+type StoryFeedEntry struct {
+	UserID    int64    `json:"user_id"`
+	Username  string   `json:"username"`
+	AllViewed bool     `json:"all_viewed"`
+	Stories   []*Story `json:"stories"`
+}
+
+type StoryViewer struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	ViewedAt time.Time `json:"viewed_at"`
+}
+
+type StoryModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert adds a story and increments the reference count of its blob in the
+// same transaction, the same way PhotoModel.Insert does.
+func (m StoryModel) Insert(ctx context.Context, story *Story) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO blobs (hash, size, ref_count)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1`,
+			story.ContentHash, story.Size)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO stories (user_id, photo_url, content_hash, caption, alt_text, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at`
+
+		args := []interface{}{
+			story.UserID,
+			story.PhotoURL,
+			story.ContentHash,
+			story.Caption,
+			story.AltText,
+			story.ExpiresAt,
+		}
+
+		return tx.QueryRow(ctx, query, args...).Scan(&story.ID, &story.CreatedAt)
+	})
+}
+
+// GetByID returns an unexpired story the viewer can see, or
+// ErrRecordNotFound. As in GetFeed, viewers can see their own stories and
+// those of the users they follow, unless either has blocked the other.
+// Pending follow requests don't count.
+func (m StoryModel) GetByID(ctx context.Context, id uuid.UUID, viewerID int64) (*Story, error) {
+	query := `
+		SELECT s.id, s.user_id, u.username, s.photo_url, s.caption, s.alt_text, s.content_hash, s.created_at, s.expires_at
+		FROM stories s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.id = $1 AND s.expires_at > NOW()
+		AND (s.user_id = $2 OR s.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $2))
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = s.user_id) OR (b.blocker_id = s.user_id AND b.blocked_id = $2)
+		)`
+
+	var story Story
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, id, viewerID).Scan(
+		&story.ID,
+		&story.UserID,
+		&story.Username,
+		&story.PhotoURL,
+		&story.Caption,
+		&story.AltText,
+		&story.ContentHash,
+		&story.CreatedAt,
+		&story.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &story, nil
+}
+
+// GetFeed returns the active stories of the viewer and everyone they follow,
+// grouped by author. Authors with stories the viewer hasn't seen come first,
+// then authors are ordered by their latest story.
+func (m StoryModel) GetFeed(ctx context.Context, viewerID int64) ([]*StoryFeedEntry, error) {
+	query := `
+		SELECT s.id, s.user_id, u.username, s.photo_url, s.caption, s.alt_text, s.created_at, s.expires_at,
+			EXISTS (SELECT 1 FROM story_views v WHERE v.story_id = s.id AND v.viewer_id = $1)
+		FROM stories s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.expires_at > NOW()
+		AND (s.user_id = $1 OR s.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+		ORDER BY s.user_id, s.created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed := []*StoryFeedEntry{}
+	var entry *StoryFeedEntry
+
+	for rows.Next() {
+		var story Story
+		err := rows.Scan(
+			&story.ID,
+			&story.UserID,
+			&story.Username,
+			&story.PhotoURL,
+			&story.Caption,
+			&story.AltText,
+			&story.CreatedAt,
+			&story.ExpiresAt,
+			&story.Viewed,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry == nil || entry.UserID != story.UserID {
+			entry = &StoryFeedEntry{UserID: story.UserID, Username: story.Username, AllViewed: true}
+			feed = append(feed, entry)
+		}
+
+		entry.Stories = append(entry.Stories, &story)
+		entry.AllViewed = entry.AllViewed && story.Viewed
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(feed, func(i, j int) bool {
+		if feed[i].AllViewed != feed[j].AllViewed {
+			return !feed[i].AllViewed
+		}
+		return latestStory(feed[i]).After(latestStory(feed[j]))
+	})
+
+	return feed, nil
+}
+
+func latestStory(entry *StoryFeedEntry) time.Time {
+	return entry.Stories[len(entry.Stories)-1].CreatedAt
+}
+
+// AddView records that a user has seen a story. Repeat views are ignored.
+func (m StoryModel) AddView(ctx context.Context, storyID uuid.UUID, viewerID int64) error {
+	query := `
+		INSERT INTO story_views (story_id, viewer_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, storyID, viewerID)
+	return err
+}
+
+// GetViewers lists who has seen a story, most recent first.
+func (m StoryModel) GetViewers(ctx context.Context, storyID uuid.UUID) ([]*StoryViewer, error) {
+	query := `
+		SELECT v.viewer_id, u.username, v.viewed_at
+		FROM story_views v
+		JOIN users u ON v.viewer_id = u.id
+		WHERE v.story_id = $1
+		ORDER BY v.viewed_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, storyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	viewers := []*StoryViewer{}
+	for rows.Next() {
+		var viewer StoryViewer
+		err := rows.Scan(&viewer.UserID, &viewer.Username, &viewer.ViewedAt)
+		if err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, &viewer)
+	}
+
+	return viewers, rows.Err()
+}
+
+// Delete removes a story owned by the given user. See DeleteExpired for how
+// release is called.
+func (m StoryModel) Delete(ctx context.Context, id uuid.UUID, userID int64, release func(contentHash string) error) error {
+	query := `
+		DELETE FROM stories
+		WHERE id = $1 AND user_id = $2
+		RETURNING content_hash`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	count, err := m.deleteStories(ctx, query, []any{id, userID}, release)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes every expired story and returns how many were
+// deleted. Blobs no longer used by any photo or story are deleted too, and
+// release is called with their hash before the transaction commits so the
+// file can be removed while the blob row is still locked. It is run as a
+// background job, so it is bounded by ctx rather than the query timeout.
+func (m StoryModel) DeleteExpired(ctx context.Context, release func(contentHash string) error) (int, error) {
+	query := `
+		DELETE FROM stories
+		WHERE expires_at <= NOW()
+		RETURNING content_hash`
+
+	return m.deleteStories(ctx, query, nil, release)
+}
+
+func (m StoryModel) deleteStories(ctx context.Context, query string, args []any, release func(contentHash string) error) (int, error) {
+	var count int
+
+	err := pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		hashes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		count = len(hashes)
+		if count == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE blobs b SET ref_count = b.ref_count - r.n
+			FROM (SELECT hash, COUNT(*) AS n FROM unnest($1::text[]) AS hash GROUP BY hash) r
+			WHERE b.hash = r.hash`, hashes)
+		if err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx, `
+			DELETE FROM blobs
+			WHERE hash = ANY($1) AND ref_count = 0
+			RETURNING hash`, hashes)
+		if err != nil {
+			return err
+		}
+
+		unused, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range unused {
+			err := release(hash)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return count, err
+}
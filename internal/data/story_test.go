@@ -0,0 +1,334 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func insertStory(t *testing.T, models Models, user *User, hash string, expiresAt time.Time) *Story {
+	t.Helper()
+
+	story := &Story{
+		UserID:      user.ID,
+		Username:    user.Username,
+		PhotoURL:    "/uploads/" + hash + ".jpg",
+		ContentHash: hash,
+		Size:        1,
+		ExpiresAt:   expiresAt,
+	}
+
+	err := models.Stories.Insert(context.Background(), story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return story
+}
+
+func TestStoryInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	story := &Story{
+		UserID:      alice.ID,
+		PhotoURL:    "/uploads/abc.jpg",
+		Caption:     "Morning",
+		AltText:     "Coffee",
+		ContentHash: "abc",
+		Size:        1024,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	err := models.Stories.Insert(ctx, story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if story.ID == uuid.Nil || story.CreatedAt.IsZero() {
+		t.Errorf("got story %+v; want the ID and creation time set", story)
+	}
+
+	got, err := models.Stories.GetByID(ctx, story.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "alice" || got.Caption != "Morning" || got.AltText != "Coffee" || got.ContentHash != "abc" {
+		t.Errorf("got story %+v", got)
+	}
+
+	// Stories and photos share blobs.
+	err = models.Photos.Insert(ctx, &Photo{UserID: alice.ID, PhotoURL: "/uploads/abc.jpg", ContentHash: "abc", Size: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, `SELECT ref_count FROM blobs WHERE hash = 'abc'`); n != 2 {
+		t.Errorf("got a blob reference count of %d; want 2", n)
+	}
+
+	expired := insertStory(t, models, alice, "def", time.Now().Add(-time.Minute))
+
+	for _, id := range []uuid.UUID{expired.ID, uuid.New()} {
+		_, err := models.Stories.GetByID(ctx, id, alice.ID)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("got error %v; want ErrRecordNotFound", err)
+		}
+	}
+}
+
+func TestStoryGetByIDHidden(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	story := insertStory(t, models, alice, "abc", time.Now().Add(time.Hour))
+
+	insertFollow(t, models, bob, alice)
+	insertFollow(t, models, dave, alice)
+	insertBlock(t, models, alice, dave)
+
+	tests := []struct {
+		name    string
+		viewer  *User
+		visible bool
+	}{
+		{"owner", alice, true},
+		{"follower", bob, true},
+		{"stranger", carol, false},
+		{"blocked", dave, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Stories.GetByID(ctx, story.ID, tt.viewer.ID)
+			switch {
+			case tt.visible && err != nil:
+				t.Errorf("got error %v; want the story", err)
+			case !tt.visible && !errors.Is(err, ErrRecordNotFound):
+				t.Errorf("got error %v; want ErrRecordNotFound", err)
+			}
+
+			visible, err := models.Photos.FileVisible(ctx, story.PhotoURL, tt.viewer.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if visible != tt.visible {
+				t.Errorf("got file visible %t; want %t", visible, tt.visible)
+			}
+		})
+	}
+}
+
+func TestStoryGetFeed(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+
+	insertFollow(t, models, alice, bob)
+	insertFollow(t, models, alice, carol)
+
+	later := time.Now().Add(time.Hour)
+
+	bobsFirst := insertStory(t, models, bob, "b1", later)
+	insertStory(t, models, alice, "a1", later)
+	carolsStory := insertStory(t, models, carol, "c1", later)
+	bobsSecond := insertStory(t, models, bob, "b2", later)
+	insertStory(t, models, bob, "b3", time.Now().Add(-time.Minute))
+	insertStory(t, models, dave, "d1", later)
+
+	err := models.Stories.AddView(ctx, carolsStory.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice's own stories come before Carol's, which she has seen, and after
+	// Bob's, which are newer.
+	feed, err := models.Stories.GetFeed(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range feed {
+		got = append(got, fmt.Sprintf("%s:%d:%t", entry.Username, len(entry.Stories), entry.AllViewed))
+	}
+	if fmt.Sprint(got) != "[bob:2:false alice:1:false carol:1:true]" {
+		t.Errorf("got feed %v", got)
+	}
+
+	bobs := feed[0].Stories
+	if bobs[0].ID != bobsFirst.ID || bobs[1].ID != bobsSecond.ID || bobs[0].Viewed {
+		t.Errorf("got bob's stories %+v; want both, oldest first", bobs)
+	}
+
+	feed, err = models.Stories.GetFeed(ctx, dave.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 1 || feed[0].UserID != dave.ID {
+		t.Errorf("got feed %+v; want dave's own stories only", feed)
+	}
+}
+
+func TestStoryViews(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+
+	story := insertStory(t, models, alice, "abc", time.Now().Add(time.Hour))
+
+	viewers, err := models.Stories.GetViewers(ctx, story.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if viewers == nil || len(viewers) != 0 {
+		t.Errorf("got viewers %#v; want an empty list", viewers)
+	}
+
+	// Repeat views are ignored.
+	for _, user := range []*User{bob, carol, bob} {
+		err := models.Stories.AddView(ctx, story.ID, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viewers, err = models.Stories.GetViewers(ctx, story.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(viewers) != 2 || viewers[0].Username != "carol" || viewers[1].Username != "bob" || viewers[1].ViewedAt.IsZero() {
+		t.Errorf("got viewers %+v; want carol then bob", viewers)
+	}
+
+	err = models.Stories.AddView(ctx, uuid.New(), bob.ID)
+	if err == nil {
+		t.Error("got no error viewing an unknown story")
+	}
+}
+
+func TestStoryDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	var released []string
+	release := func(hash string) error {
+		released = append(released, hash)
+		return nil
+	}
+
+	first := insertStory(t, models, alice, "abc", time.Now().Add(time.Hour))
+	second := insertStory(t, models, alice, "abc", time.Now().Add(time.Hour))
+
+	err := models.Stories.AddView(ctx, first.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Stories.Delete(ctx, first.ID, bob.ID, release)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v deleting another user's story; want ErrRecordNotFound", err)
+	}
+
+	err = models.Stories.Delete(ctx, first.ID, alice.ID, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(released) != 0 {
+		t.Errorf("got released %v while the blob is still used; want none", released)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM story_views`); n != 0 {
+		t.Errorf("got %d views left after deleting the story", n)
+	}
+
+	err = models.Stories.Delete(ctx, second.ID, alice.ID, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(released) != "[abc]" {
+		t.Errorf("got released %v; want the blob released", released)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM blobs`); n != 0 {
+		t.Errorf("got %d blobs; want the unused blob deleted", n)
+	}
+}
+
+func TestStoryDeleteExpired(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	var released []string
+	release := func(hash string) error {
+		released = append(released, hash)
+		return nil
+	}
+
+	expired := time.Now().Add(-time.Minute)
+
+	// Two expired stories share a blob with a photo, two share one only with
+	// each other, and one shares a blob with a story that is still active.
+	insertStory(t, models, alice, "photo", expired)
+	insertStory(t, models, alice, "shared", expired)
+	insertStory(t, models, alice, "shared", expired)
+	insertStory(t, models, alice, "active", expired)
+	active := insertStory(t, models, alice, "active", time.Now().Add(time.Hour))
+
+	err := models.Photos.Insert(ctx, &Photo{UserID: alice.ID, PhotoURL: "/uploads/photo.jpg", ContentHash: "photo", Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := models.Stories.DeleteExpired(ctx, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 {
+		t.Errorf("deleted %d stories; want 4", n)
+	}
+	if fmt.Sprint(released) != "[shared]" {
+		t.Errorf("got released %v; want only the blob no longer used", released)
+	}
+
+	for hash, want := range map[string]int{"photo": 1, "active": 1, "shared": 0} {
+		if n := count(t, `SELECT COALESCE(SUM(ref_count), 0) FROM blobs WHERE hash = $1`, hash); n != want {
+			t.Errorf("got a reference count of %d for %s; want %d", n, hash, want)
+		}
+	}
+
+	_, err = models.Stories.GetByID(ctx, active.ID, alice.ID)
+	if err != nil {
+		t.Errorf("got error %v; want the active story kept", err)
+	}
+
+	n, err = models.Stories.DeleteExpired(ctx, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("deleted %d stories on the second run; want 0", n)
+	}
+}
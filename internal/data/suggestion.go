@@ -0,0 +1,202 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Reasons an account is suggested, from the signal that contributed most to
+// its score.
+const (
+	SuggestionMutual  = "followed_by_people_you_follow"
+	SuggestionLiked   = "liked_their_photos"
+	SuggestionPopular = "popular"
+)
+
+// maxSuggestions is the number of suggestions stored per user.
+const maxSuggestions = 50
+
+type Suggestion struct {
+	UserID        int64   `json:"user_id"`
+	Username      string  `json:"username"`
+	Reason        string  `json:"reason"`
+	FollowerCount int     `json:"follower_count"`
+	Score         float64 `json:"-"`
+}
+
+// SuggestionModel recommends accounts to follow. Suggestions are computed
+// ahead of time for each user, since scoring looks at the follows and likes
+// of everyone the user is connected to.
+type SuggestionModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// notSuggestable excludes the user in $1, accounts they already follow,
+// private accounts and accounts blocked in either direction. Queries must
+// join the suggested users as u.
+const notSuggestable = `u.id <> $1 AND NOT u.is_private
+	AND NOT EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = u.id)
+	AND NOT EXISTS (
+		SELECT 1 FROM blocks b
+		WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+	)`
+
+// Refresh recomputes the suggestions for a user. Each candidate scores 3 for
+// every account the user follows that follows them, 2 for every photo of
+// theirs the user has liked, and the log of their follower count if they are
+// among the 100 most followed accounts.
+func (m SuggestionModel) Refresh(ctx context.Context, userID int64) error {
+	query := `
+		WITH candidates AS (
+			SELECT f2.followee_id AS id, COUNT(*)::float8 * 3 AS mutual, 0::float8 AS liked, 0::float8 AS popular
+			FROM follows f1
+			JOIN follows f2 ON f2.follower_id = f1.followee_id
+			WHERE f1.follower_id = $1
+			GROUP BY f2.followee_id
+			UNION ALL
+			SELECT p.user_id, 0::float8, COUNT(*)::float8 * 2, 0::float8
+			FROM likes l
+			JOIN photos p ON l.photo_id = p.id
+			WHERE l.user_id = $1
+			GROUP BY p.user_id
+			UNION ALL
+			(SELECT followee_id, 0::float8, 0::float8, ln(1 + COUNT(*)::float8)
+			FROM follows
+			GROUP BY followee_id
+			ORDER BY COUNT(*) DESC
+			LIMIT 100)
+		), scored AS (
+			SELECT id, SUM(mutual) AS mutual, SUM(liked) AS liked, SUM(popular) AS popular
+			FROM candidates
+			GROUP BY id
+		)
+		INSERT INTO user_suggestions (user_id, suggested_id, score, reason)
+		SELECT $1, s.id, s.mutual + s.liked + s.popular,
+			CASE
+				WHEN s.mutual > 0 AND s.mutual >= s.liked AND s.mutual >= s.popular THEN '` + SuggestionMutual + `'
+				WHEN s.liked > 0 AND s.liked >= s.popular THEN '` + SuggestionLiked + `'
+				ELSE '` + SuggestionPopular + `'
+			END
+		FROM scored s
+		JOIN users u ON u.id = s.id
+		WHERE ` + notSuggestable + `
+		ORDER BY 3 DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, m.DB, func(tx pgx.Tx) error {
+		// Marking the suggestions as computed first locks the user's set, so
+		// that concurrent refreshes for the user run one after the other
+		// instead of inserting the same suggestions twice.
+		_, err := tx.Exec(ctx, `
+			INSERT INTO suggestion_sets (user_id)
+			VALUES ($1)
+			ON CONFLICT (user_id) DO UPDATE SET computed_at = NOW()`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM user_suggestions WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, query, userID, maxSuggestions)
+		return err
+	})
+}
+
+// RefreshStale recomputes the suggestions of up to limit users whose
+// suggestions were computed more than ttl ago, oldest first, and returns how
+// many were refreshed. Users who have never asked for suggestions are left to
+// be computed on demand.
+func (m SuggestionModel) RefreshStale(ctx context.Context, ttl time.Duration, limit int) (int, error) {
+	query := `
+		SELECT user_id
+		FROM suggestion_sets
+		WHERE computed_at < NOW() - make_interval(secs => $1::float8)
+		ORDER BY computed_at
+		LIMIT $2`
+
+	// Each refresh has its own timeout, so only the query for stale users is
+	// bounded by it here.
+	queryCtx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	rows, err := m.DB.Query(queryCtx, query, ttl.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, err
+	}
+
+	for i, userID := range userIDs {
+		err := m.Refresh(ctx, userID)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(userIDs), nil
+}
+
+// Get returns up to limit suggestions for a user, best first, and whether
+// they have been computed at all. Accounts the user has followed or blocked,
+// or that have gone private, since they were computed are left out.
+func (m SuggestionModel) Get(ctx context.Context, userID int64, limit int) ([]*Suggestion, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	var computed bool
+
+	err := m.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM suggestion_sets WHERE user_id = $1)`, userID).Scan(&computed)
+	if err != nil || !computed {
+		return nil, false, err
+	}
+
+	query := `
+		SELECT u.id, u.username, s.reason, s.score,
+			(SELECT COUNT(*) FROM follows f WHERE f.followee_id = u.id)
+		FROM user_suggestions s
+		JOIN users u ON u.id = s.suggested_id
+		WHERE s.user_id = $1 AND ` + notSuggestable + `
+		ORDER BY s.score DESC
+		LIMIT $2`
+
+	rows, err := m.DB.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(
+			&suggestion.UserID,
+			&suggestion.Username,
+			&suggestion.Reason,
+			&suggestion.Score,
+			&suggestion.FollowerCount,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	return suggestions, true, nil
+}
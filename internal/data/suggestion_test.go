@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// suggestionSummary describes suggestions as username:reason:followers.
+func suggestionSummary(suggestions []*Suggestion) string {
+	var summary []string
+	for _, s := range suggestions {
+		summary = append(summary, fmt.Sprintf("%s:%s:%d", s.Username, s.Reason, s.FollowerCount))
+	}
+	return fmt.Sprint(summary)
+}
+
+func TestSuggestions(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	dave := insertUser(t, models, "dave")
+	erin := insertUser(t, models, "erin")
+	frank := insertUser(t, models, "frank")
+	gina := insertUser(t, models, "gina")
+
+	suggestions, computed, err := models.Suggestions.Get(ctx, alice.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestions != nil || computed {
+		t.Errorf("got %+v, %t before computing; want nothing", suggestions, computed)
+	}
+
+	// Carol is followed by someone Alice follows, Alice has liked two of
+	// Dave's photos, and Erin is followed by two people. Alice already
+	// follows Bob, Frank is private and Gina has blocked Alice.
+	insertFollow(t, models, alice, bob)
+	insertFollow(t, models, bob, carol)
+	insertFollow(t, models, carol, erin)
+	insertFollow(t, models, dave, erin)
+	insertFollow(t, models, bob, frank)
+	insertFollow(t, models, carol, gina)
+	insertFollow(t, models, dave, gina)
+
+	insertLike(t, models, insertPhoto(t, models, dave, "beach"), alice)
+	insertLike(t, models, insertPhoto(t, models, dave, "forest"), alice)
+	insertLike(t, models, insertPhoto(t, models, frank, "lake"), alice)
+
+	setPrivate(t, models, frank)
+	insertBlock(t, models, gina, alice)
+
+	err = models.Suggestions.Refresh(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suggestions, computed, err = models.Suggestions.Get(ctx, alice.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("[dave:%s:0 carol:%s:1 erin:%s:2]", SuggestionLiked, SuggestionMutual, SuggestionPopular)
+	if got := suggestionSummary(suggestions); !computed || got != want {
+		t.Errorf("got %s, %t; want %s", got, computed, want)
+	}
+
+	suggestions, _, err = models.Suggestions.Get(ctx, alice.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 1 || suggestions[0].UserID != dave.ID {
+		t.Errorf("got %s; want dave only", suggestionSummary(suggestions))
+	}
+
+	// Accounts followed since the suggestions were computed are left out.
+	insertFollow(t, models, alice, dave)
+
+	suggestions, _, err = models.Suggestions.Get(ctx, alice.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 || suggestions[0].UserID != carol.ID || suggestions[1].UserID != erin.ID {
+		t.Errorf("got %s; want carol and erin", suggestionSummary(suggestions))
+	}
+
+	// Refreshing replaces the stored suggestions.
+	err = models.Suggestions.Refresh(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM user_suggestions WHERE user_id = $1`, alice.ID); n != 2 {
+		t.Errorf("got %d stored suggestions; want 2", n)
+	}
+	if n := count(t, `SELECT COUNT(*) FROM suggestion_sets`); n != 1 {
+		t.Errorf("got %d suggestion sets; want 1", n)
+	}
+}
+
+func TestSuggestionRefreshConcurrent(t *testing.T) {
+	models := newTestModels(t)
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	insertFollow(t, models, bob, insertUser(t, models, "carol"))
+
+	errs := make(chan error)
+	for range 5 {
+		go func() {
+			errs <- models.Suggestions.Refresh(context.Background(), alice.ID)
+		}()
+	}
+
+	for range 5 {
+		err := <-errs
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM user_suggestions WHERE user_id = $1`, alice.ID); n != 1 {
+		t.Errorf("got %d stored suggestions; want 1", n)
+	}
+}
+
+func TestSuggestionRefreshStale(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+	carol := insertUser(t, models, "carol")
+	insertUser(t, models, "dave")
+
+	for _, user := range []*User{alice, bob, carol} {
+		err := models.Suggestions.Refresh(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := models.Suggestions.RefreshStale(ctx, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("refreshed %d users with fresh suggestions; want 0", n)
+	}
+
+	exec(t, `UPDATE suggestion_sets SET computed_at = NOW() - INTERVAL '3 hours' WHERE user_id = $1`, alice.ID)
+	exec(t, `UPDATE suggestion_sets SET computed_at = NOW() - INTERVAL '2 hours' WHERE user_id = $1`, bob.ID)
+
+	// Carol became popular since the suggestions were computed.
+	insertFollow(t, models, bob, carol)
+
+	// Only the stalest user fits in the limit.
+	n, err = models.Suggestions.RefreshStale(ctx, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("refreshed %d users; want 1", n)
+	}
+
+	for user, want := range map[*User]int{alice: 1, bob: 0} {
+		if got := count(t, `SELECT COUNT(*) FROM user_suggestions WHERE user_id = $1`, user.ID); got != want {
+			t.Errorf("got %d suggestions for %s; want %d", got, user.Username, want)
+		}
+	}
+
+	n, err = models.Suggestions.RefreshStale(ctx, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("refreshed %d users; want 1", n)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM suggestion_sets WHERE computed_at < NOW() - INTERVAL '1 hour'`); n != 0 {
+		t.Errorf("got %d stale suggestion sets after refreshing; want 0", n)
+	}
+
+	// Users who have never asked for suggestions aren't computed.
+	if n := count(t, `SELECT COUNT(*) FROM suggestion_sets`); n != 3 {
+		t.Errorf("got %d suggestion sets; want 3", n)
+	}
+}
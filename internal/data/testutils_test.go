@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"athifirshad.com/bettergram/internal/database"
+	"athifirshad.com/bettergram/migrations"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testDB is a throwaway database with every migration applied. It is nil
+// unless TEST_DB_DSN is set, and the tests using it are skipped when it isn't.
+var testDB *pgxpool.Pool
+
+// testTables lists the tables truncated before each test.
+var testTables string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		return m.Run()
+	}
+
+	BcryptCost = bcrypt.MinCost
+
+	drop, err := openTestDB(dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test database: %v\n", err)
+		return 1
+	}
+	defer func() {
+		err := drop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dropping test database: %v\n", err)
+		}
+	}()
+
+	return m.Run()
+}
+
+// openTestDB creates a uniquely named database on the server dsn points at,
+// migrates it and sets testDB. The returned function closes testDB and drops
+// the database, so the role in dsn needs the CREATEDB privilege.
+func openTestDB(dsn string) (func() error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "bettergram_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = conn.Exec(ctx, `CREATE DATABASE `+pgx.Identifier{name}.Sanitize())
+	if err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	drop := func() error {
+		if testDB != nil {
+			testDB.Close()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		defer conn.Close(ctx)
+
+		_, err := conn.Exec(ctx, `DROP DATABASE `+pgx.Identifier{name}.Sanitize()+` WITH (FORCE)`)
+		return err
+	}
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return drop, err
+	}
+	config.ConnConfig.Database = name
+
+	testDB, err = pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return drop, err
+	}
+
+	migrator, err := database.NewMigrator(testDB, migrations.FS)
+	if err != nil {
+		return drop, err
+	}
+
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		return drop, err
+	}
+
+	err = testDB.QueryRow(ctx, `
+		SELECT string_agg(quote_ident(tablename), ', ')
+		FROM pg_tables
+		WHERE schemaname = 'public' AND tablename <> 'schema_migrations'`).Scan(&testTables)
+	return drop, err
+}
+
+// newTestModels empties every table in the test database and returns models
+// backed by it. The test is skipped if TEST_DB_DSN isn't set.
+func newTestModels(t *testing.T) Models {
+	t.Helper()
+
+	if testDB == nil {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	_, err := testDB.Exec(context.Background(), `TRUNCATE `+testTables+` RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewModels(testDB, Timeouts{Read: 5 * time.Second, Write: 5 * time.Second, List: 5 * time.Second})
+}
+
+// exec runs a statement against the test database, for setting up state the
+// models have no method for, such as backdating a row.
+func exec(t *testing.T, query string, args ...any) {
+	t.Helper()
+
+	_, err := testDB.Exec(context.Background(), query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// count returns the result of a SELECT COUNT(*) query.
+func count(t *testing.T, query string, args ...any) int {
+	t.Helper()
+
+	var n int
+	err := testDB.QueryRow(context.Background(), query, args...).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// insertUser adds a user with the email <username>@example.com and the
+// password pa55word.
+func insertUser(t *testing.T, models Models, username string) *User {
+	t.Helper()
+
+	user := &User{Username: username, Email: username + "@example.com"}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func setPrivate(t *testing.T, models Models, user *User) {
+	t.Helper()
+
+	user.IsPrivate = true
+
+	err := models.Users.Update(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func insertPhoto(t *testing.T, models Models, user *User, caption string) *Photo {
+	t.Helper()
+
+	photo := &Photo{
+		UserID:   user.ID,
+		Username: user.Username,
+		PhotoURL: "/uploads/" + caption + ".jpg",
+		Caption:  caption,
+	}
+
+	err := models.Photos.Insert(context.Background(), photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photo
+}
+
+func insertComment(t *testing.T, models Models, photo *Photo, user *User, content string) *Comment {
+	t.Helper()
+
+	comment := &Comment{PhotoID: photo.ID, UserID: user.ID, Content: content}
+
+	err := models.Comments.Insert(context.Background(), comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comment
+}
+
+func insertLike(t *testing.T, models Models, photo *Photo, user *User) {
+	t.Helper()
+
+	err := models.Likes.Insert(context.Background(), &Like{PhotoID: photo.ID, UserID: user.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// insertFollow makes follower follow followee, approving the request if
+// followee is private.
+func insertFollow(t *testing.T, models Models, follower, followee *User) {
+	t.Helper()
+
+	follow := &Follow{FollowerID: follower.ID, FolloweeID: followee.ID}
+
+	err := models.Follows.Insert(context.Background(), follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if follow.Pending {
+		err = models.Follows.Approve(context.Background(), followee.ID, follower.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func insertBlock(t *testing.T, models Models, blocker, blocked *User) {
+	t.Helper()
+
+	err := models.Blocks.Insert(context.Background(), &Block{BlockerID: blocker.ID, BlockedID: blocked.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// photoIDs returns the IDs of photos, in order, for comparing results.
+func photoIDs(photos []*Photo) []uuid.UUID {
+	ids := make([]uuid.UUID, len(photos))
+	for i, photo := range photos {
+		ids[i] = photo.ID
+	}
+	return ids
+}
+
+func checkPhotos(t *testing.T, got []*Photo, want ...*Photo) {
+	t.Helper()
+
+	gotIDs, wantIDs := photoIDs(got), photoIDs(want)
+	if fmt.Sprint(gotIDs) != fmt.Sprint(wantIDs) {
+		t.Errorf("got photos %v; want %v", gotIDs, wantIDs)
+	}
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenNew(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	token, err := models.Tokens.New(ctx, alice.ID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token.Plaintext) != 26 || len(token.Hash) != 32 || token.UserID != alice.ID {
+		t.Errorf("got token %+v", token)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM tokens WHERE hash = $1 AND scope = $2`, token.Hash, ScopeAuthentication); n != 1 {
+		t.Errorf("got %d stored tokens; want 1", n)
+	}
+
+	// Tokens belong to an existing user.
+	_, err = models.Tokens.New(ctx, alice.ID+1, time.Hour, ScopeAuthentication)
+	if err == nil {
+		t.Error("got no error for a token of an unknown user")
+	}
+}
+
+func TestTokenDeleteAllForUser(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	var tokens []*Token
+	for _, tt := range []struct {
+		user  *User
+		scope string
+	}{
+		{alice, ScopeAuthentication},
+		{alice, ScopeAuthentication},
+		{alice, ScopeActivation},
+		{bob, ScopeAuthentication},
+	} {
+		token, err := models.Tokens.New(ctx, tt.user.ID, time.Hour, tt.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	err := models.Tokens.DeleteAllForUser(ctx, ScopeAuthentication, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []error{ErrRecordNotFound, ErrRecordNotFound, nil, nil} {
+		_, err := models.Users.GetForToken(ctx, tokens[i].Scope, tokens[i].Plaintext)
+		if !errors.Is(err, want) {
+			t.Errorf("token %d: got error %v; want %v", i, err, want)
+		}
+	}
+}
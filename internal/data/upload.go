@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrEditConflict is returned when a record was changed by another request
+// between being read and being updated.
+var ErrEditConflict = errors.New("edit conflict")
+
+// Upload represents a resumable upload session for a photo that has not been
+// finalized yet.
+type Upload struct {
+	ID             uuid.UUID `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Filename       string    `json:"filename"`
+	Caption        string    `json:"caption,omitempty"`
+	AltText        string    `json:"alt_text,omitempty"`
+	Latitude       *float64  `json:"latitude,omitempty"`
+	Longitude      *float64  `json:"longitude,omitempty"`
+	PlaceName      string    `json:"place_name,omitempty"`
+	ImportLocation bool      `json:"import_location"`
+	Length         int64     `json:"length"`
+	Offset         int64     `json:"offset"`
+	Checksum       []byte    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// Complete reports whether all bytes of the upload have been received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+type UploadModel struct {
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
+}
+
+// Insert creates a new upload session starting at offset zero.
+func (m UploadModel) Insert(ctx context.Context, upload *Upload) error {
+	query := `
+		INSERT INTO upload_sessions (user_id, filename, caption, alt_text, latitude, longitude, place_name, import_location, upload_length, checksum, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, upload_offset, created_at`
+
+	args := []interface{}{
+		upload.UserID,
+		upload.Filename,
+		upload.Caption,
+		upload.AltText,
+		upload.Latitude,
+		upload.Longitude,
+		upload.PlaceName,
+		upload.ImportLocation,
+		upload.Length,
+		upload.Checksum,
+		upload.ExpiresAt,
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRow(ctx, query, args...).Scan(&upload.ID, &upload.Offset, &upload.CreatedAt)
+}
+
+// Get retrieves an unexpired upload session owned by the given user.
+func (m UploadModel) Get(ctx context.Context, id uuid.UUID, userID int64) (*Upload, error) {
+	query := `
+		SELECT id, user_id, filename, COALESCE(caption, ''), alt_text, latitude, longitude, place_name, import_location, upload_length, upload_offset, checksum, created_at, expires_at
+		FROM upload_sessions
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()`
+
+	var upload Upload
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, id, userID).Scan(
+		&upload.ID,
+		&upload.UserID,
+		&upload.Filename,
+		&upload.Caption,
+		&upload.AltText,
+		&upload.Latitude,
+		&upload.Longitude,
+		&upload.PlaceName,
+		&upload.ImportLocation,
+		&upload.Length,
+		&upload.Offset,
+		&upload.Checksum,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &upload, nil
+}
+
+// UpdateOffset advances the offset of an upload session and pushes back its
+// expiry. It returns ErrEditConflict if the stored offset no longer matches
+// upload.Offset, which happens when two chunks for the same session race.
+func (m UploadModel) UpdateOffset(ctx context.Context, upload *Upload, offset int64, expiresAt time.Time) error {
+	query := `
+		UPDATE upload_sessions
+		SET upload_offset = $1, expires_at = $2
+		WHERE id = $3 AND upload_offset = $4`
+
+	args := []interface{}{offset, expiresAt, upload.ID, upload.Offset}
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	upload.Offset = offset
+	upload.ExpiresAt = expiresAt
+	return nil
+}
+
+func (m UploadModel) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		DELETE FROM upload_sessions
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, id)
+	return err
+}
+
+// DeleteExpired removes all abandoned upload sessions and returns their IDs so
+// the caller can clean up any partially written files.
+func (m UploadModel) DeleteExpired(ctx context.Context) ([]uuid.UUID, error) {
+	query := `
+		DELETE FROM upload_sessions
+		WHERE expires_at <= NOW()
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
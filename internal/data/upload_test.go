@@ -0,0 +1,164 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func insertUpload(t *testing.T, models Models, user *User, expiresAt time.Time) *Upload {
+	t.Helper()
+
+	upload := &Upload{UserID: user.ID, Filename: "beach.jpg", Length: 100, ExpiresAt: expiresAt}
+
+	err := models.Uploads.Insert(context.Background(), upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload
+}
+
+func TestUploadInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	latitude, longitude := 51.5074, -0.1278
+
+	upload := &Upload{
+		UserID:         alice.ID,
+		Filename:       "beach.jpg",
+		Caption:        "beach",
+		AltText:        "Waves on sand",
+		Latitude:       &latitude,
+		Longitude:      &longitude,
+		PlaceName:      "London",
+		ImportLocation: true,
+		Length:         100,
+		Checksum:       []byte{1, 2, 3},
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	err := models.Uploads.Insert(ctx, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.ID == uuid.Nil || upload.Offset != 0 || upload.CreatedAt.IsZero() {
+		t.Errorf("got upload %+v; want a new session at offset zero", upload)
+	}
+
+	got, err := models.Uploads.Get(ctx, upload.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Filename != "beach.jpg" || got.Caption != "beach" || got.AltText != "Waves on sand" || got.PlaceName != "London" ||
+		!got.ImportLocation || got.Length != 100 || fmt.Sprint(got.Checksum) != "[1 2 3]" ||
+		got.Latitude == nil || *got.Latitude != latitude || got.Longitude == nil || *got.Longitude != longitude || got.Complete() {
+		t.Errorf("got upload %+v", got)
+	}
+
+	expired := insertUpload(t, models, alice, time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name   string
+		id     uuid.UUID
+		userID int64
+	}{
+		{"another user's", upload.ID, bob.ID},
+		{"expired", expired.ID, alice.ID},
+		{"unknown", uuid.New(), alice.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Uploads.Get(ctx, tt.id, tt.userID)
+			if !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("got error %v; want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestUploadUpdateOffset(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	upload := insertUpload(t, models, alice, time.Now().Add(time.Minute))
+
+	// Two copies of the session, as two concurrent requests would read it.
+	stale := *upload
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+
+	err := models.Uploads.UpdateOffset(ctx, upload, 100, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Offset != 100 || !upload.ExpiresAt.Equal(expiresAt) || !upload.Complete() {
+		t.Errorf("got upload %+v; want it complete", upload)
+	}
+
+	err = models.Uploads.UpdateOffset(ctx, &stale, 50, expiresAt)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Errorf("got error %v; want ErrEditConflict", err)
+	}
+	if stale.Offset != 0 {
+		t.Errorf("got offset %d after a conflict; want it unchanged", stale.Offset)
+	}
+
+	got, err := models.Uploads.Get(ctx, upload.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != 100 || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got upload %+v; want offset 100 expiring at %s", got, expiresAt)
+	}
+}
+
+func TestUploadDelete(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	active := insertUpload(t, models, alice, time.Now().Add(time.Hour))
+	deleted := insertUpload(t, models, alice, time.Now().Add(time.Hour))
+	expired := insertUpload(t, models, alice, time.Now().Add(-time.Minute))
+
+	err := models.Uploads.Delete(ctx, deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = models.Uploads.Get(ctx, deleted.ID, alice.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v; want the session deleted", err)
+	}
+
+	ids, err := models.Uploads.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != expired.ID {
+		t.Errorf("got deleted sessions %v; want %s", ids, expired.ID)
+	}
+
+	ids, err = models.Uploads.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("got deleted sessions %v; want none", ids)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM upload_sessions`); n != 1 {
+		t.Errorf("got %d sessions; want %s only", n, active.ID)
+	}
+}
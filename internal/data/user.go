@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -11,9 +12,19 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+type UserModelInterface interface {
+	Insert(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Authenticate(ctx context.Context, email, plaintextPassword string) (*User, error)
+	GetByID(ctx context.Context, id int64) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+}
+
 // UserModel wraps the database connection pool
 type UserModel struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Timeouts Timeouts
 }
 
 // AnonymousUser represents a user who is not authenticated
@@ -21,11 +32,14 @@ var AnonymousUser = &User{}
 
 // User represents a user in the system
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
+	ID               int64     `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	Password         password  `json:"-"`
+	IsModerator      bool      `json:"is_moderator,omitempty"`
+	AltTextReminders bool      `json:"alt_text_reminders"`
+	IsPrivate        bool      `json:"is_private"`
 }
 
 // password stores both the hashed and plaintext versions of a password
@@ -36,14 +50,29 @@ type password struct {
 
 // Error variables for common user-related errors
 var (
-	ErrDuplicateEmail    = errors.New("duplicate email")
-	ErrDuplicateUsername = errors.New("duplicate username")
-	ErrRecordNotFound    = errors.New("record not found")
+	ErrDuplicateEmail     = errors.New("duplicate email")
+	ErrDuplicateUsername  = errors.New("duplicate username")
+	ErrRecordNotFound     = errors.New("record not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
+// BcryptCost is the work factor used to hash passwords. It must be set before
+// any password is hashed.
+var BcryptCost = 12
+
+// dummyPasswordHash is compared against when no user has the given email, so
+// that Authenticate takes as long whether or not the account exists
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), BcryptCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 // Set hashes the plaintext password and stores both versions
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), BcryptCost)
 	if err != nil {
 		return err
 	}
@@ -67,14 +96,14 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 // Insert adds a new user to the database
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
 		INSERT INTO users (username, email, password_hash) 
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at`
 
 	args := []interface{}{user.Username, user.Email, user.Password.hash}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	err := m.DB.QueryRow(ctx, query, args...).Scan(&user.ID, &user.CreatedAt)
@@ -92,14 +121,14 @@ func (m UserModel) Insert(user *User) error {
 }
 
 // GetByEmail retrieves a user from the database by their email address
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password_hash
+		SELECT id, created_at, username, email, password_hash, is_moderator, alt_text_reminders, is_private
 		FROM users
 		WHERE email = $1`
 
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
 	err := m.DB.QueryRow(ctx, query, email).Scan(
@@ -108,6 +137,71 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Username,
 		&user.Email,
 		&user.Password.hash,
+		&user.IsModerator,
+		&user.AltTextReminders,
+		&user.IsPrivate,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// Authenticate returns the user with the given email and password, or
+// ErrInvalidCredentials. A password is checked even when there is no such
+// user, so that the response time doesn't reveal which emails are registered.
+func (m UserModel) Authenticate(ctx context.Context, email, plaintextPassword string) (*User, error) {
+	user, err := m.GetByEmail(ctx, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			dummy := password{hash: dummyPasswordHash()}
+			_, err := dummy.Matches(plaintextPassword)
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidCredentials
+		default:
+			return nil, err
+		}
+	}
+
+	match, err := user.Password.Matches(plaintextPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// GetByID retrieves a user from the database by their ID
+func (m UserModel) GetByID(ctx context.Context, id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, username, email, password_hash, is_moderator, alt_text_reminders, is_private
+		FROM users
+		WHERE id = $1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.IsModerator,
+		&user.AltTextReminders,
+		&user.IsPrivate,
 	)
 	if err != nil {
 		switch {
@@ -121,20 +215,22 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 }
 
 // Update modifies an existing user's information in the database
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users 
-		SET username = $1, email = $2, password_hash = $3
-		WHERE id = $4`
+		SET username = $1, email = $2, password_hash = $3, alt_text_reminders = $4, is_private = $5
+		WHERE id = $6`
 
 	args := []interface{}{
 		user.Username,
 		user.Email,
 		user.Password.hash,
+		user.AltTextReminders,
+		user.IsPrivate,
 		user.ID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	_, err := m.DB.Exec(ctx, query, args...)
@@ -151,11 +247,11 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-    SELECT users.id, users.created_at, users.username, users.email, users.password_hash
+    SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.is_moderator, users.alt_text_reminders, users.is_private
     FROM users
     INNER JOIN tokens
     ON users.id = tokens.user_id
@@ -166,7 +262,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
 	err := m.DB.QueryRow(ctx, query, args...).Scan(
@@ -175,6 +271,9 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Username,
 		&user.Email,
 		&user.Password.hash,
+		&user.IsModerator,
+		&user.AltTextReminders,
+		&user.IsPrivate,
 	)
 
 	if err != nil {
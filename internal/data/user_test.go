@@ -0,0 +1,311 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserInsert(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	if alice.ID == 0 || alice.CreatedAt.IsZero() {
+		t.Errorf("got user %+v; want the ID and creation time set", alice)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		want     error
+	}{
+		{"duplicate email", "bob", "alice@example.com", ErrDuplicateEmail},
+		{"duplicate username", "alice", "bob@example.com", ErrDuplicateUsername},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Username: tt.username, Email: tt.email}
+			user.Password.Set("pa55word")
+
+			err := models.Users.Insert(ctx, user)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserGet(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	byEmail, err := models.Users.GetByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID, err := models.Users.GetByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []*User{byEmail, byID} {
+		if user.ID != alice.ID || user.Username != "alice" || user.Email != "alice@example.com" {
+			t.Errorf("got user %+v; want alice", user)
+		}
+		if match, _ := user.Password.Matches("pa55word"); !match {
+			t.Error("password hash was not stored")
+		}
+	}
+
+	_, err = models.Users.GetByEmail(ctx, "nobody@example.com")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown email; want ErrRecordNotFound", err)
+	}
+
+	_, err = models.Users.GetByID(ctx, alice.ID+1)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got error %v for an unknown ID; want ErrRecordNotFound", err)
+	}
+}
+
+func TestUserAuthenticate(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	user, err := models.Users.Authenticate(ctx, "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Errorf("got user %d; want %d", user.ID, alice.ID)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "alice@example.com", "wrong"},
+		{"unknown email", "nobody@example.com", "pa55word"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Users.Authenticate(ctx, tt.email, tt.password)
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got error %v; want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestUserUpdate(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	insertUser(t, models, "bob")
+
+	alice.Username = "alice2"
+	alice.AltTextReminders = true
+	alice.IsPrivate = true
+	alice.Password.Set("new pa55word")
+
+	err := models.Users.Update(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := models.Users.GetByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Username != "alice2" || !got.AltTextReminders || !got.IsPrivate {
+		t.Errorf("got user %+v; want the updated fields", got)
+	}
+	if match, _ := got.Password.Matches("new pa55word"); !match {
+		t.Error("password was not updated")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		want     error
+	}{
+		{"duplicate email", "alice2", "bob@example.com", ErrDuplicateEmail},
+		{"duplicate username", "bob", "alice@example.com", ErrDuplicateUsername},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := *got
+			user.Username = tt.username
+			user.Email = tt.email
+
+			err := models.Users.Update(ctx, &user)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserGetForToken(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+
+	token, err := models.Tokens.New(ctx, alice.ID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := models.Users.GetForToken(ctx, ScopeAuthentication, token.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Errorf("got user %d; want %d", user.ID, alice.ID)
+	}
+
+	expired, err := generateToken(alice.ID, -time.Minute, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Tokens.Insert(ctx, expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		scope     string
+		plaintext string
+	}{
+		{"expired", ScopeAuthentication, expired.Plaintext},
+		{"wrong scope", ScopeActivation, token.Plaintext},
+		{"unknown", ScopeAuthentication, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Users.GetForToken(ctx, tt.scope, tt.plaintext)
+			if !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("got error %v; want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+// TestUserDeleteCascades checks that deleting an account removes everything
+// the user created and everything that referred to them.
+func TestUserDeleteCascades(t *testing.T) {
+	models := newTestModels(t)
+	ctx := context.Background()
+
+	alice := insertUser(t, models, "alice")
+	bob := insertUser(t, models, "bob")
+
+	_, err := models.Tokens.New(ctx, bob.ID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	photo := insertPhoto(t, models, alice, "beach")
+	bobsPhoto := insertPhoto(t, models, bob, "forest")
+
+	comment := insertComment(t, models, photo, bob, "Nice")
+	insertComment(t, models, photo, alice, "Thanks @bob")
+	insertFollow(t, models, bob, alice)
+
+	err = models.Likes.Insert(ctx, &Like{PhotoID: photo.ID, UserID: bob.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.CommentReactions.Insert(ctx, &CommentReaction{CommentID: comment.ID, UserID: bob.ID, Reaction: DefaultReaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Notifications.Insert(ctx, &Notification{UserID: alice.ID, ActorID: bob.ID, Type: NotificationFollow})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = models.Mentions.Replace(ctx, alice.ID, photo.ID, nil, ParseMentions("Hi @bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Saves.Insert(ctx, bob.ID, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := models.Conversations.Insert(ctx, bob.ID, []int64{alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Messages.Insert(ctx, &Message{ConversationID: id, SenderID: bob.ID, Content: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, `DELETE FROM users WHERE id = $1`, bob.ID)
+
+	for _, table := range []struct {
+		name  string
+		query string
+	}{
+		{"tokens", `SELECT COUNT(*) FROM tokens WHERE user_id = $1`},
+		{"photos", `SELECT COUNT(*) FROM photos WHERE user_id = $1`},
+		{"comments", `SELECT COUNT(*) FROM comments WHERE user_id = $1`},
+		{"likes", `SELECT COUNT(*) FROM likes WHERE user_id = $1`},
+		{"comment_reactions", `SELECT COUNT(*) FROM comment_reactions WHERE user_id = $1`},
+		{"follows", `SELECT COUNT(*) FROM follows WHERE follower_id = $1 OR followee_id = $1`},
+		{"notifications", `SELECT COUNT(*) FROM notifications WHERE actor_id = $1`},
+		{"mentions", `SELECT COUNT(*) FROM mentions WHERE user_id = $1`},
+		{"saved_photos", `SELECT COUNT(*) FROM saved_photos WHERE user_id = $1`},
+		{"conversation_members", `SELECT COUNT(*) FROM conversation_members WHERE user_id = $1`},
+		{"messages", `SELECT COUNT(*) FROM messages WHERE sender_id = $1`},
+	} {
+		if n := count(t, table.query, bob.ID); n != 0 {
+			t.Errorf("%d rows left in %s", n, table.name)
+		}
+	}
+
+	_, err = models.Photos.GetByID(ctx, bobsPhoto.ID)
+	if err == nil {
+		t.Error("bob's photo still exists")
+	}
+
+	// Alice's photo and her own comment are untouched, and the conversation
+	// outlives its creator.
+	comments, err := models.Comments.GetByPhotoID(ctx, photo.ID, CommentSortNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].UserID != alice.ID {
+		t.Errorf("got comments %+v; want only alice's", comments)
+	}
+
+	if n := count(t, `SELECT COUNT(*) FROM conversations WHERE id = $1 AND created_by IS NULL`, id); n != 1 {
+		t.Error("conversation was not kept with no creator")
+	}
+}
@@ -21,6 +21,7 @@ func New(dsn string) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	config.ConnConfig.Tracer = queryTracer{}
 
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockID is the advisory lock held while migrations run, so that
+// instances starting together don't apply the same migration twice.
+const migrationLockID = 0x6d696772617465
+
+var ErrDirty = errors.New("database is dirty")
+
+var rxMigration = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a single schema change and the SQL that reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrator applies migrations, recording the current version in the same
+// schema_migrations table used by the migrate CLI so either can be used on
+// the same database. Each migration runs in its own transaction together
+// with the version update, so a failed migration leaves nothing behind.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator reads the migrations in fsys, which are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func NewMigrator(pool *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := rxMigration.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		sql, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		switch match[3] {
+		case "up":
+			migration.up = string(sql)
+		case "down":
+			migration.down = string(sql)
+		}
+	}
+
+	m := &Migrator{pool: pool}
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+
+	slices.SortFunc(m.migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return m, nil
+}
+
+// Migrations returns every known migration, oldest first.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Version returns the version of the last applied migration, or 0 if none
+// have been, and whether a migration failed part-way.
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		version, dirty, err = readVersion(ctx, conn)
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// Up applies every migration newer than the current version, returning those
+// applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			err := m.apply(ctx, conn, migration, migration.up, migration.Version)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last n applied migrations, returning those reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for range n {
+			if version == 0 {
+				break
+			}
+
+			i := slices.IndexFunc(m.migrations, func(migration Migration) bool {
+				return migration.Version == version
+			})
+			if i < 0 {
+				return fmt.Errorf("database is at version %d, which has no migration", version)
+			}
+
+			migration := m.migrations[i]
+			if migration.down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			err := m.apply(ctx, conn, migration, migration.down, previous)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+			version = previous
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// withLock runs fn on a single connection holding the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty BOOLEAN NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// cleanVersion returns the current version, or ErrDirty if a migration run
+// by the migrate CLI failed part-way and the schema needs fixing by hand.
+func (m *Migrator) cleanVersion(ctx context.Context, conn *pgxpool.Conn) (int64, error) {
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%w: migration %d failed part-way; fix the schema and clear schema_migrations.dirty", ErrDirty, version)
+	}
+
+	return version, nil
+}
+
+// apply runs sql and records version as the current version in one
+// transaction.
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, migration Migration, sql string, version int64) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, sql)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM schema_migrations`)
+		if err != nil {
+			return err
+		}
+
+		if version == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+func readVersion(ctx context.Context, conn *pgxpool.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
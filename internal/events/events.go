@@ -0,0 +1,228 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel is the Postgres NOTIFY channel events are published on.
+const Channel = "bettergram_events"
+
+// maxPayload keeps notifications under Postgres' 8000 byte payload limit.
+const maxPayload = 7900
+
+// subscriptionBuffer is the number of events queued for a slow subscriber
+// before further events are dropped.
+const subscriptionBuffer = 32
+
+const (
+	TypeComment      = "comment"
+	TypeLike         = "like"
+	TypeNotification = "notification"
+	TypeMessage      = "message"
+)
+
+// Event is a change pushed to connected clients. Events addressed to a user
+// are delivered to that user's streams, and events about a photo to every
+// stream watching it.
+type Event struct {
+	Type    string          `json:"type"`
+	UserID  int64           `json:"user_id,omitempty"`
+	PhotoID *uuid.UUID      `json:"photo_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Subscription receives the events for one connected client. C is closed
+// when the broker shuts down.
+type Subscription struct {
+	C <-chan Event
+
+	c        chan Event
+	userID   int64
+	photoIDs map[uuid.UUID]bool
+}
+
+func (s *Subscription) wants(event Event) bool {
+	if event.UserID != 0 && event.UserID == s.userID {
+		return true
+	}
+	return event.PhotoID != nil && s.photoIDs[*event.PhotoID]
+}
+
+// Broker fans out events between API instances using Postgres LISTEN/NOTIFY.
+// A broker without a pool delivers events only to its own subscribers, which
+// is enough for a single instance and for tests.
+type Broker struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+func New(pool *pgxpool.Pool, logger *slog.Logger) *Broker {
+	return &Broker{
+		pool:   pool,
+		logger: logger,
+		subs:   map[*Subscription]bool{},
+	}
+}
+
+// Publish sends an event to every instance. If the event is too large for a
+// notification its data is dropped, and clients are expected to fetch it.
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxPayload {
+		event.Data = nil
+		payload, err = json.Marshal(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.pool == nil {
+		b.dispatch(event)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = b.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, Channel, string(payload))
+	return err
+}
+
+// Subscribe registers a client interested in events for userID and the given
+// photos. The subscription must be released with Unsubscribe.
+func (b *Broker) Subscribe(userID int64, photoIDs []uuid.UUID) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{
+		C:        c,
+		c:        c,
+		userID:   userID,
+		photoIDs: map[uuid.UUID]bool{},
+	}
+
+	for _, id := range photoIDs {
+		sub.photoIDs[id] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(c)
+		return sub
+	}
+
+	b.subs[sub] = true
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+func (b *Broker) dispatch(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if !sub.wants(event) {
+			continue
+		}
+
+		select {
+		case sub.c <- event:
+		default:
+			b.logger.Warn("dropped event for slow subscriber", "type", event.Type, "user_id", sub.userID)
+		}
+	}
+}
+
+// Run listens for notifications until ctx is cancelled, reconnecting if the
+// connection is lost. When it returns all subscriptions have been closed.
+func (b *Broker) Run(ctx context.Context) {
+	defer b.close()
+
+	if b.pool == nil {
+		<-ctx.Done()
+		return
+	}
+
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.Error("event listener disconnected", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	pooled, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The connection is taken out of the pool, since a connection that is
+	// listening on a channel can't be safely reused by other queries.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+Channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		err = json.Unmarshal([]byte(notification.Payload), &event)
+		if err != nil {
+			b.logger.Warn("invalid event payload", "error", err)
+			continue
+		}
+
+		b.dispatch(event)
+	}
+}
+
+func (b *Broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
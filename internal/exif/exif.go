@@ -0,0 +1,317 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ErrNotJPEG = errors.New("exif: not a JPEG image")
+
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1
+	markerAPPD = 0xED
+
+	tagOrientation = 0x0112
+	tagGPSIFD      = 0x8825
+	tagGPSLatRef   = 0x0001
+	tagGPSLat      = 0x0002
+	tagGPSLngRef   = 0x0003
+	tagGPSLng      = 0x0004
+
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Metadata holds the EXIF fields Bettergram cares about.
+type Metadata struct {
+	Orientation int
+	HasGPS      bool
+	Latitude    float64
+	Longitude   float64
+}
+
+// Read extracts metadata from the EXIF segment of a JPEG image. It returns
+// an empty Metadata if the image has no EXIF segment.
+func Read(src io.Reader) (*Metadata, error) {
+	metadata := &Metadata{}
+
+	err := walkSegments(bufio.NewReader(src), func(marker byte, payload []byte) error {
+		if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			parseTIFF(payload[len(exifHeader):], metadata)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// Strip copies a JPEG image from src to dst without its EXIF, XMP and
+// Photoshop metadata segments, which can contain the location, camera serial
+// numbers and other identifying details. The orientation is kept in a
+// minimal EXIF segment so the image still displays the right way up.
+func Strip(dst io.Writer, src io.Reader) error {
+	w := bufio.NewWriter(dst)
+
+	_, err := w.Write([]byte{0xFF, markerSOI})
+	if err != nil {
+		return err
+	}
+
+	err = walkSegments(bufio.NewReader(src), func(marker byte, payload []byte) error {
+		switch marker {
+		case markerAPP1:
+			if !bytes.HasPrefix(payload, exifHeader) {
+				return nil
+			}
+
+			var metadata Metadata
+			parseTIFF(payload[len(exifHeader):], &metadata)
+			if metadata.Orientation <= 1 {
+				return nil
+			}
+
+			payload = orientationSegment(metadata.Orientation)
+		case markerAPPD:
+			return nil
+		}
+
+		return writeSegment(w, marker, payload)
+	}, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// walkSegments calls fn for every marker segment before the start of the
+// image data. If rest is not nil, the start of scan segment and everything
+// after it is copied to rest once the headers have been walked.
+func walkSegments(r *bufio.Reader, fn func(marker byte, payload []byte) error, rest io.Writer) error {
+	var soi [2]byte
+
+	_, err := io.ReadFull(r, soi[:])
+	if err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return ErrNotJPEG
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0xFF {
+			return ErrNotJPEG
+		}
+
+		marker, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		// Markers may be preceded by any number of 0xFF fill bytes.
+		for marker == 0xFF {
+			marker, err = r.ReadByte()
+			if err != nil {
+				return err
+			}
+		}
+
+		if marker == markerSOS {
+			if rest == nil {
+				return nil
+			}
+
+			_, err = rest.Write([]byte{0xFF, marker})
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(rest, r)
+			return err
+		}
+
+		var length [2]byte
+		_, err = io.ReadFull(r, length[:])
+		if err != nil {
+			return err
+		}
+
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return ErrNotJPEG
+		}
+
+		payload := make([]byte, size-2)
+		_, err = io.ReadFull(r, payload)
+		if err != nil {
+			return err
+		}
+
+		err = fn(marker, payload)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeSegment(w io.Writer, marker byte, payload []byte) error {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+	return err
+}
+
+// orientationSegment builds an EXIF payload containing only the orientation.
+func orientationSegment(orientation int) []byte {
+	payload := append([]byte{}, exifHeader...)
+	payload = append(payload, 'M', 'M', 0, 42, 0, 0, 0, 8)
+	payload = binary.BigEndian.AppendUint16(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, tagOrientation)
+	payload = binary.BigEndian.AppendUint16(payload, typeShort)
+	payload = binary.BigEndian.AppendUint32(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, uint16(orientation))
+	payload = append(payload, 0, 0)
+	payload = binary.BigEndian.AppendUint32(payload, 0)
+	return payload
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parseTIFF reads the orientation and GPS position from a TIFF structure.
+// Malformed data is ignored rather than reported, since metadata is optional.
+func parseTIFF(tiff []byte, metadata *Metadata) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+
+	if entry, ok := ifd0[tagOrientation]; ok && entry.typ == typeShort && len(entry.value) >= 2 {
+		metadata.Orientation = int(order.Uint16(entry.value))
+	}
+
+	entry, ok := ifd0[tagGPSIFD]
+	if !ok || entry.typ != typeLong || len(entry.value) < 4 {
+		return
+	}
+
+	gps := readIFD(tiff, order, order.Uint32(entry.value))
+
+	lat, latOK := readCoordinate(gps[tagGPSLat], order)
+	lng, lngOK := readCoordinate(gps[tagGPSLng], order)
+	if !latOK || !lngOK {
+		return
+	}
+
+	if ref, ok := gps[tagGPSLatRef]; ok && len(ref.value) > 0 && ref.value[0] == 'S' {
+		lat = -lat
+	}
+	if ref, ok := gps[tagGPSLngRef]; ok && len(ref.value) > 0 && ref.value[0] == 'W' {
+		lng = -lng
+	}
+
+	metadata.HasGPS = true
+	metadata.Latitude = lat
+	metadata.Longitude = lng
+}
+
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]ifdEntry {
+	entries := map[uint16]ifdEntry{}
+
+	if int64(offset)+2 > int64(len(tiff)) {
+		return entries
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+
+	for i := 0; i < count; i++ {
+		pos := start + i*12
+		if pos+12 > len(tiff) {
+			break
+		}
+
+		tag := order.Uint16(tiff[pos:])
+		typ := order.Uint16(tiff[pos+2:])
+		n := order.Uint32(tiff[pos+4:])
+
+		size := int64(n) * typeSize(typ)
+		value := tiff[pos+8 : pos+12]
+		if size > 4 {
+			valueOffset := int64(order.Uint32(tiff[pos+8:]))
+			if valueOffset+size > int64(len(tiff)) {
+				continue
+			}
+			value = tiff[valueOffset : valueOffset+size]
+		}
+
+		entries[tag] = ifdEntry{typ: typ, count: n, value: value}
+	}
+
+	return entries
+}
+
+func typeSize(typ uint16) int64 {
+	switch typ {
+	case typeShort:
+		return 2
+	case typeLong:
+		return 4
+	case typeRational:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// readCoordinate converts a degrees, minutes, seconds triple of rationals to
+// decimal degrees.
+func readCoordinate(entry ifdEntry, order binary.ByteOrder) (float64, bool) {
+	if entry.typ != typeRational || entry.count != 3 || len(entry.value) < 24 {
+		return 0, false
+	}
+
+	var parts [3]float64
+	for i := range parts {
+		num := order.Uint32(entry.value[i*8:])
+		den := order.Uint32(entry.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
@@ -0,0 +1,68 @@
+package imagehash
+
+import "image"
+
+const (
+	gridWidth  = 9
+	gridHeight = 8
+)
+
+// Difference computes a 64-bit difference hash (dHash) of img. The image is
+// reduced to a 9x8 grid of average brightness values and each bit records
+// whether a cell is brighter than its right-hand neighbour. Resizing,
+// recompression and small colour changes leave most bits unchanged, so
+// visually similar images have hashes a small Hamming distance apart.
+func Difference(img image.Image) uint64 {
+	var (
+		sums   [gridHeight][gridWidth]uint64
+		counts [gridHeight][gridWidth]uint64
+	)
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+
+	for y := 0; y < height; y++ {
+		row := y * gridHeight / height
+
+		for x := 0; x < width; x++ {
+			col := x * gridWidth / width
+
+			var luma uint64
+			if isYCbCr {
+				luma = uint64(ycbcr.Y[ycbcr.YOffset(bounds.Min.X+x, bounds.Min.Y+y)])
+			} else {
+				r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				luma = (19595*uint64(r) + 38470*uint64(g) + 7471*uint64(b) + 1<<15) >> 24
+			}
+
+			sums[row][col] += luma
+			counts[row][col]++
+		}
+	}
+
+	var grid [gridHeight][gridWidth]uint64
+	for row := range grid {
+		for col := range grid[row] {
+			if counts[row][col] > 0 {
+				grid[row][col] = sums[row][col] / counts[row][col]
+			}
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < gridHeight; row++ {
+		for col := 0; col < gridWidth-1; col++ {
+			hash <<= 1
+			if grid[row][col] > grid[row][col+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
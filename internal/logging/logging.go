@@ -0,0 +1,68 @@
+// Package logging builds the API's slog handler and carries the request ID
+// that is added to every log line written while handling a request.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/lmittmann/tint"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// NewHandler returns a handler writing records at or above level to w, as
+// colourised text for development or as one JSON object per line for log
+// collectors in production. Records are tagged with the request ID from their
+// context.
+func NewHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	var h slog.Handler
+	switch format {
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	default:
+		h = tint.NewHandler(w, &tint.Options{Level: level})
+	}
+
+	return &requestIDHandler{Handler: h}
+}
+
+type contextKey string
+
+const requestIDContextKey = contextKey("requestID")
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h *requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestIDHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *requestIDHandler) WithGroup(name string) slog.Handler {
+	return &requestIDHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,136 @@
+// Package metrics collects the Prometheus metrics exposed on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"athifirshad.com/bettergram/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bettergram"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	// HTTP requests, labelled by chi route pattern rather than URL so that
+	// IDs don't create a series each.
+	Requests         *prometheus.CounterVec
+	RequestDuration  *prometheus.HistogramVec
+	RequestsInFlight prometheus.Gauge
+
+	// UploadBytes counts the bytes of stored photos and stories, by type.
+	UploadBytes *prometheus.CounterVec
+
+	// Background work tracked by the application's wait group.
+	BackgroundTasks    prometheus.Gauge
+	BackgroundTaskRuns *prometheus.CounterVec
+	JobRuns            *prometheus.CounterVec
+
+	Registrations prometheus.Counter
+	Photos        prometheus.Counter
+	Likes         prometheus.Counter
+	Comments      prometheus.Counter
+}
+
+// New registers the application's metrics together with the Go runtime,
+// process and connection pool statistics of db. The pool statistics are left
+// out if db is nil.
+func New(db *database.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		RequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being handled.",
+		}),
+		UploadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upload_bytes_total",
+			Help:      "Bytes of uploaded images stored, by type (photo or story).",
+		}, []string{"type"}),
+		BackgroundTasks: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "background_tasks_running",
+			Help:      "Background tasks currently running.",
+		}),
+		BackgroundTaskRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "background_tasks_total",
+			Help:      "Background tasks finished, by result (ok or error).",
+		}, []string{"result"}),
+		JobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_runs_total",
+			Help:      "Runs of periodic background jobs, by job and result (ok or error).",
+		}, []string{"job", "result"}),
+		Registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Users registered.",
+		}),
+		Photos: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "photos_total",
+			Help:      "Photos posted.",
+		}),
+		Likes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "likes_total",
+			Help:      "Likes and other reactions added to photos.",
+		}),
+		Comments: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "comments_total",
+			Help:      "Comments posted.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Requests,
+		m.RequestDuration,
+		m.RequestsInFlight,
+		m.UploadBytes,
+		m.BackgroundTasks,
+		m.BackgroundTaskRuns,
+		m.JobRuns,
+		m.Registrations,
+		m.Photos,
+		m.Likes,
+		m.Comments,
+	)
+
+	if db != nil {
+		m.registry.MustRegister(newPoolCollector(db))
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Result returns the result label for an error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
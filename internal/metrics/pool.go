@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"athifirshad.com/bettergram/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reports pgxpool statistics each time metrics are scraped.
+type poolCollector struct {
+	db *database.DB
+
+	acquiredConns       *prometheus.Desc
+	idleConns           *prometheus.Desc
+	constructingConns   *prometheus.Desc
+	totalConns          *prometheus.Desc
+	maxConns            *prometheus.Desc
+	acquires            *prometheus.Desc
+	acquireDuration     *prometheus.Desc
+	emptyAcquires       *prometheus.Desc
+	canceledAcquires    *prometheus.Desc
+	newConns            *prometheus.Desc
+	maxLifetimeDestroys *prometheus.Desc
+	maxIdleDestroys     *prometheus.Desc
+}
+
+func newPoolCollector(db *database.DB) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		db:                  db,
+		acquiredConns:       desc("acquired_connections", "Connections currently in use."),
+		idleConns:           desc("idle_connections", "Connections currently idle."),
+		constructingConns:   desc("constructing_connections", "Connections currently being opened."),
+		totalConns:          desc("connections", "Connections currently open."),
+		maxConns:            desc("max_connections", "Maximum size of the pool."),
+		acquires:            desc("acquires_total", "Connections acquired from the pool."),
+		acquireDuration:     desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:       desc("empty_acquires_total", "Acquires that had to wait because no connection was idle."),
+		canceledAcquires:    desc("canceled_acquires_total", "Acquires canceled by their context."),
+		newConns:            desc("new_connections_total", "Connections opened."),
+		maxLifetimeDestroys: desc("max_lifetime_destroys_total", "Connections closed for exceeding their maximum lifetime."),
+		maxIdleDestroys:     desc("max_idle_destroys_total", "Connections closed for being idle too long."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.db.Stat()
+
+	gauge := func(desc *prometheus.Desc, value int32) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+	}
+	counter := func(desc *prometheus.Desc, value int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value))
+	}
+
+	gauge(c.acquiredConns, stat.AcquiredConns())
+	gauge(c.idleConns, stat.IdleConns())
+	gauge(c.constructingConns, stat.ConstructingConns())
+	gauge(c.totalConns, stat.TotalConns())
+	gauge(c.maxConns, stat.MaxConns())
+	counter(c.acquires, stat.AcquireCount())
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquires, stat.EmptyAcquireCount())
+	counter(c.canceledAcquires, stat.CanceledAcquireCount())
+	counter(c.newConns, stat.NewConnsCount())
+	counter(c.maxLifetimeDestroys, stat.MaxLifetimeDestroyCount())
+	counter(c.maxIdleDestroys, stat.MaxIdleDestroyCount())
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps buckets in process memory. Limits only apply per instance.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]time.Time{}}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tat, result := take(m.buckets[key], time.Now(), limit)
+	m.buckets[key] = tat
+
+	return result, nil
+}
+
+func (m *Memory) Cleanup(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for key, tat := range m.buckets {
+		if tat.Before(now) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres keeps buckets in the rate_limits table so that limits are shared
+// by every instance. Times come from the database clock so that instances
+// with skewed clocks agree.
+type Postgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{pool: pool}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// The bucket is updated with the same rules as take in a single
+	// statement, so concurrent requests for one key are serialized by the
+	// row lock. allowed records whether this request advanced the TAT.
+	query := `
+		INSERT INTO rate_limits AS r (key, tat, allowed)
+		VALUES ($1, NOW() + make_interval(secs => $2::float8), true)
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = GREATEST(r.tat, NOW()) + make_interval(secs => $2::float8) - NOW() <= make_interval(secs => $3::float8),
+			tat = CASE
+				WHEN GREATEST(r.tat, NOW()) + make_interval(secs => $2::float8) - NOW() <= make_interval(secs => $3::float8)
+				THEN GREATEST(r.tat, NOW()) + make_interval(secs => $2::float8)
+				ELSE r.tat
+			END
+		RETURNING tat, allowed, NOW()`
+
+	var (
+		tat, now time.Time
+		allowed  bool
+	)
+
+	err := p.pool.QueryRow(ctx, query, key, limit.interval().Seconds(), limit.Period.Seconds()).Scan(&tat, &allowed, &now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed: allowed,
+		Limit:   limit.Requests,
+		Reset:   max(tat.Sub(now), 0),
+	}
+
+	result.Remaining = max(int((limit.Period-result.Reset)/limit.interval()), 0)
+	if !allowed {
+		result.RetryAfter = max(tat.Add(limit.interval()-limit.Period).Sub(now), 0)
+	}
+
+	return result, nil
+}
+
+func (p *Postgres) Cleanup(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM rate_limits WHERE tat < NOW()`)
+	return err
+}
@@ -0,0 +1,107 @@
+// Package ratelimit implements token bucket rate limiting using the generic
+// cell rate algorithm, which stores a single timestamp per bucket: the
+// theoretical arrival time (TAT) at which the bucket will be full again.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Period, in bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit written as "<requests>/<period>", such as
+// "10/1m".
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: must be <requests>/<period>", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive number", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+
+	*l = limit
+	return nil
+}
+
+// interval is the time it takes for one request to be replenished.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result describes the state of a bucket after a request.
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests that could be made right now.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, if this one
+	// was not.
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets. Take counts a request against the bucket for key,
+// and Cleanup forgets buckets that are full, which behave the same as ones
+// that don't exist.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Cleanup(ctx context.Context) error
+}
+
+// take applies a request at now to a bucket whose TAT is tat, returning the
+// new TAT and the result.
+func take(tat, now time.Time, limit Limit) (time.Time, Result) {
+	interval := limit.interval()
+
+	if tat.Before(now) {
+		tat = now
+	}
+
+	result := Result{Limit: limit.Requests}
+	next := tat.Add(interval)
+
+	if next.Sub(now) > limit.Period {
+		result.RetryAfter = next.Add(-limit.Period).Sub(now)
+	} else {
+		result.Allowed = true
+		tat = next
+	}
+
+	result.Reset = tat.Sub(now)
+	result.Remaining = int((limit.Period - result.Reset) / interval)
+	return tat, result
+}
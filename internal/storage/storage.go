@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("athifirshad.com/bettergram/internal/storage")
+
+// Store keeps uploaded files on disk under a key derived from the SHA-256
+// hash of their contents, so identical uploads share a single file. Files are
+// staged in StagingDir, outside Dir, so that uploads that haven't been checked
+// yet are never served.
+type Store struct {
+	Dir        string
+	StagingDir string
+}
+
+// Staged is a file that has been written and hashed but not yet moved to its
+// content-addressed location.
+type Staged struct {
+	Hash string
+	Size int64
+	path string
+}
+
+func New(dir, stagingDir string) (*Store, error) {
+	for _, d := range []string{dir, stagingDir} {
+		err := os.MkdirAll(d, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Store{Dir: dir, StagingDir: stagingDir}, nil
+}
+
+// Key returns the storage key for a content hash. Keys are relative to the
+// store directory and double as the path under /uploads/.
+func Key(hash string) string {
+	return hash[:2] + "/" + hash
+}
+
+// Stage copies src to a temporary file while hashing it. The caller must
+// either Commit or Discard the returned file.
+func (s *Store) Stage(ctx context.Context, src io.Reader) (staged *Staged, err error) {
+	_, span := tracer.Start(ctx, "storage.Stage")
+	defer func() { endSpan(span, err) }()
+
+	tmp, err := os.CreateTemp(s.StagingDir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int64("storage.size", size))
+
+	return &Staged{
+		Hash: hex.EncodeToString(hash.Sum(nil)),
+		Size: size,
+		path: tmp.Name(),
+	}, nil
+}
+
+// Open opens the staged file for reading.
+func (s *Staged) Open() (*os.File, error) {
+	return os.Open(s.path)
+}
+
+// Commit moves a staged file to its content-addressed location, replacing any
+// existing copy of the same content. Files staged on another filesystem are
+// copied instead.
+func (s *Store) Commit(ctx context.Context, staged *Staged) (err error) {
+	key := Key(staged.Hash)
+
+	_, span := tracer.Start(ctx, "storage.Commit", trace.WithAttributes(attribute.String("storage.key", key)))
+	defer func() { endSpan(span, err) }()
+
+	err = os.MkdirAll(filepath.Dir(s.Path(key)), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(staged.path, s.Path(key))
+	if errors.Is(err, syscall.EXDEV) {
+		return s.copyStaged(staged, s.Path(key))
+	}
+	return err
+}
+
+// copyStaged copies a staged file to path and removes the staged copy. The
+// file is written under a hidden temporary name next to path first, so that
+// it only appears once it is complete.
+func (s *Store) copyStaged(staged *Staged, path string) error {
+	src, err := staged.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".commit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, src)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	return s.Discard(staged)
+}
+
+// Discard removes a staged file that is no longer needed.
+func (s *Store) Discard(staged *Staged) error {
+	err := os.Remove(staged.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Remove deletes the file stored under key. Removing a missing file is not
+// an error.
+func (s *Store) Remove(ctx context.Context, key string) (err error) {
+	_, span := tracer.Start(ctx, "storage.Remove", trace.WithAttributes(attribute.String("storage.key", key)))
+	defer func() { endSpan(span, err) }()
+
+	err = os.Remove(s.Path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+// endSpan ends a storage span, marking it failed if err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
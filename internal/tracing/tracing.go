@@ -0,0 +1,64 @@
+// Package tracing sets up OpenTelemetry tracing: the global tracer provider,
+// W3C trace context propagation and trace IDs in log lines.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Options configures the trace exporter.
+type Options struct {
+	Enabled     bool
+	ServiceName string
+	// Endpoint is the OTLP/HTTP endpoint URL. If empty, the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT variable or http://localhost:4318 is used.
+	Endpoint    string
+	SampleRatio float64
+}
+
+// Setup installs the global propagator and, if tracing is enabled, a tracer
+// provider exporting spans over OTLP/HTTP. Incoming trace context is always
+// propagated so that traces aren't broken by instances with tracing off. The
+// returned function flushes any buffered spans.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !opts.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporterOpts []otlptracehttp.Option
+	if opts.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(opts.ServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
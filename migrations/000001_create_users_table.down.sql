@@ -1,2 +1,2 @@
-DROP TABLE IF EXISTS users;
-DROP TABLE IF EXISTS tokens;
\ No newline at end of file
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS users;
\ No newline at end of file
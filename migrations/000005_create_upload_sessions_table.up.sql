@@ -0,0 +1,14 @@
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    caption TEXT,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    checksum BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX idx_upload_sessions_expires_at ON upload_sessions(expires_at);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE photos DROP COLUMN IF EXISTS content_hash;
+DROP TABLE IF EXISTS blobs;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE blobs (
+    hash TEXT PRIMARY KEY,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE photos ADD COLUMN content_hash TEXT REFERENCES blobs(hash);
+
+CREATE INDEX idx_photos_user_id_content_hash ON photos(user_id, content_hash);
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS banned_hashes;
+ALTER TABLE photos DROP COLUMN IF EXISTS phash;
+ALTER TABLE users DROP COLUMN IF EXISTS is_moderator;
\ No newline at end of file
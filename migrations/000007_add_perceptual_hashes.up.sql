@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN is_moderator BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE photos ADD COLUMN phash BIGINT;
+
+CREATE TABLE banned_hashes (
+    id BIGSERIAL PRIMARY KEY,
+    phash BIGINT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS alt_text_reminders;
+ALTER TABLE upload_sessions DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE photos DROP COLUMN IF EXISTS alt_text;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE photos ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE upload_sessions ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN alt_text_reminders BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
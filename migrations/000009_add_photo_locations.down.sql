@@ -0,0 +1,16 @@
+ALTER TABLE upload_sessions
+    DROP COLUMN IF EXISTS import_location,
+    DROP COLUMN IF EXISTS place_name,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
+
+DROP INDEX IF EXISTS idx_photos_location;
+
+ALTER TABLE photos
+    DROP CONSTRAINT IF EXISTS photos_location_check,
+    DROP COLUMN IF EXISTS place_name,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
+
+DROP EXTENSION IF EXISTS earthdistance;
+DROP EXTENSION IF EXISTS cube;
\ No newline at end of file
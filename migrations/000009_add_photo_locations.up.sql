@@ -0,0 +1,16 @@
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+ALTER TABLE photos
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN place_name TEXT NOT NULL DEFAULT '',
+    ADD CONSTRAINT photos_location_check CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+CREATE INDEX idx_photos_location ON photos USING gist (ll_to_earth(latitude, longitude)) WHERE latitude IS NOT NULL;
+
+ALTER TABLE upload_sessions
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN place_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN import_location BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
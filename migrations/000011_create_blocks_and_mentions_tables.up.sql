@@ -0,0 +1,24 @@
+CREATE TABLE blocks (
+    blocker_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX idx_blocks_blocked_id ON blocks(blocked_id);
+
+CREATE TABLE mentions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    photo_id UUID NOT NULL REFERENCES photos(id) ON DELETE CASCADE,
+    comment_id UUID REFERENCES comments(id) ON DELETE CASCADE,
+    mention_offset INTEGER NOT NULL,
+    mention_length INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_mentions_photo_id ON mentions(photo_id) WHERE comment_id IS NULL;
+CREATE INDEX idx_mentions_comment_id ON mentions(comment_id);
+CREATE INDEX idx_mentions_user_id ON mentions(user_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS story_views;
+DROP TABLE IF EXISTS stories;
\ No newline at end of file
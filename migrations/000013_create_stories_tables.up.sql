@@ -0,0 +1,20 @@
+CREATE TABLE stories (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    photo_url TEXT NOT NULL,
+    content_hash TEXT NOT NULL REFERENCES blobs(hash),
+    caption TEXT NOT NULL DEFAULT '',
+    alt_text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_stories_user_id_expires_at ON stories(user_id, expires_at);
+CREATE INDEX idx_stories_expires_at ON stories(expires_at);
+
+CREATE TABLE story_views (
+    story_id UUID NOT NULL REFERENCES stories(id) ON DELETE CASCADE,
+    viewer_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (story_id, viewer_id)
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS collection_photos;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS saved_photos;
+ALTER TABLE users DROP COLUMN IF EXISTS is_private;
\ No newline at end of file
@@ -0,0 +1,30 @@
+ALTER TABLE users ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE saved_photos (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    photo_id UUID NOT NULL REFERENCES photos(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, photo_id)
+);
+
+CREATE TABLE collections (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX idx_collections_user_id_position ON collections(user_id, position);
+
+CREATE TABLE collection_photos (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    photo_id UUID NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, photo_id),
+    FOREIGN KEY (user_id, photo_id) REFERENCES saved_photos(user_id, photo_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_collection_photos_user_id_photo_id ON collection_photos(user_id, photo_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS comment_reactions;
+ALTER TABLE likes DROP COLUMN IF EXISTS reaction;
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE likes ADD COLUMN reaction VARCHAR(32) NOT NULL DEFAULT 'like';
+
+CREATE TABLE comment_reactions (
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE INDEX idx_comment_reactions_user_id ON comment_reactions(user_id);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE photos DROP COLUMN IF EXISTS pinned_comment_id;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE photos ADD COLUMN pinned_comment_id UUID REFERENCES comments(id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS explore_scores;
+DROP TABLE IF EXISTS explore_generations;
\ No newline at end of file
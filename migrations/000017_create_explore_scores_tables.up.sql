@@ -0,0 +1,15 @@
+CREATE TABLE explore_generations (
+    generation BIGSERIAL PRIMARY KEY,
+    computed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE explore_scores (
+    generation BIGINT NOT NULL REFERENCES explore_generations(generation) ON DELETE CASCADE,
+    photo_id UUID NOT NULL REFERENCES photos(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    rank INTEGER NOT NULL,
+    PRIMARY KEY (generation, photo_id)
+);
+
+CREATE INDEX idx_explore_scores_generation_rank ON explore_scores(generation, rank);
+CREATE INDEX idx_explore_scores_photo_id ON explore_scores(photo_id);
\ No newline at end of file
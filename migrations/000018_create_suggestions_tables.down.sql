@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_suggestions;
+DROP TABLE IF EXISTS suggestion_sets;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE suggestion_sets (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_suggestion_sets_computed_at ON suggestion_sets(computed_at);
+
+CREATE TABLE user_suggestions (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    suggested_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+CREATE INDEX idx_user_suggestions_suggested_id ON user_suggestions(suggested_id);
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE UNLOGGED TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMP WITH TIME ZONE NOT NULL,
+    allowed BOOLEAN NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DELETE FROM notifications WHERE actor_id IS NULL;
+ALTER TABLE notifications ALTER COLUMN actor_id SET NOT NULL;
+
+DROP TABLE IF EXISTS login_failures;
\ No newline at end of file
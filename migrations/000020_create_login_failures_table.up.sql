@@ -0,0 +1,8 @@
+CREATE TABLE login_failures (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE notifications ALTER COLUMN actor_id DROP NOT NULL;
\ No newline at end of file
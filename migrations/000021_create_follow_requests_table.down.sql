@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_stories_photo_url;
+DROP INDEX IF EXISTS idx_photos_photo_url;
+DROP TABLE IF EXISTS follow_requests;
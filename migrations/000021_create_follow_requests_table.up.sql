@@ -0,0 +1,12 @@
+CREATE TABLE follow_requests (
+    requester_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (requester_id, target_id),
+    CHECK (requester_id <> target_id)
+);
+
+CREATE INDEX idx_follow_requests_target_id ON follow_requests(target_id, created_at);
+
+CREATE INDEX idx_photos_photo_url ON photos(photo_url);
+CREATE INDEX idx_stories_photo_url ON stories(photo_url);
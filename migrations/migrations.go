@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations so the API binary can apply
+// them itself.
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named <version>_<name>.<up|down>.sql.
+//
+//go:embed *.sql
+var FS embed.FS